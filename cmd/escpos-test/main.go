@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"pos-printer/internal/config"
 	"pos-printer/internal/printer"
 )
 
@@ -20,12 +21,16 @@ func main() {
 	vid := "0x0fe6"
 	pid := "0x811e"
 
-	printer := printer.NewPosPrinter()
+	cfg, err := config.Load()
+	if err != nil {
+		log.Fatalf("Invalid configuration: %v", err)
+	}
+	printer := printer.NewPosPrinter(cfg)
 	if err := printer.CheckPrinter(vid, pid); err != nil {
 		log.Fatalf("Failed to check printer: %v", err)
 	}
 
-	writer, dev, err := printer.GetESCPOSWriter(vid, pid)
+	writer, err := printer.GetESCPOSWriter(vid, pid)
 	if err != nil {
 		log.Fatalf("Failed to get ESC writer: %v", err)
 	}
@@ -36,5 +41,7 @@ func main() {
 	writer.Write(ESC_FEED_N(5))
 	writer.Write(CUT_FULL)
 
-	defer dev.Close()
+	if err := writer.Close(); err != nil {
+		log.Fatalf("Failed to print: %v", err)
+	}
 }
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"pos-printer/internal/api"
+	"pos-printer/internal/config"
+	"pos-printer/internal/db"
+	"pos-printer/internal/model"
+)
+
+const apikeyUsage = `usage: pos-printer apikey <command>
+
+commands:
+  create -name <name> -scopes <scopes> [-printers <vid:pid,...>] [-origins <origin,...>]
+         [-client-cert <common name>] [-daily-labels <n>]
+              issue a key and print it, it is not shown again
+  list        list keys
+  revoke <id> stop a key from authenticating
+
+scopes: print, read-jobs, admin
+`
+
+// runAPIKey implements the apikey subcommand and returns the exit code.
+func runAPIKey(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, apikeyUsage)
+		return 2
+	}
+
+	switch args[0] {
+	case "create", "list":
+	case "revoke":
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, apikeyUsage)
+			return 2
+		}
+	default:
+		fmt.Fprint(os.Stderr, apikeyUsage)
+		return 2
+	}
+
+	var req model.APIKeyRequest
+	if args[0] == "create" {
+		flags := flag.NewFlagSet("apikey create", flag.ContinueOnError)
+		name := flags.String("name", "", "what the key is for, e.g. the client's name")
+		scopes := flags.String("scopes", "", "comma separated scopes")
+		printers := flags.String("printers", "", "comma separated vid:pid printers the key may use, default all")
+		origins := flags.String("origins", "", "comma separated browser origins the key may be used from, default all")
+		clientCert := flags.String("client-cert", "", "common name of a client certificate that authenticates as the key")
+		dailyLabels := flags.Int("daily-labels", -1, "labels the key may enqueue per day, 0 for unlimited, default the configured quota")
+		if err := flags.Parse(args[1:]); err != nil {
+			return 2
+		}
+		req = model.APIKeyRequest{
+			Name:         *name,
+			Scopes:       splitFlag(*scopes),
+			Printers:     splitFlag(*printers),
+			Origins:      splitFlag(*origins),
+			ClientCertCN: *clientCert,
+		}
+		if *dailyLabels >= 0 {
+			req.DailyLabelQuota = dailyLabels
+		}
+	}
+
+	// The keys table may be new, so the schema is brought up to date.
+	store, err := db.NewJobStore(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer store.Close()
+
+	switch args[0] {
+	case "create":
+		key, err := api.APIKeyFromRequest(&req)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		secret, err := model.NewAPIKey()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		key.Prefix = model.APIKeyDisplayPrefix(secret)
+		id, err := store.CreateAPIKey(key, model.HashAPIKey(secret))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		// The key exists now, so it is printed even if it cannot be read back.
+		created, err := store.FetchAPIKey(strconv.FormatInt(id, 10))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		auditCommand(store, model.AuditAPIKeyCreate, "apikey", id, nil, created)
+		fmt.Printf("created API key %d (%s), store it now, it is not shown again:\n%s\n", id, key.Name, secret)
+
+	case "list":
+		keys, err := store.ListAPIKeys()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tNAME\tPREFIX\tSCOPES\tPRINTERS\tORIGINS\tCLIENT CERT\tDAILY LABELS\tLAST USED\tREVOKED")
+		for _, k := range keys {
+			clientCert := k.ClientCertCN
+			if clientCert == "" {
+				clientCert = "-"
+			}
+			dailyLabels := "default"
+			if k.DailyLabelQuota != nil {
+				dailyLabels = strconv.Itoa(*k.DailyLabelQuota)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				k.ID, k.Name, k.Prefix, strings.Join(k.Scopes, ","), joinOrAll(k.Printers), joinOrAll(k.Origins), clientCert, dailyLabels,
+				formatOptionalTime(k.LastUsedAt, "never"), formatOptionalTime(k.RevokedAt, "-"))
+		}
+		w.Flush()
+
+	case "revoke":
+		if _, err := strconv.ParseInt(args[1], 10, 64); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid key id: %s\n", args[1])
+			return 2
+		}
+		before, err := store.FetchAPIKey(args[1])
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if err := store.RevokeAPIKey(args[1]); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to revoke key %s: %v\n", args[1], err)
+			return 1
+		}
+		after, err := store.FetchAPIKey(args[1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		auditCommand(store, model.AuditAPIKeyRevoke, "apikey", args[1], before, after)
+		fmt.Printf("revoked API key %s\n", args[1])
+	}
+	return 0
+}
+
+// warnIfNoAPIKeys points out on startup that requests will be rejected
+// because no key can authenticate, or only let in while bootstrapping.
+func warnIfNoAPIKeys(cfg *config.Config, store db.JobStore) {
+	if !cfg.AuthConfig.Required {
+		slog.Warn("API authentication is off, any client may print")
+		return
+	}
+	keys, err := store.ListAPIKeys()
+	if err != nil {
+		slog.Error("Error listing API keys", "error", err)
+		return
+	}
+	if len(keys) == 0 && cfg.AuthConfig.Bootstrap {
+		slog.Warn("No API keys exist, only clients on this machine may call the API until one is created: pos-printer apikey create -name <name> -scopes admin")
+		return
+	}
+	for _, k := range keys {
+		if k.RevokedAt == nil {
+			return
+		}
+	}
+	slog.Warn("No API keys exist, every request will be rejected; create one with: pos-printer apikey create -name <name> -scopes admin")
+}
+
+func splitFlag(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, ",")
+}
+
+func joinOrAll(list []string) string {
+	if len(list) == 0 {
+		return "all"
+	}
+	return strings.Join(list, ",")
+}
+
+func formatOptionalTime(t *time.Time, none string) string {
+	if t == nil {
+		return none
+	}
+	return t.Local().Format(time.DateTime)
+}
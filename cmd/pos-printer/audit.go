@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"reflect"
+	"slices"
+
+	"pos-printer/internal/config"
+	"pos-printer/internal/db"
+	"pos-printer/internal/model"
+)
+
+// auditedConfig is the part of the configuration kept in the audit log:
+// which printers the service prints on, and who may use it how much.
+// Printers are configured, not managed over the API, so adding or removing
+// one shows up here.
+type auditedConfig struct {
+	Printers           []string          `json:"printers"` // claimed by this instance, empty for all
+	VirtualPrinters    []string          `json:"virtualPrinters"`
+	VirtualAll         bool              `json:"virtualAll"`
+	LabelLanguage      string            `json:"labelLanguage"`
+	LabelLanguages     map[string]string `json:"labelLanguages"`
+	MaxPrintCount      int               `json:"maxPrintCount"`
+	Listeners          []string          `json:"listeners"`
+	AuthRequired       bool              `json:"authRequired"`
+	AuthBootstrap      bool              `json:"authBootstrap"`
+	ClientAuth         string            `json:"clientAuth"`
+	CORSAllowOrigins   []string          `json:"corsAllowOrigins"`
+	RatePerMinute      int               `json:"ratePerMinute"`
+	RateBurst          int               `json:"rateBurst"`
+	KeyDailyLabels     int               `json:"keyDailyLabels"`
+	PrinterDailyLabels map[string]int    `json:"printerDailyLabels"`
+	MaxQueuedJobs      int               `json:"maxQueuedJobs"`
+}
+
+func newAuditedConfig(cfg *config.Config) auditedConfig {
+	virtual := []string{}
+	for key, on := range cfg.PrinterConfig.VirtualConfig.Printers {
+		if on {
+			virtual = append(virtual, key)
+		}
+	}
+	slices.Sort(virtual)
+
+	return auditedConfig{
+		Printers:           cfg.WorkerConfig.Printers,
+		VirtualPrinters:    virtual,
+		VirtualAll:         cfg.PrinterConfig.VirtualConfig.All,
+		LabelLanguage:      cfg.PrinterConfig.LabelLanguage,
+		LabelLanguages:     cfg.PrinterConfig.LabelLanguages,
+		MaxPrintCount:      cfg.PrinterConfig.MaxPrintCount,
+		Listeners:          cfg.ServerConfig.Listeners,
+		AuthRequired:       cfg.AuthConfig.Required,
+		AuthBootstrap:      cfg.AuthConfig.Bootstrap,
+		ClientAuth:         cfg.ServerConfig.ClientAuth,
+		CORSAllowOrigins:   cfg.ServerConfig.CORS.AllowOrigins,
+		RatePerMinute:      cfg.LimitsConfig.RatePerMinute,
+		RateBurst:          cfg.LimitsConfig.RateBurst,
+		KeyDailyLabels:     cfg.LimitsConfig.KeyDailyLabels,
+		PrinterDailyLabels: cfg.LimitsConfig.PrinterDailyLabels,
+		MaxQueuedJobs:      cfg.LimitsConfig.MaxQueuedJobs,
+	}
+}
+
+// auditConfigChange records the configuration in the audit log on startup
+// if it differs from the one last recorded, with that one as before.
+func auditConfigChange(cfg *config.Config, store db.JobStore) {
+	after := model.AuditSnapshot(newAuditedConfig(cfg))
+
+	last, err := store.ListAuditEntries(model.AuditFilter{Action: model.AuditConfigChange, Limit: 1})
+	if err != nil {
+		slog.Error("Error reading the audit log", "error", err)
+		return
+	}
+	var before json.RawMessage
+	if len(last) > 0 {
+		before = last[0].After
+		// PostgreSQL stores snapshots as jsonb, which does not keep the
+		// encoding, so they are compared decoded.
+		var was, is any
+		if json.Unmarshal(before, &was) == nil && json.Unmarshal(after, &is) == nil && reflect.DeepEqual(was, is) {
+			return
+		}
+	}
+
+	err = store.AppendAuditEntry(&model.AuditEntry{
+		Source:     model.AuditSourceStartup,
+		Action:     model.AuditConfigChange,
+		TargetType: "config",
+		Before:     before,
+		After:      after,
+	})
+	if err != nil {
+		slog.Error("Error writing audit entry", "action", model.AuditConfigChange, "error", err)
+	}
+}
+
+// auditCommand records an action taken with a pos-printer command,
+// attributed to the OS user who ran it. The action has already happened,
+// so a failed write is reported, not returned.
+func auditCommand(store db.JobStore, action, targetType string, targetID any, before, after any) {
+	err := store.AppendAuditEntry(&model.AuditEntry{
+		Source:     model.AuditSourceCLI,
+		Action:     action,
+		OSUser:     osUser(),
+		TargetType: targetType,
+		TargetID:   fmt.Sprint(targetID),
+		Before:     model.AuditSnapshot(before),
+		After:      model.AuditSnapshot(after),
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write audit entry for %s: %v\n", action, err)
+	}
+}
+
+// osUser names the user running this process, falling back to the
+// environment where the user database cannot be read.
+func osUser() string {
+	if u, err := user.Current(); err == nil {
+		return u.Username
+	}
+	for _, name := range []string{"USER", "USERNAME"} {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return "unknown"
+}
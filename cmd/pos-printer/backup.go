@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"pos-printer/internal/config"
+	"pos-printer/internal/db"
+	"pos-printer/internal/model"
+)
+
+const backupUsage = `usage: pos-printer backup [list]
+
+  backup        snapshot the database into POS_PRINTER_BACKUP_DIR
+  backup list   list the backups, newest first
+`
+
+const restoreUsage = `usage: pos-printer restore <backup>
+
+Replaces the database with a backup, given by name, as "latest", or as a
+path. It refuses while the service has the database open. The replaced
+database is kept next to it.
+`
+
+// runBackup implements the backup subcommand and returns the exit code.
+func runBackup(cfg *config.Config, args []string) int {
+	if len(args) > 0 && args[0] == "list" {
+		backups, err := db.ListBackups(cfg.BackupConfig.Dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSIZE\tCREATED")
+		for _, b := range backups {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", b.Name, b.Size, b.CreatedAt.Format(time.DateTime))
+		}
+		w.Flush()
+		return 0
+	}
+	if len(args) > 0 {
+		fmt.Fprint(os.Stderr, backupUsage)
+		return 2
+	}
+
+	store, err := db.OpenJobStore(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer store.Close()
+
+	backup, err := store.CreateBackup()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	auditCommand(store, model.AuditBackupCreate, "backup", backup.Name, nil, backup)
+	fmt.Printf("backed up to %s (%d bytes)\n", backup.Path, backup.Size)
+	return 0
+}
+
+// runRestore implements the restore subcommand and returns the exit code.
+func runRestore(cfg *config.Config, args []string) int {
+	if len(args) != 1 {
+		fmt.Fprint(os.Stderr, restoreUsage)
+		return 2
+	}
+	if cfg.DBConfig.Driver != config.DriverSQLite {
+		fmt.Fprintln(os.Stderr, db.ErrBackupUnsupported)
+		return 1
+	}
+
+	backup, err := db.FindBackup(cfg.BackupConfig.Dir, args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := db.RestoreSQLite(cfg, backup.Path); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	fmt.Printf("restored %s\n", backup.Name)
+
+	// The entry goes into the restored database, the one the service
+	// continues with.
+	store, err := db.OpenJobStore(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to write audit entry for %s: %v\n", model.AuditBackupRestore, err)
+		return 0
+	}
+	defer store.Close()
+	auditCommand(store, model.AuditBackupRestore, "backup", backup.Name, nil, backup)
+	return 0
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"pos-printer/internal/config"
+	"pos-printer/internal/localca"
+)
+
+const caUsage = `usage: pos-printer ca <command>
+
+commands:
+  status          show the local CA root and the server certificate
+  export [file]   write the root certificate, to stdout by default, for
+                  installing on clients
+`
+
+// runCA implements the ca subcommand and returns the exit code. The CA is
+// created if it does not exist yet, as the service would on startup.
+func runCA(cfg *config.Config, args []string) int {
+	if len(args) == 0 || (args[0] != "status" && args[0] != "export") || len(args) > 2 {
+		fmt.Fprint(os.Stderr, caUsage)
+		return 2
+	}
+
+	ca, err := localca.Open(cfg.ServerConfig.LocalCADir, cfg.ServerConfig.LocalCAHosts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	switch args[0] {
+	case "status":
+		root, leaf := ca.Root(), ca.Server()
+		fmt.Printf("root:    %s, valid until %s\n", root.Subject.CommonName, root.NotAfter.Local().Format(time.DateTime))
+		fmt.Printf("server:  valid until %s\n", leaf.NotAfter.Local().Format(time.DateTime))
+		names := append([]string{}, leaf.DNSNames...)
+		for _, ip := range leaf.IPAddresses {
+			names = append(names, ip.String())
+		}
+		fmt.Printf("names:   %s\n", strings.Join(names, ", "))
+		permitted := append([]string{}, root.PermittedDNSDomains...)
+		for _, r := range root.PermittedIPRanges {
+			permitted = append(permitted, r.String())
+		}
+		fmt.Printf("limits:  %s\n", strings.Join(permitted, ", "))
+		if cfg.ServerConfig.CertMode == config.CertModeFiles {
+			fmt.Println("note:    POS_PRINTER_SERVER_CERT_MODE=files, the service does not use the local CA")
+		}
+
+	case "export":
+		if len(args) == 1 {
+			os.Stdout.Write(ca.RootPEM())
+			return 0
+		}
+		if err := os.WriteFile(args[1], ca.RootPEM(), 0644); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("wrote the root certificate to %s\n", args[1])
+	}
+	return 0
+}
@@ -24,8 +24,7 @@ package main
 
 import (
 	"context"
-	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
 	"syscall"
@@ -35,52 +34,91 @@ import (
 	"pos-printer/internal/config"
 	"pos-printer/internal/db"
 	"pos-printer/internal/job"
+	"pos-printer/internal/logging"
 	"pos-printer/internal/printer"
 )
 
 func main() {
+	os.Exit(run())
+}
+
+// run runs the service or a subcommand and returns the exit code. It
+// returns rather than exits, so deferred cleanup such as closing the log
+// file runs first.
+func run() int {
 	// Load configuration
-	cfg := config.Load()
+	cfg, err := config.Load()
+	if err != nil {
+		slog.Error("Invalid configuration", "error", err)
+		return 1
+	}
+
+	closeLog, err := logging.Setup(cfg.LogConfig)
+	if err != nil {
+		slog.Error("Invalid log settings", "error", err)
+		return 1
+	}
+	defer closeLog()
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate":
+			return runMigrate(cfg, os.Args[2:])
+		case "backup":
+			return runBackup(cfg, os.Args[2:])
+		case "restore":
+			return runRestore(cfg, os.Args[2:])
+		case "apikey":
+			return runAPIKey(cfg, os.Args[2:])
+		case "ca":
+			return runCA(cfg, os.Args[2:])
+		}
+	}
 
-	// Initialize SQLite database
-	sqlite, err := db.NewSQLite(cfg)
+	// Initialize the job database
+	store, err := db.NewJobStore(cfg)
 	if err != nil {
-		log.Fatalf("failed to initialize SQLite database: %v", err)
+		slog.Error("Failed to initialize the database", "driver", cfg.DBConfig.Driver, "error", err)
+		return 1
 	}
-	defer sqlite.Close()
+	defer store.Close()
+	warnIfNoAPIKeys(cfg, store)
+	auditConfigChange(cfg, store)
 
-	posPrinter := printer.NewPosPrinter()
+	posPrinter := printer.NewPosPrinter(cfg)
 	defer posPrinter.Cleanup()
 
-	processor := job.NewProcessor(posPrinter, sqlite, cfg)
+	// Listeners open before the workers start, so a port in use stops the
+	// service before it claims any job.
+	server := api.NewServer(cfg, store, posPrinter)
+	if err := server.Start(); err != nil {
+		slog.Error("Failed to start server", "error", err)
+		return 1
+	}
+
+	processor := job.NewProcessor(posPrinter, store, cfg)
 	processor.StartWorkers()
 	defer processor.StopWorkers()
 
-	server := api.NewServer(cfg, sqlite, posPrinter)
-
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 
-	// Start HTTPS server in a goroutine
-	go func() {
-		if err := server.StartTLS(); err != nil && err.Error() != "http: Server closed" {
-			log.Printf("server failed: %v", err)
-		}
-	}()
-
-	fmt.Printf("🚀 POS Printer Service started securely on https://localhost%s\n", cfg.ServerConfig.Endpoint)
+	for _, url := range server.URLs() {
+		slog.Info("POS Printer Service listening", "url", url)
+	}
 
 	// Wait for termination signal
 	<-sigChan
-	fmt.Println("\n🛑 Shutting down gracefully...")
+	slog.Info("Shutting down gracefully")
 
 	// Shutdown server with timeout
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
 	if err := server.Shutdown(ctx); err != nil {
-		log.Printf("server shutdown error: %v", err)
+		slog.Error("Server shutdown failed", "error", err)
 	}
 
-	fmt.Println("✅ Cleanup completed")
+	slog.Info("Cleanup completed")
+	return 0
 }
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"pos-printer/internal/config"
+	"pos-printer/internal/db"
+	"pos-printer/internal/model"
+)
+
+const migrateUsage = `usage: pos-printer migrate <command>
+
+commands:
+  status      list migrations and whether they are applied
+  up          apply all pending migrations
+  down [n]    revert the last n applied migrations (default 1)
+`
+
+// runMigrate implements the migrate subcommand and returns the exit code.
+func runMigrate(cfg *config.Config, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	store, err := db.OpenJobStore(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer store.Close()
+
+	switch args[0] {
+	case "status":
+		status, err := store.MigrationStatus()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tAPPLIED")
+		for _, st := range status {
+			applied := "pending"
+			if st.AppliedAt != nil {
+				applied = st.AppliedAt.Local().Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%04d\t%s\t%s\n", st.Version, st.Name, applied)
+		}
+		w.Flush()
+
+	case "up":
+		applied, err := store.MigrateUp()
+		for _, mig := range applied {
+			fmt.Printf("applied %04d_%s\n", mig.Version, mig.Name)
+		}
+		auditMigrations(store, model.AuditSchemaMigrate, applied)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(applied) == 0 {
+			fmt.Println("schema is up to date")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				fmt.Fprintf(os.Stderr, "invalid number of migrations: %s\n", args[1])
+				return 2
+			}
+		}
+		reverted, err := store.MigrateDown(steps)
+		for _, mig := range reverted {
+			fmt.Printf("reverted %04d_%s\n", mig.Version, mig.Name)
+		}
+		auditMigrations(store, model.AuditSchemaRevert, reverted)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(reverted) == 0 {
+			fmt.Println("no migrations to revert")
+		}
+
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}
+
+// auditLogMigration names the migration that creates the audit log.
+const auditLogMigration = "audit_log"
+
+// auditMigrations records the migrations a command applied or reverted,
+// leaving out those that ran while there was no audit log to record them
+// in: applied before it was created, or reverted after it was dropped.
+func auditMigrations(store db.JobStore, action string, migrations []db.Migration) {
+	for i, mig := range migrations {
+		if mig.Name != auditLogMigration {
+			continue
+		}
+		if action == model.AuditSchemaMigrate {
+			migrations = migrations[i:]
+		} else {
+			migrations = migrations[:i]
+		}
+		break
+	}
+	for _, mig := range migrations {
+		auditCommand(store, action, "migration", fmt.Sprintf("%04d_%s", mig.Version, mig.Name), nil, nil)
+	}
+}
@@ -8,16 +8,23 @@ require (
 )
 
 require (
+	github.com/boombuler/barcode v1.1.0
+	github.com/gen2brain/go-fitz v1.24.15
+	github.com/jackc/pgx/v5 v5.7.5
 	github.com/joho/godotenv v1.5.1
+	github.com/karalabe/hid v1.0.0
 	github.com/mattn/go-sqlite3 v1.14.28
+	github.com/robfig/cron/v3 v3.0.1
+	golang.org/x/image v0.30.0
 )
 
 require (
 	github.com/creack/goselect v0.1.2 // indirect
 	github.com/ebitengine/purego v0.8.4 // indirect
-	github.com/gen2brain/go-fitz v1.24.15 // indirect
+	github.com/jackc/pgpassfile v1.0.0 // indirect
+	github.com/jackc/pgservicefile v0.0.0-20240606120523-5a60cdf6a761 // indirect
+	github.com/jackc/puddle/v2 v2.2.2 // indirect
 	github.com/jupiterrider/ffi v0.5.0 // indirect
-	github.com/karalabe/hid v1.0.0 // indirect
 	github.com/labstack/gommon v0.4.2 // indirect
 	github.com/mattn/go-colorable v0.1.14 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
@@ -25,8 +32,8 @@ require (
 	github.com/valyala/fasttemplate v1.2.2 // indirect
 	go.bug.st/serial v1.6.4 // indirect
 	golang.org/x/crypto v0.38.0 // indirect
-	golang.org/x/image v0.30.0 // indirect
 	golang.org/x/net v0.40.0 // indirect
+	golang.org/x/sync v0.16.0 // indirect
 	golang.org/x/sys v0.33.0 // indirect
 	golang.org/x/text v0.28.0 // indirect
 	golang.org/x/time v0.11.0 // indirect
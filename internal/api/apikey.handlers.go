@@ -0,0 +1,73 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"pos-printer/internal/db"
+	"pos-printer/internal/model"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (server *Server) listAPIKeysHandler(c echo.Context) error {
+	keys, err := server.store.ListAPIKeys()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error fetching API keys"})
+	}
+	return c.JSON(http.StatusOK, keys)
+}
+
+// createAPIKeyHandler issues a key. The key itself is only ever returned
+// here; the database keeps its hash.
+func (server *Server) createAPIKeyHandler(c echo.Context) error {
+	var req model.APIKeyRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid JSON"})
+	}
+
+	key, err := APIKeyFromRequest(&req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	secret, err := model.NewAPIKey()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to generate API key"})
+	}
+	key.Prefix = model.APIKeyDisplayPrefix(secret)
+
+	id, err := server.store.CreateAPIKey(key, model.HashAPIKey(secret))
+	if err != nil {
+		if errors.Is(err, db.ErrClientCertTaken) {
+			return c.JSON(http.StatusConflict, echo.Map{"error": "Client certificate is already mapped to another API key"})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to create API key"})
+	}
+	created, err := server.store.FetchAPIKey(strconv.FormatInt(id, 10))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error fetching API key"})
+	}
+	server.audit(c, model.AuditAPIKeyCreate, "apikey", id, "", nil, created)
+	return c.JSON(http.StatusCreated, echo.Map{"key": secret, "apiKey": created})
+}
+
+func (server *Server) revokeAPIKeyHandler(c echo.Context) error {
+	before, err := server.store.FetchAPIKey(c.Param("id"))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error fetching API key"})
+	}
+	if err := server.store.RevokeAPIKey(c.Param("id")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "API key not found or already revoked"})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to revoke API key"})
+	}
+	after, err := server.store.FetchAPIKey(c.Param("id"))
+	if err != nil {
+		requestLogger(c).Error("Error fetching revoked API key", "api_key_id", c.Param("id"), "error", err)
+	}
+	server.audit(c, model.AuditAPIKeyRevoke, "apikey", before.ID, "", before, after)
+	return c.NoContent(http.StatusNoContent)
+}
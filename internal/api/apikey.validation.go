@@ -0,0 +1,84 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"pos-printer/internal/config"
+	"pos-printer/internal/model"
+	"slices"
+	"strings"
+)
+
+const (
+	maxAPIKeyNameLength = 100
+	maxClientCertCN     = 64 // upper bound for commonName in RFC 5280
+)
+
+// APIKeyFromRequest validates a request for a new API key. Printers are
+// normalized to printer keys and origins to lower case.
+func APIKeyFromRequest(req *model.APIKeyRequest) (*model.APIKey, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, errors.New("name is required")
+	}
+	if len(name) > maxAPIKeyNameLength {
+		return nil, fmt.Errorf("name must not exceed %d characters", maxAPIKeyNameLength)
+	}
+
+	if len(req.Scopes) == 0 {
+		return nil, fmt.Errorf("scopes is required, one or more of %s", strings.Join(model.Scopes, ", "))
+	}
+	scopes := []string{}
+	for _, scope := range req.Scopes {
+		scope = strings.TrimSpace(scope)
+		if !slices.Contains(model.Scopes, scope) {
+			return nil, fmt.Errorf("unknown scope %q, must be one of %s", scope, strings.Join(model.Scopes, ", "))
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	printers := []string{}
+	for _, p := range req.Printers {
+		vid, pid, ok := strings.Cut(strings.TrimSpace(p), ":")
+		if !ok || vid == "" || pid == "" {
+			return nil, fmt.Errorf("printer %q must be given as vid:pid", p)
+		}
+		if key := config.PrinterKey(vid, pid); !slices.Contains(printers, key) {
+			printers = append(printers, key)
+		}
+	}
+
+	origins := []string{}
+	for _, o := range req.Origins {
+		o = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(o), "/"))
+		if o != "*" && !strings.HasPrefix(o, "https://") && !strings.HasPrefix(o, "http://") {
+			return nil, fmt.Errorf("origin %q must start with https:// or http://", o)
+		}
+		if strings.Contains(o, ",") {
+			return nil, fmt.Errorf("origin %q must not contain a comma", o)
+		}
+		if !slices.Contains(origins, o) {
+			origins = append(origins, o)
+		}
+	}
+
+	clientCertCN := strings.TrimSpace(req.ClientCertCN)
+	if len(clientCertCN) > maxClientCertCN {
+		return nil, fmt.Errorf("clientCertCN must not exceed %d characters", maxClientCertCN)
+	}
+
+	if req.DailyLabelQuota != nil && *req.DailyLabelQuota < 0 {
+		return nil, errors.New("dailyLabelQuota must not be negative")
+	}
+
+	return &model.APIKey{
+		Name:            name,
+		Scopes:          scopes,
+		Printers:        printers,
+		Origins:         origins,
+		ClientCertCN:    clientCertCN,
+		DailyLabelQuota: req.DailyLabelQuota,
+	}, nil
+}
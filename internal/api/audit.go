@@ -0,0 +1,165 @@
+package api
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"pos-printer/internal/config"
+	"pos-printer/internal/db"
+	"pos-printer/internal/model"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// audit records an action taken by the request's client. before and after
+// are snapshots of what changed, nil where there is nothing to show. The
+// action has already happened, so a failed write is logged, not returned.
+func (server *Server) audit(c echo.Context, action, targetType string, targetID any, printerKey string, before, after any) {
+	entry := &model.AuditEntry{
+		Source:     model.AuditSourceAPI,
+		Action:     action,
+		IP:         c.RealIP(),
+		UserAgent:  c.Request().UserAgent(),
+		TargetType: targetType,
+		TargetID:   fmt.Sprint(targetID),
+		PrinterKey: printerKey,
+		Before:     model.AuditSnapshot(before),
+		After:      model.AuditSnapshot(after),
+	}
+	if key := apiKey(c); key != nil {
+		entry.APIKeyID, entry.APIKeyName = &key.ID, key.Name
+	}
+	if err := server.store.AppendAuditEntry(entry); err != nil {
+		requestLogger(c).Error("Error writing audit entry", "action", action, "target_type", targetType, "target_id", targetID, "error", err)
+	}
+}
+
+// auditLogHandler lists audit entries, newest first, as JSON or with
+// format=csv as a CSV download.
+func (server *Server) auditLogHandler(c echo.Context) error {
+	filter, err := auditFilterFromQuery(c)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	csvExport := c.QueryParam("format") == "csv"
+	if csvExport && c.QueryParam("limit") == "" {
+		filter.Limit = db.MaxAuditLimit
+	}
+
+	entries, err := server.store.ListAuditEntries(filter)
+	if err != nil {
+		requestLogger(c).Error("Error listing audit entries", "error", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error fetching audit log"})
+	}
+	if !csvExport {
+		return c.JSON(http.StatusOK, entries)
+	}
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	res.Header().Set(echo.HeaderContentDisposition,
+		fmt.Sprintf(`attachment; filename="pos-printer-audit-%s.csv"`, time.Now().Format("20060102-150405")))
+	res.WriteHeader(http.StatusOK)
+
+	w := csv.NewWriter(res)
+	w.Write([]string{"id", "at", "source", "action", "apiKeyId", "apiKeyName", "ip", "userAgent", "osUser",
+		"targetType", "targetId", "printerKey", "before", "after"})
+	for _, e := range entries {
+		apiKeyID := ""
+		if e.APIKeyID != nil {
+			apiKeyID = strconv.FormatInt(*e.APIKeyID, 10)
+		}
+		w.Write([]string{strconv.FormatInt(e.ID, 10), e.At.UTC().Format(time.RFC3339), csvText(e.Source),
+			csvText(e.Action), apiKeyID, csvText(e.APIKeyName), csvText(e.IP), csvText(e.UserAgent), csvText(e.OSUser),
+			csvText(e.TargetType), csvText(e.TargetID), csvText(e.PrinterKey),
+			csvText(string(e.Before)), csvText(string(e.After))})
+	}
+	w.Flush()
+	return w.Error()
+}
+
+// csvText keeps text from being run as a formula when the export is
+// opened in a spreadsheet. Every text column goes through it, since ids,
+// addresses and snapshots can all carry what a client sent.
+func csvText(s string) string {
+	if s != "" && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
+
+func auditFilterFromQuery(c echo.Context) (model.AuditFilter, error) {
+	f := model.AuditFilter{
+		Action:     c.QueryParam("action"),
+		Source:     c.QueryParam("source"),
+		TargetType: c.QueryParam("targetType"),
+		TargetID:   c.QueryParam("targetId"),
+	}
+	if p := c.QueryParam("printer"); p != "" {
+		vid, pid, ok := strings.Cut(p, ":")
+		if !ok {
+			return f, fmt.Errorf("printer %q must be given as vid:pid", p)
+		}
+		f.PrinterKey = config.PrinterKey(vid, pid)
+	}
+	if v := c.QueryParam("apiKeyId"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return f, errors.New("apiKeyId must be a number")
+		}
+		f.APIKeyID = &id
+	}
+	beforeID, err := positiveQueryInt(c, "beforeId")
+	if err != nil {
+		return f, err
+	}
+	limit, err := positiveQueryInt(c, "limit")
+	if err != nil {
+		return f, err
+	}
+	f.BeforeID, f.Limit = beforeID, int(limit)
+
+	if f.From, err = parseAuditTime(c.QueryParam("from"), false); err != nil {
+		return f, fmt.Errorf("from: %w", err)
+	}
+	if f.To, err = parseAuditTime(c.QueryParam("to"), true); err != nil {
+		return f, fmt.Errorf("to: %w", err)
+	}
+	return f, nil
+}
+
+// positiveQueryInt parses an optional query parameter, 0 if it is absent.
+func positiveQueryInt(c echo.Context, name string) (int64, error) {
+	v := c.QueryParam(name)
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a positive number", name)
+	}
+	return n, nil
+}
+
+// parseAuditTime accepts RFC 3339 times and local dates. A date as the
+// end of a range includes the whole day.
+func parseAuditTime(v string, end bool) (*time.Time, error) {
+	if v == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation(time.DateOnly, v, time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("%q must be a date like 2025-01-31 or an RFC 3339 time", v)
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/csv"
+	"net/http"
+	"pos-printer/internal/model"
+	"strings"
+	"testing"
+)
+
+func TestAuditCSVEscapesEveryColumn(t *testing.T) {
+	store := newFakeStore()
+	store.audit = []*model.AuditEntry{{
+		ID: 1, Source: "=api", Action: "+job.enqueue", APIKeyName: "@key", IP: "-1+1",
+		UserAgent: "=cmd", OSUser: "-user", TargetType: "@job", TargetID: "=HYPERLINK(\"x\")", PrinterKey: "+0x0fe6",
+		Before: []byte(`-1`), After: []byte(`=1`),
+	}}
+	server := NewServer(testConfig(), store, &fakePrinter{})
+
+	rec := serve(t, server, http.MethodGet, "/audit?format=csv", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+	}
+	rows, err := csv.NewReader(rec.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 {
+		t.Fatalf("%d rows, want a header and one entry", len(rows))
+	}
+	for i, value := range rows[1] {
+		if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+			t.Errorf("column %s = %q, want it escaped", rows[0][i], value)
+		}
+	}
+}
+
+func TestAuditIgnoresForwardedHeaders(t *testing.T) {
+	store := newFakeStore()
+	server := NewServer(testConfig(), store, &fakePrinter{})
+
+	rec := serve(t, server, http.MethodPost, "/barcode/print", `{"barcodeData":"AX2B2CL21LL2"}`,
+		"X-Forwarded-For", "203.0.113.1", "X-Real-IP", "203.0.113.1")
+	if rec.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want 202; body %s", rec.Code, rec.Body)
+	}
+	if len(store.audit) != 1 {
+		t.Fatalf("audit = %+v, want one entry", store.audit)
+	}
+	// httptest requests come from 192.0.2.1.
+	if ip := store.audit[0].IP; ip != "192.0.2.1" {
+		t.Errorf("audit ip = %q, want the connection's 192.0.2.1", ip)
+	}
+}
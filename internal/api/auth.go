@@ -0,0 +1,171 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net"
+	"net/http"
+	"pos-printer/internal/config"
+	"pos-printer/internal/model"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// apiKeyContextKey holds the authenticated *model.APIKey in echo.Context.
+const apiKeyContextKey = "apiKey"
+
+// touchInterval limits how often a key's lastUsedAt is written, so busy
+// clients do not add a write to every request.
+const touchInterval = time.Minute
+
+// keyUsage remembers when each key's lastUsedAt was last written.
+type keyUsage struct {
+	mu      sync.Mutex
+	touched map[int64]time.Time
+}
+
+func (u *keyUsage) due(id int64, now time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if now.Sub(u.touched[id]) < touchInterval {
+		return false
+	}
+	u.touched[id] = now
+	return true
+}
+
+// errNoCredentials means the request carried neither an API key nor a
+// client certificate.
+var errNoCredentials = errors.New("no credentials")
+
+// errUnmappedClientCert means a verified client certificate is not mapped
+// to a key that is not revoked.
+var errUnmappedClientCert = errors.New("client certificate is not mapped to an API key")
+
+// requireScope authenticates the request and checks that its key grants
+// scope. The key is given as "Authorization: Bearer <key>" or
+// "X-API-Key: <key>", or with mutual TLS, by a client certificate mapped
+// to a key. With authentication off, or while bootstrapping, requests
+// without credentials pass, but credentials that are given are still
+// checked, so jobs are attributed to their key and its restrictions apply.
+func (server *Server) requireScope(scope string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			key, err := server.authenticate(c.Request())
+			if err != nil {
+				if errors.Is(err, errNoCredentials) && (!server.cfg.AuthConfig.Required || server.bootstrapping(c)) {
+					return next(c)
+				}
+				switch {
+				case errors.Is(err, errNoCredentials):
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+					return c.JSON(http.StatusUnauthorized, echo.Map{"error": "API key required"})
+				case errors.Is(err, errUnmappedClientCert):
+					return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Client certificate is not mapped to an API key"})
+				case errors.Is(err, sql.ErrNoRows):
+					c.Response().Header().Set(echo.HeaderWWWAuthenticate, "Bearer")
+					return c.JSON(http.StatusUnauthorized, echo.Map{"error": "Invalid API key"})
+				}
+				requestLogger(c).Error("Error fetching API key", "error", err)
+				return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error checking API key"})
+			}
+			if !key.HasScope(scope) {
+				return c.JSON(http.StatusForbidden, echo.Map{"error": "API key lacks the " + scope + " scope"})
+			}
+			// Only browsers send an origin; other clients are not restricted.
+			if origin := c.Request().Header.Get(echo.HeaderOrigin); origin != "" && len(key.Origins) > 0 &&
+				!originAllowed(key.Origins, origin) {
+				return c.JSON(http.StatusForbidden, echo.Map{"error": "API key may not be used from this origin"})
+			}
+
+			if server.keyUsage.due(key.ID, time.Now()) {
+				if err := server.store.TouchAPIKey(key.ID); err != nil {
+					requestLogger(c).Error("Error recording use of API key", "api_key_id", key.ID, "error", err)
+				}
+			}
+			c.Set(apiKeyContextKey, key)
+			return next(c)
+		}
+	}
+}
+
+// bootstrapping reports whether a request without credentials may pass
+// because no API key has been created yet and the client is on this
+// machine. Revoked keys count too, so revoking every key does not reopen
+// the API. A request forwarded by a proxy is not trusted to be local.
+func (server *Server) bootstrapping(c echo.Context) bool {
+	if !server.cfg.AuthConfig.Bootstrap || server.keyMade.Load() {
+		return false
+	}
+	req := c.Request()
+	for _, h := range []string{echo.HeaderXForwardedFor, echo.HeaderXRealIP, "Forwarded"} {
+		if req.Header.Get(h) != "" {
+			return false
+		}
+	}
+	if ip := net.ParseIP(c.RealIP()); ip == nil || !ip.IsLoopback() {
+		return false
+	}
+	keys, err := server.store.ListAPIKeys()
+	if err != nil {
+		requestLogger(c).Error("Error listing API keys", "error", err)
+		return false
+	}
+	if len(keys) > 0 {
+		server.keyMade.Store(true)
+		return false
+	}
+	return true
+}
+
+// authenticate finds the key a request is made with. An API key in the
+// headers takes precedence over a client certificate. It returns
+// sql.ErrNoRows for an unknown or revoked key.
+func (server *Server) authenticate(r *http.Request) (*model.APIKey, error) {
+	if secret := apiKeyFromHeaders(r); secret != "" {
+		return server.store.FetchAPIKeyByHash(model.HashAPIKey(secret))
+	}
+	if cn := clientCertCN(r.TLS); cn != "" {
+		key, err := server.store.FetchAPIKeyByClientCert(cn)
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, errUnmappedClientCert
+		}
+		return key, err
+	}
+	return nil, errNoCredentials
+}
+
+func apiKeyFromHeaders(r *http.Request) string {
+	if auth := r.Header.Get(echo.HeaderAuthorization); auth != "" {
+		scheme, token, ok := strings.Cut(auth, " ")
+		if ok && strings.EqualFold(scheme, "Bearer") {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+// apiKey returns the key the request was authenticated with, or nil.
+func apiKey(c echo.Context) *model.APIKey {
+	key, _ := c.Get(apiKeyContextKey).(*model.APIKey)
+	return key
+}
+
+// apiKeyID returns the id of the key the request was authenticated with,
+// for attributing the jobs it creates.
+func apiKeyID(c echo.Context) *int64 {
+	if key := apiKey(c); key != nil {
+		return &key.ID
+	}
+	return nil
+}
+
+// allowsPrinter reports whether the request's key may use the printer. A
+// request without a key may use any printer.
+func allowsPrinter(c echo.Context, vid, pid string) bool {
+	key := apiKey(c)
+	return key == nil || key.AllowsPrinter(config.PrinterKey(vid, pid))
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"pos-printer/internal/db"
+	"pos-printer/internal/model"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (server *Server) listBackupsHandler(c echo.Context) error {
+	backups, err := db.ListBackups(server.cfg.BackupConfig.Dir)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error listing backups"})
+	}
+	return c.JSON(http.StatusOK, backups)
+}
+
+func (server *Server) createBackupHandler(c echo.Context) error {
+	backup, err := server.store.CreateBackup()
+	if err != nil {
+		if errors.Is(err, db.ErrBackupUnsupported) {
+			return c.JSON(http.StatusNotImplemented, echo.Map{"error": err.Error()})
+		}
+		requestLogger(c).Error("Backup failed", "error", err)
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Backup failed"})
+	}
+	server.audit(c, model.AuditBackupCreate, "backup", backup.Name, "", nil, backup)
+	return c.JSON(http.StatusCreated, backup)
+}
+
+// downloadBackupHandler serves a backup file, so it can be kept off the
+// print server.
+func (server *Server) downloadBackupHandler(c echo.Context) error {
+	backups, err := db.ListBackups(server.cfg.BackupConfig.Dir)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error listing backups"})
+	}
+	// Only names from the listing are served, never arbitrary paths.
+	for _, b := range backups {
+		if b.Name == c.Param("name") {
+			return c.Attachment(b.Path, b.Name)
+		}
+	}
+	return c.JSON(http.StatusNotFound, echo.Map{"error": "Backup not found"})
+}
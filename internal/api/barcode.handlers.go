@@ -5,7 +5,11 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"pos-printer/internal/config"
+	"pos-printer/internal/db"
+	"pos-printer/internal/label"
 	"pos-printer/internal/model"
+	"strconv"
 
 	"github.com/labstack/echo/v4"
 )
@@ -34,7 +38,11 @@ func (server *Server) printBarcodeHandler(c echo.Context) error {
 		)
 	}
 
-	if err := server.posPrinter.CheckPrinter(req.VID, req.PID); err != nil {
+	if !allowsPrinter(c, req.VID, req.PID) {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "API key may not use this printer"})
+	}
+
+	if err := server.printer.CheckPrinter(req.VID, req.PID); err != nil {
 		return c.JSON(
 			http.StatusBadRequest,
 			echo.Map{
@@ -46,11 +54,19 @@ func (server *Server) printBarcodeHandler(c echo.Context) error {
 		)
 	}
 
-	jobId, err := server.sqlite.EnqueueBarcodeJob(req)
+	if err := server.checkPrintLimits(c, &req); err != nil {
+		return printLimitResponse(c, err)
+	}
+
+	req.APIKeyID = apiKeyID(c)
+	req.RequestID = requestIDOf(c)
+	jobId, err := server.store.EnqueueBarcodeJob(req)
 
 	if err != nil {
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to enqueue job"})
 	}
+	requestLogger(c).Info("Enqueued job", "job_id", jobId, "printer", config.PrinterKey(req.VID, req.PID), "labels", req.PrintCount)
+	server.audit(c, model.AuditJobEnqueue, "job", jobId, config.PrinterKey(req.VID, req.PID), nil, req)
 
 	return c.JSON(http.StatusAccepted,
 		echo.Map{
@@ -63,7 +79,7 @@ func (server *Server) printBarcodeHandler(c echo.Context) error {
 func (server *Server) jobBarcodeHandler(c echo.Context) error {
 	id := c.Param("id")
 
-	job, err := server.sqlite.FetchBarcodeJob(id)
+	job, err := server.store.FetchBarcodeJob(id)
 
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -71,6 +87,140 @@ func (server *Server) jobBarcodeHandler(c echo.Context) error {
 		}
 		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error fetching job"})
 	}
+	// Jobs on printers the key may not use are hidden, not forbidden.
+	if !allowsPrinter(c, job.VID, job.PID) {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Job not found"})
+	}
 
 	return c.JSON(http.StatusOK, job)
 }
+
+func (server *Server) resolveBarcodeJobHandler(c echo.Context) error {
+	id := c.Param("id")
+
+	var req model.ResolveJobRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid JSON"})
+	}
+	if err := server.validateResolveRequest(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	job, err := server.store.FetchBarcodeJob(id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error fetching job"})
+	}
+	if err != nil || !allowsPrinter(c, job.VID, job.PID) {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Job not found"})
+	}
+
+	if err := server.store.ResolveBarcodeJob(id, req.Status); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "Job not found"})
+		}
+		if errors.Is(err, db.ErrJobNotUnknown) {
+			return c.JSON(http.StatusConflict, echo.Map{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to resolve job"})
+	}
+	server.audit(c, model.AuditJobResolve, "job", id, config.PrinterKey(job.VID, job.PID),
+		echo.Map{"status": job.Status}, echo.Map{"status": req.Status})
+
+	return c.JSON(http.StatusOK, echo.Map{"jobId": id, "status": req.Status})
+}
+
+func (server *Server) cancelBarcodeJobHandler(c echo.Context) error {
+	return server.moveBarcodeJobHandler(c, server.store.CancelBarcodeJob,
+		server.cfg.WorkerConfig.JobStatus.StatusCancelled, model.AuditJobCancel, "Failed to cancel job")
+}
+
+// retryBarcodeJobHandler queues a failed job again. It prints what is left
+// of the job, so it is not held to the print limits again.
+func (server *Server) retryBarcodeJobHandler(c echo.Context) error {
+	return server.moveBarcodeJobHandler(c, server.store.RetryBarcodeJob,
+		server.cfg.WorkerConfig.JobStatus.StatusPending, model.AuditJobRetry, "Failed to retry job")
+}
+
+// moveBarcodeJobHandler moves the job to status with move, answering 409
+// if the job is not in the status move expects.
+func (server *Server) moveBarcodeJobHandler(c echo.Context, move func(id string) error, status, action, failure string) error {
+	id := c.Param("id")
+
+	job, err := server.store.FetchBarcodeJob(id)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error fetching job"})
+	}
+	if err != nil || !allowsPrinter(c, job.VID, job.PID) {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Job not found"})
+	}
+
+	if err := move(id); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "Job not found"})
+		}
+		if errors.Is(err, db.ErrJobNotPending) || errors.Is(err, db.ErrJobNotFailed) {
+			return c.JSON(http.StatusConflict, echo.Map{"error": err.Error()})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": failure})
+	}
+	server.audit(c, action, "job", id, config.PrinterKey(job.VID, job.PID),
+		echo.Map{"status": job.Status}, echo.Map{"status": status})
+
+	return c.JSON(http.StatusOK, echo.Map{"jobId": id, "status": status})
+}
+
+func (server *Server) previewBarcodeHandler(c echo.Context) error {
+	var req model.PrintBarcodeRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(
+			http.StatusBadRequest,
+			echo.Map{
+				"error": "Invalid JSON",
+			},
+		)
+	}
+
+	server.applyDefaultsBarcodeHelper(&req)
+	if err := server.validateBarcodeRequest(&req); err != nil {
+		return c.JSON(http.StatusBadRequest,
+			echo.Map{
+				"error": err.Error(),
+			},
+		)
+	}
+
+	// A numbered run is previewed by its first label.
+	topText, barcodeData := req.TopText, req.BarcodeData
+	if req.Serial != nil {
+		topText = req.Serial.Expand(topText, 0)
+		barcodeData = req.Serial.Expand(barcodeData, 0)
+	}
+
+	// The layout depends on the resolution, so it is known first.
+	dpm := label.DefaultDotsPerMM
+	if dpi := c.QueryParam("dpi"); dpi != "" {
+		value, err := strconv.Atoi(dpi)
+		if err == nil {
+			err = server.validatePreviewDPI(value)
+		}
+		if err != nil {
+			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		}
+		dpm = dotsPerMM(value)
+	}
+
+	lbl := label.NewBarcodeLabel(
+		req.SizeX, req.SizeY,
+		req.Direction, topText,
+		barcodeData, req.PrintCount,
+		req.LabelGap.Length, req.LabelGap.Offset,
+		dpm,
+	)
+
+	img, err := label.Rasterize(lbl)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	return pngResponse(c, img)
+}
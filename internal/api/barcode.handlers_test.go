@@ -0,0 +1,331 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"pos-printer/internal/db"
+	"pos-printer/internal/model"
+	"testing"
+	"time"
+)
+
+const testSecret = "pp_test-secret"
+
+func TestPrintBarcodeHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		headers    []string
+		setup      func(*Server, *fakeStore, *fakePrinter)
+		wantStatus int
+		wantError  string // "" to expect the job to be enqueued
+	}{
+		{
+			name:       "enqueues a job",
+			body:       `{"barcodeData":"AX2B2CL21LL2","printCount":3}`,
+			wantStatus: http.StatusAccepted,
+		},
+		{
+			name:       "rejects invalid JSON",
+			body:       `{"barcodeData":`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "Invalid JSON",
+		},
+		{
+			name:       "rejects an invalid request",
+			body:       `{"barcodeData":" "}`,
+			wantStatus: http.StatusBadRequest,
+			wantError:  "barcodeData is required",
+		},
+		{
+			name: "rejects a missing printer",
+			body: `{"barcodeData":"AX2B2CL21LL2"}`,
+			setup: func(_ *Server, _ *fakeStore, p *fakePrinter) {
+				p.err = errors.New("device not found")
+			},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "Printer device not found, please check connected or not: device not found",
+		},
+		{
+			name: "rejects a printer the key may not use",
+			body: `{"barcodeData":"AX2B2CL21LL2"}`,
+			setup: func(_ *Server, s *fakeStore, _ *fakePrinter) {
+				s.addKey(testSecret, &model.APIKey{ID: 1, Scopes: []string{model.ScopePrint}, Printers: []string{"0x04b8:0x0202"}})
+			},
+			headers:    []string{"X-API-Key", testSecret},
+			wantStatus: http.StatusForbidden,
+			wantError:  "API key may not use this printer",
+		},
+		{
+			name: "rejects a full queue",
+			body: `{"barcodeData":"AX2B2CL21LL2"}`,
+			setup: func(server *Server, s *fakeStore, _ *fakePrinter) {
+				server.cfg.LimitsConfig.MaxQueuedJobs = 2
+				s.queued = 2
+			},
+			wantStatus: http.StatusTooManyRequests,
+			wantError:  "Printer queue is full with 2 jobs",
+		},
+		{
+			name: "reports a failed enqueue",
+			body: `{"barcodeData":"AX2B2CL21LL2"}`,
+			setup: func(_ *Server, s *fakeStore, _ *fakePrinter) {
+				s.enqueueErr = errors.New("disk full")
+			},
+			wantStatus: http.StatusInternalServerError,
+			wantError:  "Failed to enqueue job",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store, printer := newFakeStore(), &fakePrinter{}
+			server := NewServer(testConfig(), store, printer)
+			if tt.setup != nil {
+				tt.setup(server, store, printer)
+			}
+
+			rec := serve(t, server, http.MethodPost, "/barcode/print", tt.body, tt.headers...)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+
+			var resp map[string]any
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("response is not JSON: %v", err)
+			}
+			if tt.wantError != "" {
+				if resp["error"] != tt.wantError {
+					t.Errorf("error = %q, want %q", resp["error"], tt.wantError)
+				}
+				if len(store.enqueued) != 0 {
+					t.Errorf("enqueued %d jobs, want none", len(store.enqueued))
+				}
+				return
+			}
+
+			if resp["jobId"] != float64(1) || resp["status"] != "pending" {
+				t.Errorf("response = %v, want job 1 pending", resp)
+			}
+			if len(store.enqueued) != 1 {
+				t.Fatalf("enqueued %d jobs, want 1", len(store.enqueued))
+			}
+			req := store.enqueued[0]
+			if req.VID != "0x0fe6" || req.PID != "0x8800" || req.PrintCount != 3 {
+				t.Errorf("enqueued %+v, want the default printer and 3 labels", req)
+			}
+			if req.RequestID == "" || req.RequestID != rec.Header().Get("X-Request-ID") {
+				t.Errorf("job request ID = %q, want the response's %q", req.RequestID, rec.Header().Get("X-Request-ID"))
+			}
+			if len(store.audit) != 1 || store.audit[0].Action != model.AuditJobEnqueue {
+				t.Errorf("audit = %+v, want one %s entry", store.audit, model.AuditJobEnqueue)
+			}
+		})
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	tests := []struct {
+		name       string
+		required   bool
+		scopes     []string
+		headers    []string
+		wantStatus int
+	}{
+		{name: "open without authentication", wantStatus: http.StatusOK},
+		{name: "key required", required: true, wantStatus: http.StatusUnauthorized},
+		{name: "unknown key", headers: []string{"X-API-Key", "pp_unknown"}, wantStatus: http.StatusUnauthorized},
+		{
+			name: "key without the scope", required: true, scopes: []string{model.ScopePrint},
+			headers: []string{"Authorization", "Bearer " + testSecret}, wantStatus: http.StatusForbidden,
+		},
+		{
+			name: "key with the scope", required: true, scopes: []string{model.ScopeReadJobs},
+			headers: []string{"Authorization", "Bearer " + testSecret}, wantStatus: http.StatusOK,
+		},
+		{
+			name: "admin key", required: true, scopes: []string{model.ScopeAdmin},
+			headers: []string{"X-API-Key", testSecret}, wantStatus: http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore()
+			store.jobs["7"] = &model.BarcodeJob{ID: 7, VID: "0x0fe6", PID: "0x8800", Status: "done"}
+			store.addKey(testSecret, &model.APIKey{ID: 1, Scopes: tt.scopes})
+			cfg := testConfig()
+			cfg.AuthConfig.Required = tt.required
+			server := NewServer(cfg, store, &fakePrinter{})
+
+			rec := serve(t, server, http.MethodGet, "/barcode/job/7", "", tt.headers...)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d; body %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+func TestRequireScopeBootstrap(t *testing.T) {
+	revoked := time.Now()
+	tests := []struct {
+		name       string
+		noBoot     bool
+		key        *model.APIKey // stored before the request
+		remoteAddr string
+		headers    []string
+		wantStatus int
+	}{
+		{name: "loopback without keys", remoteAddr: "127.0.0.1:50000", wantStatus: http.StatusOK},
+		{name: "IPv6 loopback without keys", remoteAddr: "[::1]:50000", wantStatus: http.StatusOK},
+		{name: "LAN client", remoteAddr: "192.168.1.20:50000", wantStatus: http.StatusUnauthorized},
+		{
+			name: "forwarded by a local proxy", remoteAddr: "127.0.0.1:50000",
+			headers: []string{"X-Forwarded-For", "203.0.113.9"}, wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "unknown key is still checked", remoteAddr: "127.0.0.1:50000",
+			headers: []string{"X-API-Key", "pp_unknown"}, wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "after a key was created", key: &model.APIKey{ID: 1, Scopes: []string{model.ScopeAdmin}},
+			remoteAddr: "127.0.0.1:50000", wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "after every key was revoked", key: &model.APIKey{ID: 1, Scopes: []string{model.ScopeAdmin}, RevokedAt: &revoked},
+			remoteAddr: "127.0.0.1:50000", wantStatus: http.StatusUnauthorized,
+		},
+		{name: "bootstrap off", noBoot: true, remoteAddr: "127.0.0.1:50000", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore()
+			store.jobs["7"] = &model.BarcodeJob{ID: 7, VID: "0x0fe6", PID: "0x8800", Status: "done"}
+			if tt.key != nil {
+				store.addKey(testSecret, tt.key)
+			}
+			cfg := testConfig()
+			cfg.AuthConfig.Required = true
+			cfg.AuthConfig.Bootstrap = !tt.noBoot
+			server := NewServer(cfg, store, &fakePrinter{})
+
+			req := httptest.NewRequest(http.MethodGet, "/barcode/job/7", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for i := 0; i+1 < len(tt.headers); i += 2 {
+				req.Header.Set(tt.headers[i], tt.headers[i+1])
+			}
+			rec := httptest.NewRecorder()
+			server.echo.ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d; body %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
+
+func TestJobBarcodeHandler(t *testing.T) {
+	store := newFakeStore()
+	store.jobs["7"] = &model.BarcodeJob{ID: 7, VID: "0x0fe6", PID: "0x8800", Status: "done", PrintCount: 2}
+	server := NewServer(testConfig(), store, &fakePrinter{})
+
+	rec := serve(t, server, http.MethodGet, "/barcode/job/7", "")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, want 200; body %s", rec.Code, rec.Body)
+	}
+	var job model.BarcodeJob
+	if err := json.Unmarshal(rec.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	if job.ID != 7 || job.Status != "done" || job.PrintCount != 2 {
+		t.Errorf("job = %+v, want job 7 done with 2 labels", job)
+	}
+
+	if rec := serve(t, server, http.MethodGet, "/barcode/job/8", ""); rec.Code != http.StatusNotFound {
+		t.Errorf("missing job: status = %d, want 404", rec.Code)
+	}
+}
+
+func TestResolveBarcodeJobHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		id         string
+		body       string
+		resolveErr error
+		wantStatus int
+	}{
+		{name: "resolves an unknown job", id: "7", body: `{"status":"done"}`, wantStatus: http.StatusOK},
+		{name: "rejects another status", id: "7", body: `{"status":"printing"}`, wantStatus: http.StatusBadRequest},
+		{name: "rejects invalid JSON", id: "7", body: `{`, wantStatus: http.StatusBadRequest},
+		{name: "missing job", id: "8", body: `{"status":"done"}`, wantStatus: http.StatusNotFound},
+		{
+			name: "job not in unknown state", id: "7", body: `{"status":"done"}`,
+			resolveErr: db.ErrJobNotUnknown, wantStatus: http.StatusConflict,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore()
+			store.jobs["7"] = &model.BarcodeJob{ID: 7, VID: "0x0fe6", PID: "0x8800", Status: "unknown"}
+			store.resolveErr = tt.resolveErr
+			server := NewServer(testConfig(), store, &fakePrinter{})
+
+			rec := serve(t, server, http.MethodPost, "/barcode/job/"+tt.id+"/resolve", tt.body)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			resolved := tt.wantStatus == http.StatusOK
+			if got := store.jobs["7"].Status == "done"; got != resolved {
+				t.Errorf("job status = %q, resolved %v, want %v", store.jobs["7"].Status, got, resolved)
+			}
+			if got := len(store.audit) == 1; got != resolved {
+				t.Errorf("audit = %+v, want an entry only when resolved", store.audit)
+			}
+		})
+	}
+}
+
+func TestMoveBarcodeJobHandlers(t *testing.T) {
+	tests := []struct {
+		name       string
+		action     string
+		status     string // the job's status before the request
+		wantStatus int
+		wantJob    string // the job's status after the request
+	}{
+		{name: "cancels a pending job", action: "cancel", status: "pending", wantStatus: http.StatusOK, wantJob: "cancelled"},
+		{name: "cannot cancel a printing job", action: "cancel", status: "in_progress", wantStatus: http.StatusConflict, wantJob: "in_progress"},
+		{name: "retries a failed job", action: "retry", status: "failed", wantStatus: http.StatusOK, wantJob: "pending"},
+		{name: "cannot retry a finished job", action: "retry", status: "done", wantStatus: http.StatusConflict, wantJob: "done"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore()
+			store.jobs["7"] = &model.BarcodeJob{ID: 7, VID: "0x0fe6", PID: "0x8800", Status: tt.status}
+			server := NewServer(testConfig(), store, &fakePrinter{})
+
+			rec := serve(t, server, http.MethodPost, "/barcode/job/7/"+tt.action, "")
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if got := store.jobs["7"].Status; got != tt.wantJob {
+				t.Errorf("job status = %q, want %q", got, tt.wantJob)
+			}
+			moved := tt.wantStatus == http.StatusOK
+			if got := len(store.audit) == 1; got != moved {
+				t.Fatalf("audit = %+v, want an entry only when moved", store.audit)
+			}
+			if moved && store.audit[0].Action != "job."+tt.action {
+				t.Errorf("audit action = %q, want job.%s", store.audit[0].Action, tt.action)
+			}
+
+			if rec := serve(t, server, http.MethodPost, "/barcode/job/8/"+tt.action, ""); rec.Code != http.StatusNotFound {
+				t.Errorf("missing job: status = %d, want 404", rec.Code)
+			}
+		})
+	}
+}
@@ -29,4 +29,7 @@ func (server *Server) applyDefaultsBarcodeHelper(req *model.PrintBarcodeRequest)
 	if req.LabelGap.Offset == 0 {
 		req.LabelGap.Offset = 0
 	}
+	if req.Serial != nil && req.Serial.Step == 0 {
+		req.Serial.Step = 1
+	}
 }
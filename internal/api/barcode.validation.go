@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"pos-printer/internal/model"
 	"strings"
+	"time"
 )
 
 func (server *Server) validateBarcodeRequest(req *model.PrintBarcodeRequest) error {
@@ -16,7 +17,10 @@ func (server *Server) validateBarcodeRequest(req *model.PrintBarcodeRequest) err
 	if strings.TrimSpace(req.BarcodeData) == "" {
 		return errors.New("barcodeData is required")
 	}
-	if len(req.BarcodeData) > printerConfig.MaxBarcodeDataLength {
+	if err := server.validateSerial(req); err != nil {
+		return err
+	}
+	if len(server.longestBarcodeData(req)) > printerConfig.MaxBarcodeDataLength {
 		return fmt.Errorf(
 			"barcodeData must not exceed %d chars",
 			printerConfig.MaxBarcodeDataLength,
@@ -57,7 +61,7 @@ func (server *Server) validateBarcodeRequest(req *model.PrintBarcodeRequest) err
 	}
 
 	// top text length
-	if len(req.TopText) > printerConfig.MaxTopTextLength {
+	if len(server.longestTopText(req)) > printerConfig.MaxTopTextLength {
 		return fmt.Errorf(
 			"topText must not exceed %d characters",
 			printerConfig.MaxTopTextLength,
@@ -78,5 +82,102 @@ func (server *Server) validateBarcodeRequest(req *model.PrintBarcodeRequest) err
 			barcodeConfig.MinGapOffsetMM, barcodeConfig.MaxGapOffsetMM)
 	}
 
+	// schedule
+	if req.NotBefore != nil && time.Until(*req.NotBefore) > barcodeConfig.MaxScheduleAhead {
+		return fmt.Errorf(
+			"notBefore must be within %d days",
+			int(barcodeConfig.MaxScheduleAhead.Hours()/24),
+		)
+	}
+
+	// priority
+	if req.Priority < barcodeConfig.MinPriority || req.Priority > barcodeConfig.MaxPriority {
+		return fmt.Errorf(
+			"priority must be between %d and %d",
+			barcodeConfig.MinPriority,
+			barcodeConfig.MaxPriority,
+		)
+	}
+
+	return nil
+}
+
+func (server *Server) validatePreviewDPI(dpi int) error {
+	barcodeConfig := server.cfg.PrinterConfig.BarcodeConfig
+	if dpi < barcodeConfig.MinDPI || dpi > barcodeConfig.MaxDPI {
+		return fmt.Errorf(
+			"dpi must be between %d and %d",
+			barcodeConfig.MinDPI,
+			barcodeConfig.MaxDPI,
+		)
+	}
 	return nil
 }
+
+func (server *Server) validateResolveRequest(req *model.ResolveJobRequest) error {
+	status := server.cfg.WorkerConfig.JobStatus
+	switch req.Status {
+	case status.StatusPending, status.StatusDone, status.StatusFailed:
+		return nil
+	}
+	return fmt.Errorf(
+		"status must be %s, %s or %s",
+		status.StatusPending, status.StatusDone, status.StatusFailed,
+	)
+}
+
+func (server *Server) validateSerial(req *model.PrintBarcodeRequest) error {
+	serial := req.Serial
+	if serial == nil {
+		return nil
+	}
+	barcodeConfig := server.cfg.PrinterConfig.BarcodeConfig
+
+	if !strings.Contains(req.BarcodeData, model.SerialPlaceholder) &&
+		!strings.Contains(req.TopText, model.SerialPlaceholder) {
+		return fmt.Errorf("serial requires %s in barcodeData or topText", model.SerialPlaceholder)
+	}
+	if serial.Start < 0 {
+		return errors.New("serial.start must not be negative")
+	}
+	if serial.Value(req.PrintCount-1) < 0 {
+		return errors.New("serial must not count below 0")
+	}
+	if serial.Width < 0 || serial.Width > barcodeConfig.MaxSerialWidth {
+		return fmt.Errorf("serial.width must be between 0 and %d", barcodeConfig.MaxSerialWidth)
+	}
+	if len(serial.Prefix) > barcodeConfig.MaxSerialAffix || len(serial.Suffix) > barcodeConfig.MaxSerialAffix {
+		return fmt.Errorf("serial.prefix and serial.suffix must not exceed %d chars", barcodeConfig.MaxSerialAffix)
+	}
+	switch serial.CheckDigit {
+	case "", model.CheckDigitLuhn, model.CheckDigitGS1:
+	default:
+		return fmt.Errorf(
+			"serial.checkDigit must be %s or %s",
+			model.CheckDigitLuhn, model.CheckDigitGS1,
+		)
+	}
+	return nil
+}
+
+// longestBarcodeData returns the barcode data of the label with the most
+// digits in its serial number, which is the first or the last.
+func (server *Server) longestBarcodeData(req *model.PrintBarcodeRequest) string {
+	return longestExpansion(req, req.BarcodeData)
+}
+
+func (server *Server) longestTopText(req *model.PrintBarcodeRequest) string {
+	return longestExpansion(req, req.TopText)
+}
+
+func longestExpansion(req *model.PrintBarcodeRequest, text string) string {
+	if req.Serial == nil {
+		return text
+	}
+	first := req.Serial.Expand(text, 0)
+	last := req.Serial.Expand(text, req.PrintCount-1)
+	if len(last) > len(first) {
+		return last
+	}
+	return first
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"pos-printer/internal/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateBarcodeRequest(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*model.PrintBarcodeRequest)
+		wantErr string // "" for a valid request
+	}{
+		{name: "defaults are valid", modify: func(*model.PrintBarcodeRequest) {}},
+		{name: "blank barcode data", modify: func(r *model.PrintBarcodeRequest) { r.BarcodeData = "  " }, wantErr: "barcodeData is required"},
+		{name: "long barcode data", modify: func(r *model.PrintBarcodeRequest) { r.BarcodeData = strings.Repeat("1", 1000) }, wantErr: "barcodeData must not exceed"},
+		{name: "narrow label", modify: func(r *model.PrintBarcodeRequest) { r.SizeX = 1 }, wantErr: "sizeX must be between"},
+		{name: "tall label", modify: func(r *model.PrintBarcodeRequest) { r.SizeY = 1000 }, wantErr: "sizeY must be between"},
+		{name: "bad direction", modify: func(r *model.PrintBarcodeRequest) { r.Direction = 2 }, wantErr: "direction must be 0 or 1"},
+		{name: "no labels", modify: func(r *model.PrintBarcodeRequest) { r.PrintCount = 0 }, wantErr: "printCount must be between 1 and"},
+		{name: "long top text", modify: func(r *model.PrintBarcodeRequest) { r.TopText = strings.Repeat("x", 1000) }, wantErr: "topText must not exceed"},
+		{name: "auto-detected gap", modify: func(r *model.PrintBarcodeRequest) { r.LabelGap.Length = 0 }},
+		{name: "negative gap", modify: func(r *model.PrintBarcodeRequest) { r.LabelGap.Length = -1 }, wantErr: "labelGap.length must be between"},
+		{name: "gap offset", modify: func(r *model.PrintBarcodeRequest) { r.LabelGap.Offset = 1000 }, wantErr: "labelGap.offset must be between"},
+		{
+			name: "far schedule",
+			modify: func(r *model.PrintBarcodeRequest) {
+				at := time.Now().AddDate(10, 0, 0)
+				r.NotBefore = &at
+			},
+			wantErr: "notBefore must be within",
+		},
+		{name: "priority", modify: func(r *model.PrintBarcodeRequest) { r.Priority = 1000 }, wantErr: "priority must be between"},
+		{
+			name: "serial",
+			modify: func(r *model.PrintBarcodeRequest) {
+				r.BarcodeData = "A{serial}"
+				r.Serial = &model.Serial{Start: 1, Step: 1, Width: 4}
+			},
+		},
+		{
+			name:    "serial without placeholder",
+			modify:  func(r *model.PrintBarcodeRequest) { r.Serial = &model.Serial{Start: 1} },
+			wantErr: "serial requires {serial}",
+		},
+		{
+			name: "serial below zero",
+			modify: func(r *model.PrintBarcodeRequest) {
+				r.BarcodeData, r.PrintCount = "{serial}", 3
+				r.Serial = &model.Serial{Start: 1, Step: -1}
+			},
+			wantErr: "serial must not count below 0",
+		},
+		{
+			name: "serial check digit",
+			modify: func(r *model.PrintBarcodeRequest) {
+				r.BarcodeData = "{serial}"
+				r.Serial = &model.Serial{Start: 1, CheckDigit: "crc"}
+			},
+			wantErr: "serial.checkDigit must be",
+		},
+	}
+
+	server := NewServer(testConfig(), newFakeStore(), &fakePrinter{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := model.PrintBarcodeRequest{BarcodeData: "AX2B2CL21LL2"}
+			server.applyDefaultsBarcodeHelper(&req)
+			tt.modify(&req)
+
+			err := server.validateBarcodeRequest(&req)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Errorf("no error, want %q", tt.wantErr)
+			case tt.wantErr != "" && !strings.HasPrefix(err.Error(), tt.wantErr):
+				t.Errorf("error = %q, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateResolveRequest(t *testing.T) {
+	server := NewServer(testConfig(), newFakeStore(), &fakePrinter{})
+	for status, valid := range map[string]bool{
+		"pending": true, "done": true, "failed": true,
+		"unknown": false, "in_progress": false, "": false,
+	} {
+		err := server.validateResolveRequest(&model.ResolveJobRequest{Status: status})
+		if (err == nil) != valid {
+			t.Errorf("status %q: error = %v, want valid %v", status, err, valid)
+		}
+	}
+}
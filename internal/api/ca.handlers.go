@@ -0,0 +1,18 @@
+package api
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+// caCertHandler serves the local CA's root certificate, so it can be
+// installed on clients from a browser. It is public, like any CA
+// certificate.
+func (server *Server) caCertHandler(c echo.Context) error {
+	if server.localCA == nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "The server certificate is not issued by the local CA"})
+	}
+	c.Response().Header().Set(echo.HeaderContentDisposition, `attachment; filename="pos-printer-ca.pem"`)
+	return c.Blob(http.StatusOK, "application/x-pem-file", server.localCA.RootPEM())
+}
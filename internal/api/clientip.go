@@ -0,0 +1,53 @@
+package api
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+)
+
+// clientIPExtractor returns how c.RealIP finds the client's address, which
+// rate limits, audit entries and the request log use. Without trusted
+// proxies it is the connection's address; X-Forwarded-For and X-Real-IP
+// are ignored, as any client can send them. With trusted proxies, the
+// nearest X-Forwarded-For address that is not one of them is used.
+func clientIPExtractor(trustedProxies []string) (echo.IPExtractor, error) {
+	if len(trustedProxies) == 0 {
+		return echo.ExtractIPDirect(), nil
+	}
+	options := []echo.TrustOption{
+		echo.TrustLoopback(false),
+		echo.TrustLinkLocal(false),
+		echo.TrustPrivateNet(false),
+	}
+	for _, proxy := range trustedProxies {
+		ipRange, err := parseIPRange(proxy)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, echo.TrustIPRange(ipRange))
+	}
+	return echo.ExtractIPFromXFFHeader(options...), nil
+}
+
+// parseIPRange parses a CIDR range, or a single address as a range
+// holding only it.
+func parseIPRange(s string) (*net.IPNet, error) {
+	if strings.Contains(s, "/") {
+		_, ipRange, err := net.ParseCIDR(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q, must be an IP address or CIDR range", s)
+		}
+		return ipRange, nil
+	}
+	ip := net.ParseIP(s)
+	if ip == nil {
+		return nil, fmt.Errorf("invalid trusted proxy %q, must be an IP address or CIDR range", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}, nil
+}
@@ -0,0 +1,64 @@
+package api
+
+import (
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// Private Network Access headers. Chrome sends a preflight with the request
+// header before a public page may call a service on localhost or the LAN,
+// such as a web POS calling https://localhost:5000.
+const (
+	headerRequestPrivateNetwork = "Access-Control-Request-Private-Network"
+	headerAllowPrivateNetwork   = "Access-Control-Allow-Private-Network"
+)
+
+// cors allows the configured origins to call the API from a browser and
+// answers Private Network Access preflights from them.
+func (server *Server) cors() echo.MiddlewareFunc {
+	cfg := server.cfg.ServerConfig.CORS
+	allowed := func(origin string) (bool, error) {
+		return originAllowed(cfg.AllowOrigins, origin), nil
+	}
+	cors := middleware.CORSWithConfig(middleware.CORSConfig{
+		AllowOriginFunc: allowed,
+		AllowMethods:    cfg.AllowMethods,
+		AllowHeaders:    cfg.AllowHeaders,
+		MaxAge:          int(cfg.MaxAge.Seconds()),
+	})
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		handler := cors(next)
+		return func(c echo.Context) error {
+			req := c.Request()
+			if cfg.PrivateNetwork && req.Method == http.MethodOptions &&
+				strings.EqualFold(req.Header.Get(headerRequestPrivateNetwork), "true") &&
+				originAllowed(cfg.AllowOrigins, req.Header.Get(echo.HeaderOrigin)) {
+				c.Response().Header().Set(headerAllowPrivateNetwork, "true")
+			}
+			return handler(c)
+		}
+	}
+}
+
+// originAllowed reports whether origin matches one of patterns: an exact
+// origin, one with wildcards such as "https://*.example.com", or "*".
+func originAllowed(patterns []string, origin string) bool {
+	if origin == "" {
+		return false
+	}
+	origin = strings.ToLower(origin)
+	for _, p := range patterns {
+		if p == "*" {
+			return true
+		}
+		if ok, _ := path.Match(strings.ToLower(strings.TrimSuffix(p, "/")), origin); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,134 @@
+package api
+
+import (
+	"net/http"
+	"pos-printer/internal/model"
+	"testing"
+
+	"github.com/labstack/echo/v4"
+)
+
+func TestOriginAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		origin   string
+		want     bool
+	}{
+		{name: "exact", patterns: []string{"https://pos.example.com"}, origin: "https://pos.example.com", want: true},
+		{name: "case-insensitive", patterns: []string{"https://POS.example.com"}, origin: "https://pos.EXAMPLE.com", want: true},
+		{name: "pattern with trailing slash", patterns: []string{"https://pos.example.com/"}, origin: "https://pos.example.com", want: true},
+		{name: "other scheme", patterns: []string{"https://pos.example.com"}, origin: "http://pos.example.com"},
+		{name: "other port", patterns: []string{"https://pos.example.com"}, origin: "https://pos.example.com:8443"},
+		{name: "any", patterns: []string{"*"}, origin: "https://anything.test", want: true},
+		{name: "no origin", patterns: []string{"*"}, origin: ""},
+		{name: "no patterns", origin: "https://pos.example.com"},
+		{name: "second pattern", patterns: []string{"https://a.test", "https://b.test"}, origin: "https://b.test", want: true},
+
+		{name: "subdomain wildcard", patterns: []string{"https://*.example.com"}, origin: "https://pos.example.com", want: true},
+		{name: "wildcard spans levels", patterns: []string{"https://*.example.com"}, origin: "https://a.b.example.com", want: true},
+		{name: "wildcard needs a subdomain", patterns: []string{"https://*.example.com"}, origin: "https://example.com"},
+		{name: "wildcard needs the dot", patterns: []string{"https://*.example.com"}, origin: "https://evilexample.com"},
+		{name: "wildcard suffix must end the origin", patterns: []string{"https://*.example.com"}, origin: "https://pos.example.com.evil.test"},
+		{name: "wildcard with a port", patterns: []string{"https://*.example.com"}, origin: "https://pos.example.com:8443"},
+		{name: "wildcard port", patterns: []string{"http://localhost:*"}, origin: "http://localhost:3000", want: true},
+		{name: "wildcard does not cross a slash", patterns: []string{"https://*"}, origin: "https://evil.test/x"},
+		{name: "single character", patterns: []string{"https://pos?.example.com"}, origin: "https://pos2.example.com", want: true},
+		{name: "malformed pattern", patterns: []string{"https://[.example.com"}, origin: "https://[.example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := originAllowed(tt.patterns, tt.origin); got != tt.want {
+				t.Errorf("originAllowed(%q, %q) = %v, want %v", tt.patterns, tt.origin, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCORSPreflight(t *testing.T) {
+	tests := []struct {
+		name             string
+		privateNetwork   bool
+		origin           string
+		requestPrivate   string // Access-Control-Request-Private-Network
+		wantAllowOrigin  bool
+		wantAllowPrivate bool
+	}{
+		{name: "allowed origin", privateNetwork: true, origin: "https://pos.example.com", wantAllowOrigin: true},
+		{
+			name: "private network request", privateNetwork: true, origin: "https://pos.example.com", requestPrivate: "true",
+			wantAllowOrigin: true, wantAllowPrivate: true,
+		},
+		{
+			name: "private network request in another case", privateNetwork: true, origin: "https://pos.example.com", requestPrivate: "TRUE",
+			wantAllowOrigin: true, wantAllowPrivate: true,
+		},
+		{name: "private network off", origin: "https://pos.example.com", requestPrivate: "true", wantAllowOrigin: true},
+		{name: "other origin", privateNetwork: true, origin: "https://evil.test", requestPrivate: "true"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.ServerConfig.CORS.AllowOrigins = []string{"https://pos.example.com"}
+			cfg.ServerConfig.CORS.PrivateNetwork = tt.privateNetwork
+			server := NewServer(cfg, newFakeStore(), &fakePrinter{})
+
+			headers := []string{echo.HeaderOrigin, tt.origin, echo.HeaderAccessControlRequestMethod, http.MethodPost}
+			if tt.requestPrivate != "" {
+				headers = append(headers, headerRequestPrivateNetwork, tt.requestPrivate)
+			}
+			rec := serve(t, server, http.MethodOptions, "/barcode/print", "", headers...)
+
+			allowOrigin := rec.Header().Get(echo.HeaderAccessControlAllowOrigin)
+			if got := allowOrigin == tt.origin; got != tt.wantAllowOrigin {
+				t.Errorf("%s = %q, want it set: %v", echo.HeaderAccessControlAllowOrigin, allowOrigin, tt.wantAllowOrigin)
+			}
+			allowPrivate := rec.Header().Get(headerAllowPrivateNetwork)
+			if got := allowPrivate == "true"; got != tt.wantAllowPrivate {
+				t.Errorf("%s = %q, want it set: %v", headerAllowPrivateNetwork, allowPrivate, tt.wantAllowPrivate)
+			}
+		})
+	}
+}
+
+func TestAPIKeyOrigins(t *testing.T) {
+	tests := []struct {
+		name       string
+		origins    []string
+		origin     string
+		wantStatus int
+	}{
+		{name: "unrestricted key", origin: "https://evil.test", wantStatus: http.StatusOK},
+		{name: "allowed origin", origins: []string{"https://pos.example.com"}, origin: "https://pos.example.com", wantStatus: http.StatusOK},
+		{name: "allowed by wildcard", origins: []string{"https://*.example.com"}, origin: "https://till2.example.com", wantStatus: http.StatusOK},
+		{name: "other origin", origins: []string{"https://pos.example.com"}, origin: "https://evil.test", wantStatus: http.StatusForbidden},
+		{name: "parent of a wildcard", origins: []string{"https://*.example.com"}, origin: "https://example.com", wantStatus: http.StatusForbidden},
+		// Clients other than browsers send no origin and are not restricted.
+		{name: "no origin", origins: []string{"https://pos.example.com"}, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore()
+			store.jobs["7"] = &model.BarcodeJob{ID: 7, VID: "0x0fe6", PID: "0x8800", Status: "done"}
+			store.addKey(testSecret, &model.APIKey{ID: 1, Scopes: []string{model.ScopeReadJobs}, Origins: tt.origins})
+			cfg := testConfig()
+			cfg.AuthConfig.Required = true
+			// The server-wide list lets every origin through, so only the
+			// key restricts them.
+			cfg.ServerConfig.CORS.AllowOrigins = []string{"*"}
+			server := NewServer(cfg, store, &fakePrinter{})
+
+			headers := []string{"Authorization", "Bearer " + testSecret}
+			if tt.origin != "" {
+				headers = append(headers, echo.HeaderOrigin, tt.origin)
+			}
+			rec := serve(t, server, http.MethodGet, "/barcode/job/7", "", headers...)
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d; body %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package api
+
+import (
+	"database/sql"
+	"io"
+	"net/http/httptest"
+	"pos-printer/internal/config"
+	"pos-printer/internal/db"
+	"pos-printer/internal/model"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeStore is an in-memory Store holding jobs by id and keys by hash.
+// What it does not hold, it reports as sql.ErrNoRows.
+type fakeStore struct {
+	mu         sync.Mutex
+	jobs       map[string]*model.BarcodeJob
+	keys       map[string]*model.APIKey
+	certKeys   map[string]*model.APIKey // by client certificate common name
+	enqueued   []model.PrintBarcodeRequest
+	queued     int   // what QueuedBarcodeJobs reports for every printer
+	enqueueErr error // returned by EnqueueBarcodeJob
+	resolveErr error // returned by ResolveBarcodeJob
+	audit      []*model.AuditEntry
+}
+
+func newFakeStore() *fakeStore {
+	return &fakeStore{
+		jobs:     map[string]*model.BarcodeJob{},
+		keys:     map[string]*model.APIKey{},
+		certKeys: map[string]*model.APIKey{},
+	}
+}
+
+// addKey stores key under the secret it is sent with.
+func (s *fakeStore) addKey(secret string, key *model.APIKey) {
+	s.keys[model.HashAPIKey(secret)] = key
+}
+
+func (s *fakeStore) EnqueueBarcodeJob(req model.PrintBarcodeRequest) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.enqueueErr != nil {
+		return 0, s.enqueueErr
+	}
+	s.enqueued = append(s.enqueued, req)
+	return int64(len(s.enqueued)), nil
+}
+
+func (s *fakeStore) FetchBarcodeJob(id string) (*model.BarcodeJob, error) {
+	if job, ok := s.jobs[id]; ok {
+		return job, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *fakeStore) ResolveBarcodeJob(id string, status string) error {
+	if s.resolveErr != nil {
+		return s.resolveErr
+	}
+	job, ok := s.jobs[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	job.Status = status
+	return nil
+}
+
+func (s *fakeStore) CancelBarcodeJob(id string) error {
+	return s.moveJob(id, "pending", "cancelled", db.ErrJobNotPending)
+}
+
+func (s *fakeStore) RetryBarcodeJob(id string) error {
+	return s.moveJob(id, "failed", "pending", db.ErrJobNotFailed)
+}
+
+func (s *fakeStore) moveJob(id, from, to string, errWrongStatus error) error {
+	job, ok := s.jobs[id]
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if job.Status != from {
+		return errWrongStatus
+	}
+	job.Status = to
+	return nil
+}
+
+func (s *fakeStore) KeyLabelsSince(apiKeyID int64, since time.Time) (int, error) { return 0, nil }
+
+func (s *fakeStore) PrinterLabelsSince(printerKey string, since time.Time) (int, error) {
+	return 0, nil
+}
+
+func (s *fakeStore) QueuedBarcodeJobs(printerKey string) (int, error) { return s.queued, nil }
+
+func (s *fakeStore) CreateBarcodeSchedule(sched *model.BarcodeSchedule) (int64, error) {
+	return 0, nil
+}
+
+func (s *fakeStore) UpdateBarcodeSchedule(sched *model.BarcodeSchedule) error { return nil }
+func (s *fakeStore) DeleteBarcodeSchedule(id string) error                    { return sql.ErrNoRows }
+
+func (s *fakeStore) FetchBarcodeSchedule(id string) (*model.BarcodeSchedule, error) {
+	return nil, sql.ErrNoRows
+}
+
+func (s *fakeStore) ListBarcodeSchedules() ([]*model.BarcodeSchedule, error) { return nil, nil }
+func (s *fakeStore) CreateBackup() (*model.Backup, error)                    { return nil, nil }
+
+func (s *fakeStore) CreateAPIKey(key *model.APIKey, hash string) (int64, error) {
+	return 0, nil
+}
+
+func (s *fakeStore) FetchAPIKey(id string) (*model.APIKey, error) { return nil, sql.ErrNoRows }
+
+func (s *fakeStore) FetchAPIKeyByHash(hash string) (*model.APIKey, error) {
+	if key, ok := s.keys[hash]; ok && key.RevokedAt == nil {
+		return key, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *fakeStore) FetchAPIKeyByClientCert(cn string) (*model.APIKey, error) {
+	if key, ok := s.certKeys[cn]; ok && key.RevokedAt == nil {
+		return key, nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *fakeStore) ListAPIKeys() ([]*model.APIKey, error) {
+	var keys []*model.APIKey
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	for _, key := range s.certKeys {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *fakeStore) RevokeAPIKey(id string) error { return sql.ErrNoRows }
+func (s *fakeStore) TouchAPIKey(id int64) error   { return nil }
+
+func (s *fakeStore) AppendAuditEntry(e *model.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audit = append(s.audit, e)
+	return nil
+}
+
+func (s *fakeStore) ListAuditEntries(f model.AuditFilter) ([]*model.AuditEntry, error) {
+	return s.audit, nil
+}
+
+// fakePrinter reports every printer as connected, unless err is set.
+type fakePrinter struct {
+	err error
+}
+
+func (p *fakePrinter) CheckPrinter(vidHexStr, pidHexStr string) error { return p.err }
+
+// testConfig returns the default configuration without limits, whatever
+// the environment of the test run sets.
+func testConfig() *config.Config {
+	cfg, err := config.Load()
+	if err != nil {
+		panic(err)
+	}
+	cfg.AuthConfig.Required = false
+	cfg.LimitsConfig = config.LimitsConfig{}
+	return cfg
+}
+
+// serve sends a request to the server and returns the recorded response.
+// headers are name, value pairs.
+func serve(t *testing.T, server *Server, method, target, body string, headers ...string) *httptest.ResponseRecorder {
+	t.Helper()
+	var r io.Reader
+	if body != "" {
+		r = strings.NewReader(body)
+	}
+	req := httptest.NewRequest(method, target, r)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.Header.Set(headers[i], headers[i+1])
+	}
+	rec := httptest.NewRecorder()
+	server.echo.ServeHTTP(rec, req)
+	return rec
+}
@@ -0,0 +1,151 @@
+package api
+
+import (
+	"errors"
+	"math"
+	"net"
+	"net/http"
+	"pos-printer/internal/job"
+	"pos-printer/internal/model"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// maxBuckets bounds the clients the rate limiter tracks at once, so
+// requests from ever new addresses cannot grow it without limit.
+const maxBuckets = 10000
+
+// rateLimiter keeps a token bucket per client. Each request takes a
+// token; tokens refill at rate per second up to burst.
+type rateLimiter struct {
+	rate  float64
+	burst float64
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	sweptAt time.Time
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+func newRateLimiter(perMinute, burst int) *rateLimiter {
+	return &rateLimiter{
+		rate:    float64(perMinute) / 60,
+		burst:   math.Max(float64(burst), 1),
+		buckets: map[string]*bucket{},
+	}
+}
+
+// take spends a token of the client's bucket. If there is none, it
+// returns false and how long until there is.
+func (l *rateLimiter) take(client string, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.sweep(now, false)
+	b := l.buckets[client]
+	if b == nil {
+		if len(l.buckets) >= maxBuckets {
+			l.sweep(now, true)
+			if len(l.buckets) >= maxBuckets {
+				l.evictOldest()
+			}
+		}
+		b = &bucket{tokens: l.burst}
+		l.buckets[client] = b
+	} else {
+		b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updatedAt).Seconds()*l.rate)
+	}
+	b.updatedAt = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// sweep forgets buckets that have refilled, as a new bucket starts full,
+// at most once a minute unless forced. The caller holds mu.
+func (l *rateLimiter) sweep(now time.Time, force bool) {
+	if !force && now.Sub(l.sweptAt) < time.Minute {
+		return
+	}
+	l.sweptAt = now
+	refill := time.Duration(l.burst / l.rate * float64(time.Second))
+	for client, b := range l.buckets {
+		if now.Sub(b.updatedAt) >= refill {
+			delete(l.buckets, client)
+		}
+	}
+}
+
+// evictOldest forgets the bucket that was used longest ago, to make room
+// when every tracked client is still limited. The caller holds mu.
+func (l *rateLimiter) evictOldest() {
+	var oldest string
+	var oldestAt time.Time
+	for client, b := range l.buckets {
+		if oldest == "" || b.updatedAt.Before(oldestAt) {
+			oldest, oldestAt = client, b.updatedAt
+		}
+	}
+	delete(l.buckets, oldest)
+}
+
+// rateLimit limits requests per API key, or per client IP for requests
+// without one. It runs after requireScope, which identifies the key.
+func (server *Server) rateLimit(next echo.HandlerFunc) echo.HandlerFunc {
+	if server.limiter == nil {
+		return next
+	}
+	return func(c echo.Context) error {
+		client := "ip:" + clientNetwork(c.RealIP())
+		if id := apiKeyID(c); id != nil {
+			client = "key:" + strconv.FormatInt(*id, 10)
+		}
+		if ok, wait := server.limiter.take(client, time.Now()); !ok {
+			return tooManyRequests(c, wait, "Rate limit exceeded")
+		}
+		return next(c)
+	}
+}
+
+// checkPrintLimits returns a *job.LimitError if enqueuing req would
+// overfill the printer's queue or exceed a daily label quota.
+func (server *Server) checkPrintLimits(c echo.Context, req *model.PrintBarcodeRequest) error {
+	return job.CheckPrintLimits(server.store, server.cfg.LimitsConfig, apiKey(c), req)
+}
+
+// printLimitResponse answers a request that checkPrintLimits stopped.
+func printLimitResponse(c echo.Context, err error) error {
+	var limitErr *job.LimitError
+	if errors.As(err, &limitErr) {
+		return tooManyRequests(c, limitErr.RetryAfter, limitErr.Message)
+	}
+	requestLogger(c).Error("Error checking print limits", "error", err)
+	return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error checking print limits"})
+}
+
+// tooManyRequests answers 429 with Retry-After in whole seconds.
+func tooManyRequests(c echo.Context, retryAfter time.Duration, message string) error {
+	seconds := max(1, int(math.Ceil(retryAfter.Seconds())))
+	c.Response().Header().Set(echo.HeaderRetryAfter, strconv.Itoa(seconds))
+	return c.JSON(http.StatusTooManyRequests, echo.Map{"error": message})
+}
+
+// clientNetwork returns the address rate limits apply to: the IP, or for
+// IPv6, its /64, which a single host can draw addresses from at will.
+func clientNetwork(ip string) string {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.To4() != nil {
+		return ip
+	}
+	return parsed.Mask(net.CIDRMask(64, 128)).String() + "/64"
+}
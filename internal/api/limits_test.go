@@ -0,0 +1,83 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimitClientIP(t *testing.T) {
+	// httptest requests come from 192.0.2.1.
+	tests := []struct {
+		name           string
+		trustedProxies []string
+		wantLimited    bool // whether the second request, with another X-Forwarded-For, is limited
+	}{
+		{name: "forwarded headers are ignored without trusted proxies", wantLimited: true},
+		{name: "a trusted proxy forwards the client", trustedProxies: []string{"192.0.2.0/24"}},
+		{name: "an untrusted proxy is the client", trustedProxies: []string{"198.51.100.7"}, wantLimited: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.LimitsConfig.RatePerMinute, cfg.LimitsConfig.RateBurst = 1, 1
+			server := NewServer(cfg, newFakeStore(), &fakePrinter{})
+			extractor, err := clientIPExtractor(tt.trustedProxies)
+			if err != nil {
+				t.Fatal(err)
+			}
+			server.echo.IPExtractor = extractor
+
+			body := `{"barcodeData":"AX2B2CL21LL2"}`
+			first := serve(t, server, http.MethodPost, "/barcode/print", body,
+				"X-Forwarded-For", "203.0.113.1", "X-Real-IP", "203.0.113.1")
+			if first.Code != http.StatusAccepted {
+				t.Fatalf("first request: status = %d, want 202", first.Code)
+			}
+			second := serve(t, server, http.MethodPost, "/barcode/print", body,
+				"X-Forwarded-For", "203.0.113.2", "X-Real-IP", "203.0.113.2")
+			if limited := second.Code == http.StatusTooManyRequests; limited != tt.wantLimited {
+				t.Errorf("second request: status = %d, want limited %v", second.Code, tt.wantLimited)
+			}
+		})
+	}
+}
+
+func TestClientIPExtractorRejectsInvalidProxies(t *testing.T) {
+	for _, proxy := range []string{"proxy.local", "10.0.0.0/33", ""} {
+		if _, err := clientIPExtractor([]string{proxy}); err == nil {
+			t.Errorf("trusted proxy %q accepted", proxy)
+		}
+	}
+}
+
+func TestRateLimiterBucketsAreBounded(t *testing.T) {
+	l := newRateLimiter(1, 1)
+	now := time.Now()
+	for i := 0; i < maxBuckets+100; i++ {
+		l.take("ip:"+strconv.Itoa(i), now)
+	}
+	if n := len(l.buckets); n > maxBuckets {
+		t.Errorf("%d buckets, want at most %d", n, maxBuckets)
+	}
+	// The newest client keeps its bucket and is limited.
+	if ok, _ := l.take("ip:"+strconv.Itoa(maxBuckets+99), now); ok {
+		t.Error("newest client was not limited")
+	}
+}
+
+func TestClientNetwork(t *testing.T) {
+	for ip, want := range map[string]string{
+		"192.0.2.1":            "192.0.2.1",
+		"2001:db8:1:2:3:4:5:6": "2001:db8:1:2::/64",
+		"2001:db8:1:2:ffff::1": "2001:db8:1:2::/64",
+		"":                     "",
+		"::ffff:192.0.2.1":     "::ffff:192.0.2.1",
+	} {
+		if got := clientNetwork(ip); got != want {
+			t.Errorf("clientNetwork(%q) = %q, want %q", ip, got, want)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package api
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/user"
+	"pos-printer/internal/config"
+	"slices"
+	"strconv"
+)
+
+// listener is one address the API is served on.
+type listener struct {
+	url    string // for the startup message
+	ln     net.Listener
+	server *http.Server
+}
+
+// Start opens every configured listener and serves them in the
+// background. Nothing is served unless all of them open, so a port in use
+// or a bad socket path is reported before the service starts.
+func (server *Server) Start() error {
+	listeners, err := server.listen()
+	if err != nil {
+		for _, l := range listeners {
+			l.ln.Close()
+		}
+		return err
+	}
+
+	server.listeners = listeners
+	for _, l := range listeners {
+		go func() {
+			if err := l.server.Serve(l.ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+				slog.Error("Server failed", "url", l.url, "error", err)
+			}
+		}()
+	}
+	return nil
+}
+
+// URLs lists where the API is served, once Start has succeeded.
+func (server *Server) URLs() []string {
+	urls := make([]string, len(server.listeners))
+	for i, l := range server.listeners {
+		urls[i] = l.url
+	}
+	return urls
+}
+
+// listen opens the listeners. On error, the ones opened so far are
+// returned for closing.
+func (server *Server) listen() ([]*listener, error) {
+	cfg := server.cfg.ServerConfig
+	if len(cfg.Listeners) == 0 {
+		return nil, errors.New("no listeners configured")
+	}
+	for _, name := range cfg.Listeners {
+		if name != config.ListenerHTTPS && name != config.ListenerHTTP && name != config.ListenerUnix {
+			return nil, fmt.Errorf("unknown listener %q, must be https, http or unix", name)
+		}
+	}
+	https := slices.Contains(cfg.Listeners, config.ListenerHTTPS)
+	plainHTTP := slices.Contains(cfg.Listeners, config.ListenerHTTP)
+	if cfg.HTTPRedirect && !(https && plainHTTP) {
+		return nil, errors.New("redirecting HTTP to HTTPS needs both the http and https listeners")
+	}
+	extractor, err := clientIPExtractor(cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	server.echo.IPExtractor = extractor
+	if cfg.ClientAuth != config.ClientAuthOff && (plainHTTP && !cfg.HTTPRedirect || slices.Contains(cfg.Listeners, config.ListenerUnix)) {
+		slog.Warn("Client certificates are only checked on the HTTPS listener, the other listeners accept API keys only")
+	}
+
+	var listeners []*listener
+	if https {
+		tlsConfig, err := server.tlsConfig()
+		if err != nil {
+			return listeners, err
+		}
+		ln, err := net.Listen("tcp", cfg.Endpoint)
+		if err != nil {
+			return listeners, err
+		}
+		listeners = append(listeners, &listener{
+			url:    "https://" + displayAddr(ln.Addr()),
+			ln:     tls.NewListener(ln, tlsConfig),
+			server: server.httpServer(server.echo, tlsConfig),
+		})
+	}
+	if plainHTTP {
+		ln, err := net.Listen("tcp", cfg.HTTPEndpoint)
+		if err != nil {
+			return listeners, err
+		}
+		var handler http.Handler = server.echo
+		if cfg.HTTPRedirect {
+			handler = httpsRedirect(listeners[0].ln.Addr())
+		}
+		listeners = append(listeners, &listener{
+			url:    "http://" + displayAddr(ln.Addr()),
+			ln:     ln,
+			server: server.httpServer(handler, nil),
+		})
+	}
+	if slices.Contains(cfg.Listeners, config.ListenerUnix) {
+		ln, err := listenUnix(cfg.UnixSocket, cfg.SocketMode, cfg.SocketGroup)
+		if err != nil {
+			return listeners, err
+		}
+		listeners = append(listeners, &listener{
+			url:    "unix:" + cfg.UnixSocket,
+			ln:     ln,
+			server: server.httpServer(server.echo, nil),
+		})
+	}
+	return listeners, nil
+}
+
+func (server *Server) httpServer(handler http.Handler, tlsConfig *tls.Config) *http.Server {
+	return &http.Server{
+		Handler:   handler,
+		TLSConfig: tlsConfig,
+		ErrorLog:  slog.NewLogLogger(slog.Default().Handler(), slog.LevelWarn),
+	}
+}
+
+// httpsRedirect sends every request to the same host and path on the
+// HTTPS listener. 308 keeps the method, so a POST is repeated as a POST.
+func httpsRedirect(httpsAddr net.Addr) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddr.String())
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// listenUnix creates the socket at path, replacing one left behind by a
+// previous run, and applies the file mode and group.
+func listenUnix(path, mode, group string) (net.Listener, error) {
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || perm > 0777 {
+		return nil, fmt.Errorf("invalid unix socket mode %q, must be octal like 0660", mode)
+	}
+	gid := -1
+	if group != "" {
+		g, err := user.LookupGroup(group)
+		if err != nil {
+			return nil, err
+		}
+		if gid, err = strconv.Atoi(g.Gid); err != nil {
+			return nil, fmt.Errorf("group %s has no numeric id", group)
+		}
+	}
+
+	if info, err := os.Lstat(path); err == nil {
+		if info.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("%s exists and is not a socket", path)
+		}
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s is in use by another process", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	// The socket only gets its mode after it is created, so it is created
+	// accessible to this user alone, and no client can connect before the
+	// mode and group apply.
+	var ln net.Listener
+	err = withUmask(0o177, func() (err error) {
+		ln, err = net.Listen("unix", path)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, os.FileMode(perm)); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	if gid != -1 {
+		if err := os.Chown(path, -1, gid); err != nil {
+			ln.Close()
+			return nil, err
+		}
+	}
+	return ln, nil
+}
+
+// displayAddr shows a wildcard listen address as localhost.
+func displayAddr(addr net.Addr) string {
+	host, port, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return addr.String()
+	}
+	if ip := net.ParseIP(host); ip != nil && ip.IsUnspecified() {
+		host = "localhost"
+	}
+	return net.JoinHostPort(host, port)
+}
@@ -0,0 +1,45 @@
+//go:build unix
+
+package api
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	// A stale socket of an earlier run is replaced.
+	stale, err := listenUnix(path, "0600", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(interface{ SetUnlinkOnClose(bool) }).SetUnlinkOnClose(false)
+	stale.Close()
+
+	old := syscall.Umask(0o022)
+	defer syscall.Umask(old)
+
+	ln, err := listenUnix(path, "0660", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0o660 {
+		t.Errorf("socket mode = %o, want 660", perm)
+	}
+	if umask := syscall.Umask(0o022); umask != 0o022 {
+		t.Errorf("umask = %o after listening, want it restored to 022", umask)
+	}
+
+	if _, err := listenUnix(path, "0660", ""); err == nil {
+		t.Error("listening on a socket in use succeeded")
+	}
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"pos-printer/internal/logging"
+	"regexp"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+// requestIDContextKey holds the request's ID in echo.Context.
+const requestIDContextKey = "requestID"
+
+// validRequestID limits the IDs taken from clients and proxies to what is
+// safe to store and log.
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// requestID gives every request an ID, the X-Request-ID it was sent with
+// or a new one, and returns it in the response. Jobs keep the ID of the
+// request that enqueued them, so the worker's log lines can be matched
+// with the request's.
+func requestID(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		id := c.Request().Header.Get(echo.HeaderXRequestID)
+		if !validRequestID.MatchString(id) {
+			id = logging.NewRequestID()
+		}
+		c.Set(requestIDContextKey, id)
+		c.Response().Header().Set(echo.HeaderXRequestID, id)
+		return next(c)
+	}
+}
+
+func requestIDOf(c echo.Context) string {
+	id, _ := c.Get(requestIDContextKey).(string)
+	return id
+}
+
+// requestLogger returns the logger for lines about a request.
+func requestLogger(c echo.Context) *slog.Logger {
+	return slog.With("request_id", requestIDOf(c))
+}
+
+// logRequests writes a line per request once it is answered. Health
+// checks are polled, so successful ones are only logged at debug level.
+func logRequests() echo.MiddlewareFunc {
+	return middleware.RequestLoggerWithConfig(middleware.RequestLoggerConfig{
+		LogMethod:   true,
+		LogURI:      true,
+		LogStatus:   true,
+		LogLatency:  true,
+		LogRemoteIP: true,
+		LogError:    true,
+		HandleError: true,
+		LogValuesFunc: func(c echo.Context, v middleware.RequestLoggerValues) error {
+			level := slog.LevelInfo
+			switch {
+			case v.Status >= http.StatusInternalServerError:
+				level = slog.LevelError
+			case v.Status >= http.StatusBadRequest:
+				level = slog.LevelWarn
+			case c.Path() == "/health":
+				level = slog.LevelDebug
+			}
+			attrs := []slog.Attr{
+				slog.String("request_id", requestIDOf(c)),
+				slog.String("method", v.Method),
+				slog.String("uri", v.URI),
+				slog.Int("status", v.Status),
+				slog.Duration("latency", v.Latency),
+				slog.String("remote_ip", v.RemoteIP),
+			}
+			if id := apiKeyID(c); id != nil {
+				attrs = append(attrs, slog.Int64("api_key_id", *id))
+			}
+			if v.Error != nil {
+				attrs = append(attrs, slog.String("error", v.Error.Error()))
+			}
+			slog.LogAttrs(context.Background(), level, "Request", attrs...)
+			return nil
+		},
+	})
+}
+
+// recoverPanics answers a panicking handler with 500 and logs the panic.
+func recoverPanics() echo.MiddlewareFunc {
+	return middleware.RecoverWithConfig(middleware.RecoverConfig{
+		LogErrorFunc: func(c echo.Context, err error, stack []byte) error {
+			requestLogger(c).Error("Handler panicked", "error", err, "stack", string(stack))
+			return err
+		},
+	})
+}
@@ -0,0 +1,23 @@
+package api
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"math"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+func pngResponse(c echo.Context, img image.Image) error {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to encode preview"})
+	}
+	return c.Blob(http.StatusOK, "image/png", buf.Bytes())
+}
+
+func dotsPerMM(dpi int) int {
+	return int(math.Round(float64(dpi) / 25.4))
+}
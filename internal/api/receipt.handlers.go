@@ -0,0 +1,42 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"pos-printer/internal/receipt"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (server *Server) previewReceiptHandler(c echo.Context) error {
+	file, err := c.FormFile("file")
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "file is required"})
+	}
+
+	opts, err := server.receiptOptionsHelper(c)
+	if err == nil {
+		err = server.validateReceiptPreview(file.Size, opts)
+	}
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	src, err := file.Open()
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Failed to read file"})
+	}
+	defer src.Close()
+
+	pdf, err := io.ReadAll(src)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Failed to read file"})
+	}
+
+	img, err := receipt.Rasterize(pdf, opts)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+
+	return pngResponse(c, img)
+}
@@ -0,0 +1,45 @@
+package api
+
+import (
+	"fmt"
+	"pos-printer/internal/receipt"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// receiptOptionsHelper reads the optional rendering settings of a receipt
+// form, keeping the receipt_pdf_jobs defaults for those not given.
+func (server *Server) receiptOptionsHelper(c echo.Context) (receipt.Options, error) {
+	opts := receipt.DefaultOptions()
+
+	if v := c.FormValue("printerWidth"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("printerWidth must be a number")
+		}
+		opts.PrinterWidth = n
+	}
+	if v := c.FormValue("threshold"); v != "" {
+		n, err := strconv.ParseUint(v, 10, 8)
+		if err != nil {
+			return opts, fmt.Errorf("threshold must be between 0 and 255")
+		}
+		opts.Threshold = uint8(n)
+	}
+	if v := c.FormValue("feedLines"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return opts, fmt.Errorf("feedLines must be a number")
+		}
+		opts.FeedLines = n
+	}
+	if v := c.FormValue("zoom"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return opts, fmt.Errorf("zoom must be a number")
+		}
+		opts.Zoom = f
+	}
+	return opts, nil
+}
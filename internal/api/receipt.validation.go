@@ -0,0 +1,35 @@
+package api
+
+import (
+	"fmt"
+	"pos-printer/internal/receipt"
+)
+
+func (server *Server) validateReceiptPreview(size int64, opts receipt.Options) error {
+	receiptConfig := server.cfg.PrinterConfig.ReceiptConfig
+
+	if size > receiptConfig.MaxPDFSize {
+		return fmt.Errorf(
+			"file must not exceed %d MB",
+			receiptConfig.MaxPDFSize>>20,
+		)
+	}
+	if opts.PrinterWidth < receiptConfig.MinWidthDots || opts.PrinterWidth > receiptConfig.MaxWidthDots {
+		return fmt.Errorf(
+			"printerWidth must be between %d and %d dots",
+			receiptConfig.MinWidthDots,
+			receiptConfig.MaxWidthDots,
+		)
+	}
+	if opts.FeedLines < 0 || opts.FeedLines > 20 {
+		return fmt.Errorf("feedLines must be between 0 and 20")
+	}
+	if opts.Zoom < receiptConfig.MinZoom || opts.Zoom > receiptConfig.MaxZoom {
+		return fmt.Errorf(
+			"zoom must be between %g and %g",
+			receiptConfig.MinZoom,
+			receiptConfig.MaxZoom,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"pos-printer/internal/config"
+	"pos-printer/internal/model"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+func (server *Server) listSchedulesHandler(c echo.Context) error {
+	schedules, err := server.store.ListBarcodeSchedules()
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error fetching schedules"})
+	}
+	allowed := []*model.BarcodeSchedule{}
+	for _, sched := range schedules {
+		if allowsPrinter(c, sched.Job.VID, sched.Job.PID) {
+			allowed = append(allowed, sched)
+		}
+	}
+	return c.JSON(http.StatusOK, allowed)
+}
+
+// fetchSchedule loads the schedule named in the URL. Schedules on printers
+// the request's key may not use are hidden, as sql.ErrNoRows.
+func (server *Server) fetchSchedule(c echo.Context) (*model.BarcodeSchedule, error) {
+	sched, err := server.store.FetchBarcodeSchedule(c.Param("id"))
+	if err != nil {
+		return nil, err
+	}
+	if !allowsPrinter(c, sched.Job.VID, sched.Job.PID) {
+		return nil, sql.ErrNoRows
+	}
+	return sched, nil
+}
+
+func (server *Server) getScheduleHandler(c echo.Context) error {
+	sched, err := server.fetchSchedule(c)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "Schedule not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error fetching schedule"})
+	}
+	return c.JSON(http.StatusOK, sched)
+}
+
+func (server *Server) createScheduleHandler(c echo.Context) error {
+	var req model.ScheduleRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid JSON"})
+	}
+
+	sched, err := server.scheduleFromRequest(&req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	if !allowsPrinter(c, sched.Job.VID, sched.Job.PID) {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "API key may not use this printer"})
+	}
+	sched.APIKeyID = apiKeyID(c)
+
+	id, err := server.store.CreateBarcodeSchedule(sched)
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to create schedule"})
+	}
+
+	created, err := server.store.FetchBarcodeSchedule(strconv.FormatInt(id, 10))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error fetching schedule"})
+	}
+	server.audit(c, model.AuditScheduleCreate, "schedule", id, scheduleKey(created), nil, created)
+	return c.JSON(http.StatusCreated, created)
+}
+
+func (server *Server) updateScheduleHandler(c echo.Context) error {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusNotFound, echo.Map{"error": "Schedule not found"})
+	}
+	before, err := server.fetchSchedule(c)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "Schedule not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error fetching schedule"})
+	}
+
+	var req model.ScheduleRequest
+	if err := c.Bind(&req); err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Invalid JSON"})
+	}
+
+	sched, err := server.scheduleFromRequest(&req)
+	if err != nil {
+		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+	}
+	if !allowsPrinter(c, sched.Job.VID, sched.Job.PID) {
+		return c.JSON(http.StatusForbidden, echo.Map{"error": "API key may not use this printer"})
+	}
+	sched.ID = id
+
+	if err := server.store.UpdateBarcodeSchedule(sched); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "Schedule not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to update schedule"})
+	}
+
+	updated, err := server.store.FetchBarcodeSchedule(c.Param("id"))
+	if err != nil {
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error fetching schedule"})
+	}
+	server.audit(c, model.AuditScheduleUpdate, "schedule", id, scheduleKey(updated), before, updated)
+	return c.JSON(http.StatusOK, updated)
+}
+
+func (server *Server) deleteScheduleHandler(c echo.Context) error {
+	before, err := server.fetchSchedule(c)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "Schedule not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Error fetching schedule"})
+	}
+	if err := server.store.DeleteBarcodeSchedule(c.Param("id")); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return c.JSON(http.StatusNotFound, echo.Map{"error": "Schedule not found"})
+		}
+		return c.JSON(http.StatusInternalServerError, echo.Map{"error": "Failed to delete schedule"})
+	}
+	server.audit(c, model.AuditScheduleDelete, "schedule", before.ID, scheduleKey(before), before, nil)
+	return c.NoContent(http.StatusNoContent)
+}
+
+// scheduleKey is the printer key of the printer a schedule prints on.
+func scheduleKey(sched *model.BarcodeSchedule) string {
+	return config.PrinterKey(sched.Job.VID, sched.Job.PID)
+}
@@ -0,0 +1,52 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"pos-printer/internal/job"
+	"pos-printer/internal/model"
+	"strings"
+	"time"
+)
+
+const maxScheduleNameLength = 100
+
+// scheduleFromRequest validates a schedule request and computes its first
+// run.
+func (server *Server) scheduleFromRequest(req *model.ScheduleRequest) (*model.BarcodeSchedule, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	if len(req.Name) > maxScheduleNameLength {
+		return nil, fmt.Errorf("name must not exceed %d characters", maxScheduleNameLength)
+	}
+
+	now := time.Now()
+	next, err := job.NextRun(req.Cron, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Job.NotBefore != nil {
+		return nil, errors.New("job.notBefore is not allowed in a schedule")
+	}
+	server.applyDefaultsBarcodeHelper(&req.Job)
+	// Placeholders are validated as they expand, e.g. the length of {date}.
+	expanded := job.ExpandTemplate(req.Job, now)
+	if err := server.validateBarcodeRequest(&expanded); err != nil {
+		return nil, fmt.Errorf("job: %w", err)
+	}
+
+	enabled := req.Enabled == nil || *req.Enabled
+	sched := &model.BarcodeSchedule{
+		Name:    req.Name,
+		Cron:    req.Cron,
+		Enabled: enabled,
+		Job:     req.Job,
+	}
+	if enabled {
+		sched.NextRunAt = &next
+	}
+	return sched, nil
+}
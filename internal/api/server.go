@@ -2,54 +2,123 @@ package api
 
 import (
 	"pos-printer/internal/config"
-	"pos-printer/internal/db"
-	printers "pos-printer/internal/printer"
-
-	// "pos-printer/internal/job"
-	// "pos-printer/internal/store"
+	"pos-printer/internal/localca"
+	"pos-printer/internal/model"
 
 	"context"
+	"errors"
+	"sync/atomic"
+	"time"
 
 	"github.com/labstack/echo/v4"
-	"github.com/labstack/echo/v4/middleware"
 )
 
+// Store is the part of the job database the handlers use.
+type Store interface {
+	EnqueueBarcodeJob(req model.PrintBarcodeRequest) (int64, error)
+	FetchBarcodeJob(id string) (*model.BarcodeJob, error)
+	ResolveBarcodeJob(id string, status string) error
+	CancelBarcodeJob(id string) error
+	RetryBarcodeJob(id string) error
+	KeyLabelsSince(apiKeyID int64, since time.Time) (int, error)
+	PrinterLabelsSince(printerKey string, since time.Time) (int, error)
+	QueuedBarcodeJobs(printerKey string) (int, error)
+	CreateBarcodeSchedule(sched *model.BarcodeSchedule) (int64, error)
+	UpdateBarcodeSchedule(sched *model.BarcodeSchedule) error
+	DeleteBarcodeSchedule(id string) error
+	FetchBarcodeSchedule(id string) (*model.BarcodeSchedule, error)
+	ListBarcodeSchedules() ([]*model.BarcodeSchedule, error)
+	CreateBackup() (*model.Backup, error)
+	CreateAPIKey(key *model.APIKey, hash string) (int64, error)
+	FetchAPIKey(id string) (*model.APIKey, error)
+	FetchAPIKeyByHash(hash string) (*model.APIKey, error)
+	FetchAPIKeyByClientCert(cn string) (*model.APIKey, error)
+	ListAPIKeys() ([]*model.APIKey, error)
+	RevokeAPIKey(id string) error
+	TouchAPIKey(id int64) error
+	AppendAuditEntry(e *model.AuditEntry) error
+	ListAuditEntries(f model.AuditFilter) ([]*model.AuditEntry, error)
+}
+
+// Printer checks that a USB or emulated printer is connected.
+type Printer interface {
+	CheckPrinter(vidHexStr, pidHexStr string) error
+}
+
 type Server struct {
-	echo       *echo.Echo
-	cfg        *config.Config
-	sqlite     *db.SQLite
-	posPrinter *printers.PosPrinter
+	echo     *echo.Echo
+	cfg      *config.Config
+	store    Store
+	printer  Printer
+	keyUsage keyUsage
+	keyMade  atomic.Bool  // an API key has been created, which ends bootstrap
+	limiter  *rateLimiter // nil without a rate limit
+	localCA  *localca.CA  // issues the server certificate, if no files are used
+
+	listeners []*listener
 }
 
-func NewServer(cfg *config.Config, sqlite *db.SQLite, posPrinter *printers.PosPrinter) *Server {
+func NewServer(cfg *config.Config, store Store, printer Printer) *Server {
 	e := echo.New()
 
 	e.HideBanner = true
+	// Client headers are not trusted until listen applies the configured
+	// proxies.
+	e.IPExtractor = echo.ExtractIPDirect()
 
 	// Middleware
-	e.Use(middleware.Logger())
-	e.Use(middleware.Recover())
-	e.Use(middleware.CORS())
+	e.Use(requestID)
+	e.Use(logRequests())
+	e.Use(recoverPanics())
 
-	srv := &Server{echo: e, cfg: cfg, sqlite: sqlite, posPrinter: posPrinter}
+	srv := &Server{
+		echo:     e,
+		cfg:      cfg,
+		store:    store,
+		printer:  printer,
+		keyUsage: keyUsage{touched: map[int64]time.Time{}},
+	}
+	if limits := cfg.LimitsConfig; limits.RatePerMinute > 0 {
+		srv.limiter = newRateLimiter(limits.RatePerMinute, limits.RateBurst)
+	}
+	e.Use(srv.cors())
 	srv.registerRoutes()
 	return srv
 }
 
-func (server *Server) StartTLS() error {
-	return server.echo.StartTLS(
-		server.cfg.ServerConfig.Endpoint,
-		server.cfg.ServerConfig.CertPath,
-		server.cfg.ServerConfig.KeyPath,
-	)
-}
-
+// Shutdown stops every listener, waiting for requests in flight.
 func (s *Server) Shutdown(ctx context.Context) error {
-	return s.echo.Shutdown(ctx)
+	var errs []error
+	for _, l := range s.listeners {
+		errs = append(errs, l.server.Shutdown(ctx))
+	}
+	return errors.Join(errs...)
 }
 
 func (server *Server) registerRoutes() {
+	printScope := server.requireScope(model.ScopePrint)
+	readJobsScope := server.requireScope(model.ScopeReadJobs)
+	adminScope := server.requireScope(model.ScopeAdmin)
+
 	server.echo.GET("/health", server.healthCheckHandler)
-	server.echo.POST("/barcode/print", server.printBarcodeHandler)
-	server.echo.GET("/barcode/job/:id", server.jobBarcodeHandler)
+	server.echo.GET("/ca.pem", server.caCertHandler)
+	server.echo.POST("/barcode/print", server.printBarcodeHandler, printScope, server.rateLimit)
+	server.echo.GET("/barcode/job/:id", server.jobBarcodeHandler, readJobsScope)
+	server.echo.POST("/barcode/job/:id/resolve", server.resolveBarcodeJobHandler, printScope, server.rateLimit)
+	server.echo.POST("/barcode/job/:id/cancel", server.cancelBarcodeJobHandler, printScope, server.rateLimit)
+	server.echo.POST("/barcode/job/:id/retry", server.retryBarcodeJobHandler, printScope, server.rateLimit)
+	server.echo.POST("/barcode/preview", server.previewBarcodeHandler, printScope, server.rateLimit)
+	server.echo.POST("/receipt/preview", server.previewReceiptHandler, printScope, server.rateLimit)
+	server.echo.GET("/schedules", server.listSchedulesHandler, readJobsScope)
+	server.echo.POST("/schedules", server.createScheduleHandler, printScope, server.rateLimit)
+	server.echo.GET("/schedules/:id", server.getScheduleHandler, readJobsScope)
+	server.echo.PUT("/schedules/:id", server.updateScheduleHandler, printScope)
+	server.echo.DELETE("/schedules/:id", server.deleteScheduleHandler, printScope)
+	server.echo.GET("/admin/backups", server.listBackupsHandler, adminScope)
+	server.echo.POST("/admin/backups", server.createBackupHandler, adminScope, server.rateLimit)
+	server.echo.GET("/admin/backups/:name", server.downloadBackupHandler, adminScope)
+	server.echo.GET("/admin/apikeys", server.listAPIKeysHandler, adminScope)
+	server.echo.POST("/admin/apikeys", server.createAPIKeyHandler, adminScope, server.rateLimit)
+	server.echo.DELETE("/admin/apikeys/:id", server.revokeAPIKeyHandler, adminScope)
+	server.echo.GET("/audit", server.auditLogHandler, adminScope)
 }
@@ -0,0 +1,204 @@
+package api
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"pos-printer/internal/config"
+	"pos-printer/internal/localca"
+	"sync"
+	"time"
+)
+
+// reloadCheckInterval bounds how often the certificate files are checked
+// for changes during handshakes.
+const reloadCheckInterval = 10 * time.Second
+
+// certReloader serves certificates from disk and reloads them when the
+// files change, so renewed certificates take effect without a restart. It
+// holds the server certificate, unless the local CA issues it, and the
+// client CA bundle for mutual TLS. If a changed file fails to load, the
+// previous certificates stay in use.
+type certReloader struct {
+	certPath, keyPath, caPath string // "" for the parts not loaded from files
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	modTimes  map[string]time.Time
+	cert      *tls.Certificate
+	clientCAs *x509.CertPool
+}
+
+func newCertReloader(certPath, keyPath, caPath string) (*certReloader, error) {
+	r := &certReloader{certPath: certPath, keyPath: keyPath, caPath: caPath}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *certReloader) paths() []string {
+	var paths []string
+	for _, path := range []string{r.certPath, r.keyPath, r.caPath} {
+		if path != "" {
+			paths = append(paths, path)
+		}
+	}
+	return paths
+}
+
+// load reads every file. The caller holds mu, or r is not shared yet.
+func (r *certReloader) load() error {
+	modTimes := map[string]time.Time{}
+	for _, path := range r.paths() {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		modTimes[path] = info.ModTime()
+	}
+
+	var cert *tls.Certificate
+	if r.certPath != "" {
+		pair, err := tls.LoadX509KeyPair(r.certPath, r.keyPath)
+		if err != nil {
+			return fmt.Errorf("failed to load server certificate: %w", err)
+		}
+		cert = &pair
+	}
+	var pool *x509.CertPool
+	if r.caPath != "" {
+		pem, err := os.ReadFile(r.caPath)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in client CA bundle %s", r.caPath)
+		}
+	}
+
+	r.cert, r.clientCAs, r.modTimes = cert, pool, modTimes
+	return nil
+}
+
+// current returns the certificates, reloading them first if a file has
+// changed since they were loaded.
+func (r *certReloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(r.checkedAt) < reloadCheckInterval {
+		return r.cert, r.clientCAs
+	}
+	r.checkedAt = now
+
+	for _, path := range r.paths() {
+		info, err := os.Stat(path)
+		if err != nil || info.ModTime().Equal(r.modTimes[path]) {
+			continue
+		}
+		if err := r.load(); err != nil {
+			slog.Error("Keeping the current certificates, reload failed", "error", err)
+		} else {
+			slog.Info("Reloaded TLS certificates")
+		}
+		break
+	}
+	return r.cert, r.clientCAs
+}
+
+// tlsConfig builds the server's TLS configuration. Certificates are
+// looked up per handshake, so a reload or renewal applies to new
+// connections.
+func (server *Server) tlsConfig() (*tls.Config, error) {
+	cfg := server.cfg.ServerConfig
+
+	var clientAuth tls.ClientAuthType
+	caPath := cfg.ClientCAPath
+	switch cfg.ClientAuth {
+	case config.ClientAuthOff, "":
+		clientAuth, caPath = tls.NoClientCert, ""
+	case config.ClientAuthOptional:
+		clientAuth = tls.VerifyClientCertIfGiven
+	case config.ClientAuthRequire:
+		clientAuth = tls.RequireAndVerifyClientCert
+	default:
+		return nil, fmt.Errorf("unknown client certificate mode %q, must be off, optional or require", cfg.ClientAuth)
+	}
+
+	certPath, keyPath := cfg.CertPath, cfg.KeyPath
+	switch cfg.CertMode {
+	case config.CertModeAuto:
+		if err := checkCertFiles(certPath, keyPath); err != nil {
+			slog.Info("Using the local CA", "dir", cfg.LocalCADir, "reason", err)
+			certPath, keyPath = "", ""
+		}
+	case config.CertModeFiles:
+	case config.CertModeLocalCA:
+		certPath, keyPath = "", ""
+	default:
+		return nil, fmt.Errorf("unknown certificate mode %q, must be auto, files or local-ca", cfg.CertMode)
+	}
+	if certPath == "" {
+		ca, err := localca.Open(cfg.LocalCADir, cfg.LocalCAHosts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open the local CA: %w", err)
+		}
+		server.localCA = ca
+	}
+
+	reloader, err := newCertReloader(certPath, keyPath, caPath)
+	if err != nil {
+		return nil, err
+	}
+
+	base := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: clientAuth,
+		NextProtos: []string{"h2", "http/1.1"},
+		GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+			if server.localCA != nil {
+				return server.localCA.GetCertificate(hello)
+			}
+			cert, _ := reloader.current()
+			return cert, nil
+		},
+	}
+	if clientAuth == tls.NoClientCert {
+		return base, nil
+	}
+	base.GetConfigForClient = func(*tls.ClientHelloInfo) (*tls.Config, error) {
+		_, clientCAs := reloader.current()
+		conf := base.Clone()
+		conf.GetConfigForClient = nil
+		conf.ClientCAs = clientCAs
+		return conf, nil
+	}
+	return base, nil
+}
+
+// checkCertFiles reports why the certificate files cannot be served, or
+// nil if they can.
+func checkCertFiles(certPath, keyPath string) error {
+	pair, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return fmt.Errorf("the certificate files cannot be loaded: %w", err)
+	}
+	if time.Now().After(pair.Leaf.NotAfter) {
+		return fmt.Errorf("%s expired on %s", certPath, pair.Leaf.NotAfter.Format(time.DateOnly))
+	}
+	return nil
+}
+
+// clientCertCN returns the common name of the verified client certificate
+// the request was made with, or "" if there is none.
+func clientCertCN(state *tls.ConnectionState) string {
+	if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		return ""
+	}
+	return state.VerifiedChains[0][0].Subject.CommonName
+}
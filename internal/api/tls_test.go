@@ -0,0 +1,293 @@
+package api
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"pos-printer/internal/config"
+	"pos-printer/internal/model"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testCA issues certificates for tests.
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newTestCA(t *testing.T, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &testCA{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue returns a PEM certificate and key for cn, for a server on
+// localhost or, with client, for a client.
+func (ca *testCA) issue(t *testing.T, serial int64, cn string, client bool) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	if client {
+		template.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+		template.DNSNames, template.IPAddresses = nil, nil
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+// writeFile writes data to path with a modification time of at, so a
+// rewrite within the same clock tick still counts as a change.
+func writeFile(t *testing.T, path string, data []byte, at time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, at, at); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// servedSerial returns the serial number of the certificate r serves.
+func servedSerial(t *testing.T, r *certReloader) int64 {
+	t.Helper()
+	cert, _ := r.current()
+	if cert == nil {
+		t.Fatal("no certificate served")
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	return leaf.SerialNumber.Int64()
+}
+
+func TestCertReloader(t *testing.T) {
+	ca := newTestCA(t, "test CA")
+	dir := t.TempDir()
+	certPath, keyPath := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Minute)
+	certPEM, keyPEM := ca.issue(t, 1, "localhost", false)
+	writeFile(t, certPath, certPEM, start)
+	writeFile(t, keyPath, keyPEM, start)
+
+	r, err := newCertReloader(certPath, keyPath, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := servedSerial(t, r); got != 1 {
+		t.Fatalf("serving serial %d, want 1", got)
+	}
+
+	// A renewed certificate is picked up at the next check, not before.
+	certPEM, keyPEM = ca.issue(t, 2, "localhost", false)
+	writeFile(t, certPath, certPEM, start.Add(time.Second))
+	writeFile(t, keyPath, keyPEM, start.Add(time.Second))
+	if got := servedSerial(t, r); got != 1 {
+		t.Errorf("serving serial %d within the check interval, want 1", got)
+	}
+	r.checkedAt = time.Time{}
+	if got := servedSerial(t, r); got != 2 {
+		t.Errorf("serving serial %d after the renewal, want 2", got)
+	}
+
+	// A certificate that no longer matches its key, as when only one of the
+	// files has been replaced, keeps the current one in use.
+	certPEM, _ = ca.issue(t, 3, "localhost", false)
+	writeFile(t, certPath, certPEM, start.Add(2*time.Second))
+	r.checkedAt = time.Time{}
+	if got := servedSerial(t, r); got != 2 {
+		t.Errorf("serving serial %d after a mismatched reload, want 2", got)
+	}
+
+	// So does a file that is not a certificate at all.
+	writeFile(t, certPath, []byte("not a certificate"), start.Add(3*time.Second))
+	r.checkedAt = time.Time{}
+	if got := servedSerial(t, r); got != 2 {
+		t.Errorf("serving serial %d after a bad reload, want 2", got)
+	}
+
+	// Once both files are good again, they are served.
+	certPEM, keyPEM = ca.issue(t, 4, "localhost", false)
+	writeFile(t, certPath, certPEM, start.Add(4*time.Second))
+	writeFile(t, keyPath, keyPEM, start.Add(4*time.Second))
+	r.checkedAt = time.Time{}
+	if got := servedSerial(t, r); got != 4 {
+		t.Errorf("serving serial %d after the files were fixed, want 4", got)
+	}
+}
+
+func TestCertReloaderClientCAs(t *testing.T) {
+	oldCA, newCA := newTestCA(t, "old CA"), newTestCA(t, "new CA")
+	caPath := filepath.Join(t.TempDir(), "clients.pem")
+	start := time.Now().Add(-time.Minute)
+	writeFile(t, caPath, oldCA.pem, start)
+
+	r, err := newCertReloader("", "", caPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	trusts := func(ca *testCA) bool {
+		_, pool := r.current()
+		_, err := ca.cert.Verify(x509.VerifyOptions{Roots: pool})
+		return err == nil
+	}
+	if !trusts(oldCA) || trusts(newCA) {
+		t.Fatal("the loaded bundle should trust only the old CA")
+	}
+
+	writeFile(t, caPath, newCA.pem, start.Add(time.Second))
+	r.checkedAt = time.Time{}
+	if trusts(oldCA) || !trusts(newCA) {
+		t.Error("the rotated bundle should trust only the new CA")
+	}
+
+	writeFile(t, caPath, []byte("empty"), start.Add(2*time.Second))
+	r.checkedAt = time.Time{}
+	if !trusts(newCA) {
+		t.Error("a bundle without certificates should keep the current one in use")
+	}
+}
+
+func TestClientCertAuthentication(t *testing.T) {
+	ca, otherCA := newTestCA(t, "client CA"), newTestCA(t, "other CA")
+	dir := t.TempDir()
+	now := time.Now()
+	serverCert, serverKey := ca.issue(t, 1, "localhost", false)
+	writeFile(t, filepath.Join(dir, "cert.pem"), serverCert, now)
+	writeFile(t, filepath.Join(dir, "key.pem"), serverKey, now)
+	writeFile(t, filepath.Join(dir, "clients.pem"), ca.pem, now)
+
+	store := newFakeStore()
+	store.jobs["7"] = &model.BarcodeJob{ID: 7, VID: "0x0fe6", PID: "0x8800", Status: "done"}
+	store.certKeys["till-1"] = &model.APIKey{ID: 1, Scopes: []string{model.ScopeReadJobs}}
+	store.certKeys["till-2"] = &model.APIKey{ID: 2, Scopes: []string{model.ScopeReadJobs}, RevokedAt: &now}
+	cfg := testConfig()
+	cfg.AuthConfig.Required = true
+	cfg.ServerConfig.CertMode = config.CertModeFiles
+	cfg.ServerConfig.CertPath = filepath.Join(dir, "cert.pem")
+	cfg.ServerConfig.KeyPath = filepath.Join(dir, "key.pem")
+	cfg.ServerConfig.ClientAuth = config.ClientAuthOptional
+	cfg.ServerConfig.ClientCAPath = filepath.Join(dir, "clients.pem")
+	server := NewServer(cfg, store, &fakePrinter{})
+
+	tlsConfig, err := server.tlsConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewUnstartedServer(server.echo)
+	ts.Listener = tls.NewListener(ts.Listener, tlsConfig)
+	ts.Start()
+	t.Cleanup(ts.Close)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	get := func(clientCA *testCA, cn string) (int, string, error) {
+		conf := &tls.Config{RootCAs: roots, ServerName: "localhost"}
+		if clientCA != nil {
+			certPEM, keyPEM := clientCA.issue(t, 10, cn, true)
+			pair, err := tls.X509KeyPair(certPEM, keyPEM)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Sent even when the server does not name its CA, so the
+			// server is the one to refuse it.
+			conf.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+				return &pair, nil
+			}
+		}
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: conf}}
+		defer client.CloseIdleConnections()
+		res, err := client.Get("https://" + ts.Listener.Addr().String() + "/barcode/job/7")
+		if err != nil {
+			return 0, "", err
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return res.StatusCode, string(body), nil
+	}
+
+	tests := []struct {
+		name       string
+		ca         *testCA
+		cn         string
+		wantStatus int // 0 if the handshake must fail
+		wantBody   string
+	}{
+		{name: "mapped certificate", ca: ca, cn: "till-1", wantStatus: http.StatusOK},
+		{name: "unmapped certificate", ca: ca, cn: "stranger", wantStatus: http.StatusUnauthorized, wantBody: "not mapped"},
+		{name: "certificate of a revoked key", ca: ca, cn: "till-2", wantStatus: http.StatusUnauthorized, wantBody: "not mapped"},
+		{name: "no certificate", wantStatus: http.StatusUnauthorized, wantBody: "API key required"},
+		{name: "certificate from another CA", ca: otherCA, cn: "till-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status, body, err := get(tt.ca, tt.cn)
+			if tt.wantStatus == 0 {
+				if err == nil {
+					t.Errorf("request succeeded with status %d, want the handshake to fail", status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != tt.wantStatus || !strings.Contains(body, tt.wantBody) {
+				t.Errorf("status = %d, body %s; want %d with %q", status, body, tt.wantStatus, tt.wantBody)
+			}
+		})
+	}
+}
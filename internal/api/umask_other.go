@@ -0,0 +1,8 @@
+//go:build !unix
+
+package api
+
+// withUmask runs f. There is no umask outside Unix.
+func withUmask(mask int, f func() error) error {
+	return f()
+}
@@ -0,0 +1,14 @@
+//go:build unix
+
+package api
+
+import "syscall"
+
+// withUmask runs f with the process umask set to mask, so the files f
+// creates get no permission mask clears. The umask is shared by the whole
+// process, so this is only used while the listeners open at startup.
+func withUmask(mask int, f func() error) error {
+	old := syscall.Umask(mask)
+	defer syscall.Umask(old)
+	return f()
+}
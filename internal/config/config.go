@@ -1,30 +1,121 @@
 package config
 
 import (
+	"fmt"
+	"os"
+	"pos-printer/internal/label"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Client certificate modes for mutual TLS.
+const (
+	ClientAuthOff      = "off"      // no client certificates
+	ClientAuthOptional = "optional" // verify a certificate if one is sent
+	ClientAuthRequire  = "require"  // refuse connections without a valid certificate
+)
+
+// Where the server certificate comes from.
+const (
+	CertModeAuto    = "auto"     // the files if they hold a valid certificate, else the local CA
+	CertModeFiles   = "files"    // CertPath and KeyPath
+	CertModeLocalCA = "local-ca" // issued by a CA kept in LocalCADir
+)
+
+// Listeners the API can be served on.
+const (
+	ListenerHTTPS = "https" // Endpoint
+	ListenerHTTP  = "http"  // HTTPEndpoint, for deployments behind a reverse proxy
+	ListenerUnix  = "unix"  // UnixSocket, for clients on the same machine
+)
+
 type ServerConfig struct {
-	Endpoint string
-	Timeout  time.Duration
-	CertPath string
-	KeyPath  string
+	Listeners      []string // ListenerHTTPS, ListenerHTTP and/or ListenerUnix
+	Endpoint       string
+	HTTPEndpoint   string
+	HTTPRedirect   bool   // the HTTP listener redirects to HTTPS instead of serving the API
+	UnixSocket     string // socket path, replaced on startup
+	SocketMode     string // octal file mode of the socket, e.g. "0660"
+	SocketGroup    string // group that owns the socket, "" keeps the process's group
+	Timeout        time.Duration
+	CertMode       string // CertModeAuto, CertModeFiles or CertModeLocalCA
+	CertPath       string
+	KeyPath        string
+	LocalCADir     string
+	LocalCAHosts   []string // extra names and IPs for the local CA's server certificate
+	ClientAuth     string   // ClientAuthOff, ClientAuthOptional or ClientAuthRequire
+	ClientCAPath   string   // PEM bundle of the CAs that issue client certificates
+	TrustedProxies []string // IPs or CIDR ranges of reverse proxies whose X-Forwarded-For is believed, empty for none
+	CORS           CORSConfig
 }
 
+// CORSConfig controls which web pages may call the API from a browser.
+// Origins are matched exactly, "https://*.example.com" matches subdomains
+// and "*" matches any origin.
+type CORSConfig struct {
+	AllowOrigins   []string // empty allows no cross-origin requests
+	AllowMethods   []string
+	AllowHeaders   []string
+	MaxAge         time.Duration // how long browsers may cache a preflight
+	PrivateNetwork bool          // answer Private Network Access preflights from allowed origins
+}
+
+// Database drivers. SQLite suits a single print server; PostgreSQL lets
+// several print servers share one job queue.
+const (
+	DriverSQLite   = "sqlite"
+	DriverPostgres = "postgres"
+)
+
 type DBConfig struct {
-	SQLitePath string
-	Migrate    bool
+	Driver          string // DriverSQLite or DriverPostgres
+	SQLitePath      string
+	PostgresURL     string
+	Migrate         bool
+	JournalMode     string // WAL lets readers run alongside a writer
+	Synchronous     string
+	BusyTimeout     time.Duration // how long a statement waits for a lock
+	ForeignKeys     bool
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
 }
 
 type BarcodeConfig struct {
-	MinSizeMM      int
-	MaxSizeMM      int
-	MinGapMM       int
-	MaxGapMM       int
-	MinGapOffsetMM int
-	MaxGapOffsetMM int
-	MinDirection   int
-	MaxDirection   int
+	MinSizeMM        int
+	MaxSizeMM        int
+	MinGapMM         int
+	MaxGapMM         int
+	MinGapOffsetMM   int
+	MaxGapOffsetMM   int
+	MinDirection     int
+	MaxDirection     int
+	MinDPI           int
+	MaxDPI           int
+	MinPriority      int
+	MaxPriority      int
+	MaxScheduleAhead time.Duration // how far ahead notBefore may be
+	MaxSerialWidth   int
+	MaxSerialAffix   int // prefix and suffix length
+}
+
+type ReceiptConfig struct {
+	MinWidthDots int
+	MaxWidthDots int
+	MaxPDFSize   int64 // bytes
+	MinZoom      float64
+	MaxZoom      float64
+}
+
+type VirtualPrinterConfig struct {
+	All          bool            // emulate every printer
+	Printers     map[string]bool // emulated printers, keyed by PrinterKey
+	Dir          string
+	RenderPNG    bool
+	Latency      time.Duration
+	Fault        string // "", "paper-out" or "disconnect"
+	FaultPercent int
 }
 
 type PrinterConfig struct {
@@ -32,6 +123,42 @@ type PrinterConfig struct {
 	MaxBarcodeDataLength int
 	MaxTopTextLength     int
 	BarcodeConfig        BarcodeConfig
+	ReceiptConfig        ReceiptConfig
+	VirtualConfig        VirtualPrinterConfig
+	LabelLanguage        string            // default label language, e.g. "tspl"
+	LabelLanguages       map[string]string // per printer override, keyed by PrinterKey
+}
+
+// LabelLanguageFor returns the label language configured for the printer
+// with the given VID and PID, falling back to the default language.
+func (c PrinterConfig) LabelLanguageFor(vid, pid string) string {
+	if lang, ok := c.LabelLanguages[PrinterKey(vid, pid)]; ok {
+		return lang
+	}
+	return c.LabelLanguage
+}
+
+// IsVirtual reports whether the printer with the given VID and PID is
+// emulated instead of being driven over USB.
+func (c VirtualPrinterConfig) IsVirtual(vid, pid string) bool {
+	return c.All || c.Printers[PrinterKey(vid, pid)]
+}
+
+// PrinterKey normalizes a VID/PID pair into the "0x0fe6:0x8800" form used
+// to key per printer settings.
+func PrinterKey(vid, pid string) string {
+	return normalizeID(vid) + ":" + normalizeID(pid)
+}
+
+func normalizeID(id string) string {
+	id = strings.ToLower(strings.TrimSpace(id))
+	if v, err := strconv.ParseUint(id, 0, 16); err == nil {
+		return fmt.Sprintf("0x%04x", v)
+	}
+	if v, err := strconv.ParseUint(id, 16, 16); err == nil {
+		return fmt.Sprintf("0x%04x", v)
+	}
+	return id
 }
 
 type JobStatus struct {
@@ -39,65 +166,351 @@ type JobStatus struct {
 	StatusInProgress string
 	StatusFailed     string
 	StatusDone       string
+	StatusUnknown    string // orphaned mid-print, waiting for an operator
+	StatusCancelled  string // withdrawn before it started printing
 }
 
+// Recovery policies for jobs whose worker stopped renewing its lease.
+const (
+	RecoveryRequeue = "requeue" // print the job again
+	RecoveryUnknown = "unknown" // park the job for operator review
+)
+
 type WorkerConfig struct {
 	MaxJobAttempts     int
 	BarcodeWorkerCount int
 	JobStatus          JobStatus
-	StaleThreshold     time.Duration
-	StaleInterval      time.Duration
+	InstanceID         string        // lease owner, unique per process sharing the database and stable across restarts
+	LeaseDuration      time.Duration // how long a claimed job stays owned without a heartbeat
+	HeartbeatInterval  time.Duration
+	ReapInterval       time.Duration
+	RecoveryPolicy     string        // RecoveryRequeue or RecoveryUnknown
+	PollInterval       time.Duration // fallback for jobs that are not announced
+	ChunkSize          int           // labels sent per print command, 0 sends a job at once
+	Printers           []string      // printer keys this instance claims jobs for, empty for all
+}
+
+// RetentionConfig bounds how many finished jobs are kept. Only done,
+// failed and unknown jobs are ever purged.
+type RetentionConfig struct {
+	MaxAge      map[string]time.Duration // per status, unset keeps jobs forever
+	MaxCount    map[string]int           // per status, unset keeps any number
+	Interval    time.Duration
+	BatchSize   int
+	ArchiveDir  string // purged jobs are written here as .jsonl.gz, "" discards them
+	Maintenance string // cron expression for ANALYZE and VACUUM, "" disables
+}
+
+// BackupConfig controls snapshots of the SQLite job database.
+type BackupConfig struct {
+	Dir            string
+	Schedule       string // cron expression, "" disables scheduled backups
+	Keep           int    // newest backups kept, 0 keeps all
+	IntegrityCheck bool   // run PRAGMA integrity_check on startup
+	AutoRestore    bool   // replace a damaged database with the newest good backup
+}
+
+// AuthConfig controls API key authentication. Keys live in the job
+// database and are managed with "pos-printer apikey" or /admin/apikeys.
+type AuthConfig struct {
+	Required bool // reject requests without a key; /health is always open
+	// Bootstrap lets clients on this machine in without a key until the
+	// first key is created, so an upgraded install keeps printing.
+	Bootstrap bool
+}
+
+// LimitsConfig protects the print queues from runaway clients. Zero
+// disables a limit.
+type LimitsConfig struct {
+	RatePerMinute      int            // POST requests per API key, or per client IP without one
+	RateBurst          int            // requests allowed at once before the rate applies
+	KeyDailyLabels     int            // labels a key may enqueue per day, unless the key sets its own
+	PrinterDailyLabels map[string]int // labels enqueued per printer per day, by printer key
+	MaxQueuedJobs      int            // pending and printing jobs per printer
+}
+
+// Log output formats.
+const (
+	LogFormatText = "text" // key=value pairs, for reading
+	LogFormatJSON = "json" // one object per line, for log collectors
+)
+
+// LogConfig controls the service log. It is written to stderr and, with
+// File set, to a file rotated by size.
+type LogConfig struct {
+	Level      string // debug, info, warn or error
+	Format     string // LogFormatText or LogFormatJSON
+	File       string
+	MaxSizeMB  int // size at which the file is rotated
+	MaxBackups int // rotated files kept
+	MaxAgeDays int // rotated files older than this are deleted, 0 keeps them
 }
 
 type Config struct {
-	ServerConfig  ServerConfig
-	DBConfig      DBConfig
-	PrinterConfig PrinterConfig
-	WorkerConfig  WorkerConfig
+	ServerConfig    ServerConfig
+	DBConfig        DBConfig
+	PrinterConfig   PrinterConfig
+	WorkerConfig    WorkerConfig
+	RetentionConfig RetentionConfig
+	BackupConfig    BackupConfig
+	AuthConfig      AuthConfig
+	LimitsConfig    LimitsConfig
+	LogConfig       LogConfig
 }
 
-func Load() *Config {
+// Load reads the configuration from the environment. It fails on label
+// languages that no renderer supports, so a typo stops the service at
+// startup rather than failing every job for the printer.
+func Load() (*Config, error) {
 
 	// Load .env file if it exists in the current directory process
 	LoadEnv(".env")
 
-	return &Config{
+	cfg := &Config{
 		ServerConfig: ServerConfig{
-			Endpoint: GetEnv("ENDPOINT", ":5000"),
-			Timeout:  10 * time.Second,
-			CertPath: GetEnv("SERVER_CERT_PATH", "./certs/cert.pem"),
-			KeyPath:  GetEnv("SERVER_KEY_PATH", "./certs/cert.key"),
+			Listeners:      listOr(GetEnvList("SERVER_LISTENERS"), ListenerHTTPS),
+			Endpoint:       GetEnv("ENDPOINT", ":5000"),
+			HTTPEndpoint:   GetEnv("SERVER_HTTP_ENDPOINT", ":5080"),
+			HTTPRedirect:   GetEnvInt("SERVER_HTTP_REDIRECT", 0) == 1,
+			UnixSocket:     GetEnv("SERVER_UNIX_SOCKET", "./data/pos-printer.sock"),
+			SocketMode:     GetEnv("SERVER_UNIX_SOCKET_MODE", "0660"),
+			SocketGroup:    GetEnv("SERVER_UNIX_SOCKET_GROUP", ""),
+			Timeout:        10 * time.Second,
+			CertMode:       GetEnv("SERVER_CERT_MODE", CertModeAuto),
+			CertPath:       GetEnv("SERVER_CERT_PATH", "./certs/cert.pem"),
+			KeyPath:        GetEnv("SERVER_KEY_PATH", "./certs/cert.key"),
+			LocalCADir:     GetEnv("SERVER_LOCAL_CA_DIR", "./data/ca"),
+			LocalCAHosts:   GetEnvList("SERVER_LOCAL_CA_HOSTS"),
+			ClientAuth:     GetEnv("SERVER_CLIENT_AUTH", ClientAuthOff),
+			ClientCAPath:   GetEnv("SERVER_CLIENT_CA_PATH", "./certs/client-ca.pem"),
+			TrustedProxies: GetEnvList("SERVER_TRUSTED_PROXIES"),
+			CORS: CORSConfig{
+				AllowOrigins:   GetEnvList("CORS_ALLOW_ORIGINS"),
+				AllowMethods:   listOr(GetEnvList("CORS_ALLOW_METHODS"), "GET", "POST", "PUT", "DELETE"),
+				AllowHeaders:   listOr(GetEnvList("CORS_ALLOW_HEADERS"), "Content-Type", "Authorization", "X-API-Key"),
+				MaxAge:         time.Duration(GetEnvInt("CORS_MAX_AGE_SECONDS", 600)) * time.Second,
+				PrivateNetwork: GetEnvInt("CORS_PRIVATE_NETWORK", 1) == 1,
+			},
 		},
 		DBConfig: DBConfig{
-			SQLitePath: GetEnv("DB_SQLITE_PATH", "./data/db/pos-printer.sqlite.db"),
-			Migrate:    GetEnvInt("DB_MIGRATE", 1) == 1,
+			Driver:          GetEnv("DB_DRIVER", DriverSQLite),
+			SQLitePath:      GetEnv("DB_SQLITE_PATH", "./data/db/pos-printer.sqlite.db"),
+			PostgresURL:     GetEnv("DB_POSTGRES_URL", ""),
+			Migrate:         GetEnvInt("DB_MIGRATE", 1) == 1,
+			JournalMode:     GetEnv("DB_JOURNAL_MODE", "WAL"),
+			Synchronous:     GetEnv("DB_SYNCHRONOUS", "NORMAL"),
+			BusyTimeout:     time.Duration(GetEnvInt("DB_BUSY_TIMEOUT_MS", 5000)) * time.Millisecond,
+			ForeignKeys:     GetEnvInt("DB_FOREIGN_KEYS", 1) == 1,
+			MaxOpenConns:    GetEnvInt("DB_MAX_OPEN_CONNS", 8),
+			MaxIdleConns:    GetEnvInt("DB_MAX_IDLE_CONNS", 8),
+			ConnMaxLifetime: time.Duration(GetEnvInt("DB_CONN_MAX_LIFETIME_MINUTES", 30)) * time.Minute,
 		},
 		PrinterConfig: PrinterConfig{
 			MaxPrintCount:        GetEnvInt("MAX_BARCODE_PRINT_COUNT", 1000),
 			MaxBarcodeDataLength: GetEnvInt("MAX_BARCODE_DATA_LENGTH", 100),
 			MaxTopTextLength:     GetEnvInt("MAX_TOP_TEXT_LENGTH", 50),
 			BarcodeConfig: BarcodeConfig{
-				MinSizeMM:      5,
-				MaxSizeMM:      200,
-				MinGapMM:       0, // 0 means auto-detect
-				MaxGapMM:       50,
-				MinGapOffsetMM: -10,
-				MaxGapOffsetMM: 10,
-				MinDirection:   0,
-				MaxDirection:   1,
+				MinSizeMM:        5,
+				MaxSizeMM:        200,
+				MinGapMM:         0, // 0 means auto-detect
+				MaxGapMM:         50,
+				MinGapOffsetMM:   -10,
+				MaxGapOffsetMM:   10,
+				MinDirection:     0,
+				MaxDirection:     1,
+				MinDPI:           150,
+				MaxDPI:           600,
+				MinPriority:      -10,
+				MaxPriority:      10,
+				MaxScheduleAhead: 30 * 24 * time.Hour,
+				MaxSerialWidth:   18,
+				MaxSerialAffix:   20,
+			},
+			ReceiptConfig: ReceiptConfig{
+				MinWidthDots: 384, // 58 mm paper
+				MaxWidthDots: 832, // 112 mm paper
+				MaxPDFSize:   int64(GetEnvInt("MAX_RECEIPT_PDF_SIZE_MB", 10)) << 20,
+				MinZoom:      0.5,
+				MaxZoom:      4,
+			},
+			VirtualConfig: VirtualPrinterConfig{
+				All:          GetEnvInt("VIRTUAL", 0) == 1,
+				Printers:     printerSet(GetEnvList("VIRTUAL_PRINTERS")),
+				Dir:          GetEnv("VIRTUAL_DIR", "./data/virtual"),
+				RenderPNG:    GetEnvInt("VIRTUAL_PNG", 1) == 1,
+				Latency:      time.Duration(GetEnvInt("VIRTUAL_LATENCY_MS", 0)) * time.Millisecond,
+				Fault:        GetEnv("VIRTUAL_FAULT", ""),
+				FaultPercent: GetEnvInt("VIRTUAL_FAULT_PERCENT", 100),
 			},
+			LabelLanguage:  GetEnv("LABEL_LANGUAGE", "tspl"),
+			LabelLanguages: printerKeyed(GetEnvMap("LABEL_LANGUAGES")),
 		},
 		WorkerConfig: WorkerConfig{
 			MaxJobAttempts:     GetEnvInt("MAX_JOB_ATTEMPTS", 3),
 			BarcodeWorkerCount: GetEnvInt("BARCODE_WORKER_COUNT", 3),
-			StaleThreshold:     time.Duration(10) * time.Minute,
-			StaleInterval:      time.Duration(5) * time.Minute,
+			InstanceID:         GetEnv("INSTANCE_ID", defaultInstanceID()),
+			LeaseDuration:      time.Duration(GetEnvInt("LEASE_SECONDS", 30)) * time.Second,
+			HeartbeatInterval:  time.Duration(GetEnvInt("LEASE_SECONDS", 30)) * time.Second / 3,
+			ReapInterval:       time.Duration(GetEnvInt("LEASE_REAP_INTERVAL_SECONDS", 10)) * time.Second,
+			RecoveryPolicy:     GetEnv("RECOVERY_POLICY", RecoveryRequeue),
+			PollInterval:       time.Duration(GetEnvInt("WORKER_POLL_INTERVAL_SECONDS", 10)) * time.Second,
+			ChunkSize:          GetEnvInt("PRINT_CHUNK_SIZE", 50),
+			Printers:           printerKeys(GetEnvList("WORKER_PRINTERS")),
 			JobStatus: JobStatus{
 				StatusPending:    "pending",
 				StatusInProgress: "in_progress",
 				StatusFailed:     "failed",
 				StatusDone:       "done",
+				StatusUnknown:    "unknown",
+				StatusCancelled:  "cancelled",
 			},
 		},
+		RetentionConfig: RetentionConfig{
+			MaxAge:      statusDays(GetEnvMap("RETENTION_MAX_AGE_DAYS"), map[string]time.Duration{"done": 30 * 24 * time.Hour, "failed": 90 * 24 * time.Hour, "cancelled": 30 * 24 * time.Hour}),
+			MaxCount:    positiveCounts(GetEnvMap("RETENTION_MAX_JOBS")),
+			Interval:    time.Duration(GetEnvInt("RETENTION_INTERVAL_MINUTES", 60)) * time.Minute,
+			BatchSize:   500,
+			ArchiveDir:  GetEnv("RETENTION_ARCHIVE_DIR", ""),
+			Maintenance: cronSchedule(GetEnv("DB_MAINTENANCE_SCHEDULE", "0 4 * * 0")),
+		},
+		BackupConfig: BackupConfig{
+			Dir:            GetEnv("BACKUP_DIR", "./data/backups"),
+			Schedule:       cronSchedule(GetEnv("BACKUP_SCHEDULE", "0 3 * * *")),
+			Keep:           GetEnvInt("BACKUP_KEEP", 7),
+			IntegrityCheck: GetEnvInt("BACKUP_INTEGRITY_CHECK", 1) == 1,
+			AutoRestore:    GetEnvInt("BACKUP_AUTO_RESTORE", 1) == 1,
+		},
+		AuthConfig: AuthConfig{
+			Required:  GetEnvInt("AUTH_REQUIRED", 1) == 1,
+			Bootstrap: GetEnvInt("AUTH_BOOTSTRAP", 1) == 1,
+		},
+		LimitsConfig: LimitsConfig{
+			RatePerMinute:      GetEnvInt("RATE_LIMIT_PER_MINUTE", 120),
+			RateBurst:          GetEnvInt("RATE_LIMIT_BURST", 20),
+			KeyDailyLabels:     GetEnvInt("QUOTA_KEY_DAILY_LABELS", 0),
+			PrinterDailyLabels: positiveCounts(printerKeyed(GetEnvMap("QUOTA_PRINTER_DAILY_LABELS"))),
+			MaxQueuedJobs:      GetEnvInt("QUEUE_MAX_JOBS_PER_PRINTER", 1000),
+		},
+		LogConfig: LogConfig{
+			Level:      logLevel(GetEnv("LOG_LEVEL", "info")),
+			Format:     GetEnv("LOG_FORMAT", LogFormatText),
+			File:       GetEnv("LOG_FILE", ""),
+			MaxSizeMB:  GetEnvInt("LOG_MAX_SIZE_MB", 10),
+			MaxBackups: GetEnvInt("LOG_MAX_FILES", 5),
+			MaxAgeDays: GetEnvInt("LOG_MAX_AGE_DAYS", 0),
+		},
+	}
+
+	if err := cfg.PrinterConfig.validateLabelLanguages(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// validateLabelLanguages checks the default label language and every per
+// printer override against the label renderers.
+func (c PrinterConfig) validateLabelLanguages() error {
+	if _, err := label.ParseLanguage(c.LabelLanguage); err != nil {
+		return fmt.Errorf("invalid %sLABEL_LANGUAGE: %w", prefix, err)
+	}
+	for key, lang := range c.LabelLanguages {
+		if _, err := label.ParseLanguage(lang); err != nil {
+			return fmt.Errorf("invalid %sLABEL_LANGUAGES for printer %s: %w", prefix, key, err)
+		}
+	}
+	return nil
+}
+
+// statusDays parses "done=30,failed=90" into per status ages, or returns
+// fallback if the variable is unset.
+func statusDays(m map[string]string, fallback map[string]time.Duration) map[string]time.Duration {
+	if len(m) == 0 {
+		return fallback
+	}
+	ages := make(map[string]time.Duration, len(m))
+	for status, v := range m {
+		if days, err := strconv.Atoi(v); err == nil && days > 0 {
+			ages[status] = time.Duration(days) * 24 * time.Hour
+		}
+	}
+	return ages
+}
+
+// positiveCounts keeps the entries of m that are positive integers.
+func positiveCounts(m map[string]string) map[string]int {
+	counts := make(map[string]int, len(m))
+	for k, v := range m {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			counts[k] = n
+		}
+	}
+	return counts
+}
+
+// cronSchedule turns "off" into the empty schedule, since an empty
+// variable falls back to the default.
+func cronSchedule(expr string) string {
+	if strings.EqualFold(expr, "off") {
+		return ""
+	}
+	return expr
+}
+
+// listOr returns fallback if list is empty.
+func listOr(list []string, fallback ...string) []string {
+	if len(list) == 0 {
+		return fallback
+	}
+	return list
+}
+
+func hostname() string {
+	name, err := os.Hostname()
+	if err != nil || name == "" {
+		return "pos-printer"
+	}
+	return name
+}
+
+// defaultInstanceID names this process when INSTANCE_ID is not set. It is
+// the hostname, so a restarted service recovers the jobs its crashed run
+// left in progress; processes sharing a host must set INSTANCE_ID.
+func defaultInstanceID() string {
+	return hostname()
+}
+
+func printerKeyed(m map[string]string) map[string]string {
+	keyed := make(map[string]string, len(m))
+	for k, v := range m {
+		vid, pid, _ := strings.Cut(k, ":")
+		keyed[PrinterKey(vid, pid)] = v
+	}
+	return keyed
+}
+
+func printerSet(keys []string) map[string]bool {
+	set := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		vid, pid, _ := strings.Cut(k, ":")
+		set[PrinterKey(vid, pid)] = true
+	}
+	return set
+}
+
+func printerKeys(keys []string) []string {
+	normalized := make([]string, 0, len(keys))
+	for _, k := range keys {
+		vid, pid, _ := strings.Cut(k, ":")
+		normalized = append(normalized, PrinterKey(vid, pid))
+	}
+	return normalized
+}
+
+// logLevel lets POS_PRINTER_DEBUG=1 turn on debug logging whatever the
+// level is set to.
+func logLevel(level string) string {
+	if GetEnvInt("DEBUG", 0) == 1 {
+		return "debug"
 	}
+	return level
 }
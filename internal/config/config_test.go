@@ -0,0 +1,43 @@
+package config
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadLabelLanguages(t *testing.T) {
+	tests := []struct {
+		name      string
+		language  string // POS_PRINTER_LABEL_LANGUAGE
+		languages string // POS_PRINTER_LABEL_LANGUAGES
+		wantErr   string // "" if Load must succeed
+	}{
+		{name: "defaults"},
+		{name: "every renderer", language: "zpl", languages: "0x0a5f:0x0164=epl,0x1203:0x0230=dpl,0x0fe6:0x8800=tspl"},
+		{name: "any case", language: "ZPL", languages: "0x0a5f:0x0164= Epl "},
+		{name: "unknown default", language: "zlp", wantErr: `LABEL_LANGUAGE: unsupported label language "zlp"`},
+		{name: "unknown override", languages: "0x0a5f:0x0164=zpl,0x1203:0x0230=cpcl", wantErr: `printer 0x1203:0x0230: unsupported label language "cpcl"`},
+		{name: "empty override", languages: "0x0A5F:0x0164=", wantErr: "printer 0x0a5f:0x0164"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(prefix+"LABEL_LANGUAGE", tt.language)
+			t.Setenv(prefix+"LABEL_LANGUAGES", tt.languages)
+
+			cfg, err := Load()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("Load: %v", err)
+				}
+				if cfg == nil {
+					t.Fatal("Load returned no configuration")
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load error = %v, want one containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -1,10 +1,11 @@
 package config
 
 import (
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -15,7 +16,7 @@ func LoadEnv(filename string) {
 	absPath, _ := filepath.Abs(filename)
 
 	if err := godotenv.Load(absPath); err == nil {
-		log.Println("Environment variables loaded from", absPath)
+		slog.Info("Environment variables loaded", "path", absPath)
 	}
 }
 
@@ -34,3 +35,28 @@ func GetEnvInt(key string, fallback int) int {
 	}
 	return fallback
 }
+
+// GetEnvMap parses a comma separated list of key=value pairs,
+// e.g. "0x0a5f:0x0164=zpl,0x1203:0x0230=tspl".
+func GetEnvMap(key string) map[string]string {
+	m := map[string]string{}
+	for _, pair := range strings.Split(os.Getenv(prefix+key), ",") {
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			continue
+		}
+		m[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return m
+}
+
+// GetEnvList parses a comma separated list, skipping empty entries.
+func GetEnvList(key string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(prefix+key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,151 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"pos-printer/internal/model"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrClientCertTaken is returned when a client certificate is already
+// mapped to another key that is not revoked.
+var ErrClientCertTaken = errors.New("client certificate is already mapped to another API key")
+
+const apiKeyColumns = `id, name, prefix, scopes, printers, origins, clientCertCN, dailyLabelQuota, createdAt, lastUsedAt, revokedAt`
+
+func scanAPIKey(row rowScanner) (*model.APIKey, error) {
+	var key model.APIKey
+	var scopes, printers, origins string
+	var clientCertCN sql.NullString
+	var dailyLabelQuota sql.NullInt64
+	var lastUsedAt, revokedAt sql.NullTime
+
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &scopes, &printers, &origins, &clientCertCN, &dailyLabelQuota, &key.CreatedAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	key.Scopes = splitList(scopes)
+	key.Printers = splitList(printers)
+	key.Origins = splitList(origins)
+	key.ClientCertCN = clientCertCN.String
+	if dailyLabelQuota.Valid {
+		quota := int(dailyLabelQuota.Int64)
+		key.DailyLabelQuota = &quota
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return &key, nil
+}
+
+func queryAPIKeys(db querier, query string, args ...any) ([]*model.APIKey, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []*model.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// splitList parses the comma separated lists that scopes, printers and
+// origins are stored as.
+func splitList(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
+}
+
+// nullString stores an empty string as NULL.
+func nullString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// clientCertTaken maps a unique violation on api_keys_client_cert, the
+// only unique constraint a new key can break besides its random hash.
+func clientCertTaken(err error) error {
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique &&
+		strings.Contains(sqliteErr.Error(), "clientCertCN") {
+		return ErrClientCertTaken
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) && pgErr.Code == "23505" && pgErr.ConstraintName == "api_keys_client_cert" {
+		return ErrClientCertTaken
+	}
+	return err
+}
+
+// CreateAPIKey stores a key by its hash and returns its id.
+func (s *SQLite) CreateAPIKey(key *model.APIKey, hash string) (int64, error) {
+	now := time.Now()
+	res, err := s.db.Exec(
+		`INSERT INTO api_keys (name, prefix, hash, scopes, printers, origins, clientCertCN, dailyLabelQuota, createdAt)
+		 VALUES (?,?,?,?,?,?,?,?,?)`,
+		key.Name, key.Prefix, hash, strings.Join(key.Scopes, ","), strings.Join(key.Printers, ","),
+		strings.Join(key.Origins, ","), nullString(key.ClientCertCN), key.DailyLabelQuota, sqliteTime(&now),
+	)
+	if err != nil {
+		return 0, clientCertTaken(err)
+	}
+	return res.LastInsertId()
+}
+
+func (s *SQLite) FetchAPIKey(id string) (*model.APIKey, error) {
+	return scanAPIKey(s.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`, id))
+}
+
+// FetchAPIKeyByHash returns the key with the given hash, or sql.ErrNoRows
+// if there is none or it was revoked.
+func (s *SQLite) FetchAPIKeyByHash(hash string) (*model.APIKey, error) {
+	return scanAPIKey(s.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE hash = ? AND revokedAt IS NULL`, hash))
+}
+
+// FetchAPIKeyByClientCert returns the key a client certificate with the
+// given common name authenticates as, or sql.ErrNoRows if there is none or
+// it was revoked.
+func (s *SQLite) FetchAPIKeyByClientCert(cn string) (*model.APIKey, error) {
+	return scanAPIKey(s.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE clientCertCN = ? AND revokedAt IS NULL`, cn))
+}
+
+func (s *SQLite) ListAPIKeys() ([]*model.APIKey, error) {
+	return queryAPIKeys(s.db, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY id`)
+}
+
+// RevokeAPIKey stops a key from authenticating. It returns sql.ErrNoRows
+// if the key does not exist or is already revoked.
+func (s *SQLite) RevokeAPIKey(id string) error {
+	res, err := s.db.Exec(`UPDATE api_keys SET revokedAt = DATETIME('now') WHERE id = ? AND revokedAt IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// TouchAPIKey records that a key was used.
+func (s *SQLite) TouchAPIKey(id int64) error {
+	_, err := s.db.Exec(`UPDATE api_keys SET lastUsedAt = DATETIME('now') WHERE id = ?`, id)
+	return err
+}
@@ -0,0 +1,131 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"pos-printer/internal/model"
+	"strings"
+	"time"
+)
+
+const auditColumns = `id, at, source, action, apiKeyId, apiKeyName, ip, userAgent, osUser, targetType, targetId, printerKey, beforeState, afterState`
+
+// Bounds on the entries one query returns.
+const (
+	DefaultAuditLimit = 100
+	MaxAuditLimit     = 10000
+)
+
+func scanAuditEntry(row rowScanner) (*model.AuditEntry, error) {
+	var e model.AuditEntry
+	var apiKeyName, ip, userAgent, osUser, targetType, targetID, printerKey, before, after sql.NullString
+
+	err := row.Scan(&e.ID, &e.At, &e.Source, &e.Action, &e.APIKeyID, &apiKeyName, &ip, &userAgent, &osUser,
+		&targetType, &targetID, &printerKey, &before, &after)
+	if err != nil {
+		return nil, err
+	}
+	e.APIKeyName, e.IP, e.UserAgent, e.OSUser = apiKeyName.String, ip.String, userAgent.String, osUser.String
+	e.TargetType, e.TargetID, e.PrinterKey = targetType.String, targetID.String, printerKey.String
+	if before.Valid {
+		e.Before = json.RawMessage(before.String)
+	}
+	if after.Valid {
+		e.After = json.RawMessage(after.String)
+	}
+	return &e, nil
+}
+
+// auditQuery builds the query for ListAuditEntries, newest first, with ?
+// placeholders. timeArg converts times to the driver's representation.
+func auditQuery(f model.AuditFilter, timeArg func(time.Time) any) (string, []any) {
+	var conds []string
+	var args []any
+	add := func(cond string, arg any) {
+		conds = append(conds, cond)
+		args = append(args, arg)
+	}
+	if f.Action != "" {
+		add(`action = ?`, f.Action)
+	}
+	if f.Source != "" {
+		add(`source = ?`, f.Source)
+	}
+	if f.APIKeyID != nil {
+		add(`apiKeyId = ?`, *f.APIKeyID)
+	}
+	if f.TargetType != "" {
+		add(`targetType = ?`, f.TargetType)
+	}
+	if f.TargetID != "" {
+		add(`targetId = ?`, f.TargetID)
+	}
+	if f.PrinterKey != "" {
+		add(`printerKey = ?`, f.PrinterKey)
+	}
+	if f.From != nil {
+		add(`at >= ?`, timeArg(*f.From))
+	}
+	if f.To != nil {
+		add(`at < ?`, timeArg(*f.To))
+	}
+	if f.BeforeID > 0 {
+		add(`id < ?`, f.BeforeID)
+	}
+
+	limit := f.Limit
+	if limit <= 0 {
+		limit = DefaultAuditLimit
+	}
+	limit = min(limit, MaxAuditLimit)
+
+	query := `SELECT ` + auditColumns + ` FROM audit_log`
+	if len(conds) > 0 {
+		query += ` WHERE ` + strings.Join(conds, ` AND `)
+	}
+	return query + ` ORDER BY id DESC LIMIT ?`, append(args, limit)
+}
+
+func queryAuditEntries(db querier, query string, args ...any) ([]*model.AuditEntry, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []*model.AuditEntry{}
+	for rows.Next() {
+		e, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// nullJSON stores an empty snapshot as NULL.
+func nullJSON(raw json.RawMessage) any {
+	if len(raw) == 0 {
+		return nil
+	}
+	return string(raw)
+}
+
+// AppendAuditEntry adds an entry, stamped with the current time.
+func (s *SQLite) AppendAuditEntry(e *model.AuditEntry) error {
+	now := time.Now()
+	_, err := s.db.Exec(
+		`INSERT INTO audit_log (at, source, action, apiKeyId, apiKeyName, ip, userAgent, osUser, targetType, targetId, printerKey, beforeState, afterState)
+		 VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		sqliteTime(&now), e.Source, e.Action, e.APIKeyID, nullString(e.APIKeyName), nullString(e.IP), nullString(e.UserAgent), nullString(e.OSUser),
+		nullString(e.TargetType), nullString(e.TargetID), nullString(e.PrinterKey), nullJSON(e.Before), nullJSON(e.After),
+	)
+	return err
+}
+
+// ListAuditEntries returns the entries matching f, newest first.
+func (s *SQLite) ListAuditEntries(f model.AuditFilter) ([]*model.AuditEntry, error) {
+	query, args := auditQuery(f, func(t time.Time) any { return sqliteTime(&t) })
+	return queryAuditEntries(s.db, query, args...)
+}
@@ -0,0 +1,335 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"pos-printer/internal/config"
+	"pos-printer/internal/model"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-sqlite3"
+)
+
+// ErrBackupUnsupported is returned by stores that leave backups to the
+// database server.
+var ErrBackupUnsupported = errors.New("backups are only supported for SQLite, back up PostgreSQL with pg_dump")
+
+// ErrDatabaseInUse is returned when restoring a database that a running
+// process has open.
+var ErrDatabaseInUse = errors.New("the database is in use, stop the service first")
+
+// backupTimeLayout names backups to the millisecond; two backups in the
+// same millisecond are a millisecond apart.
+const backupTimeLayout = "20060102-150405.000"
+
+// lockSuffix names the lock file next to the database.
+const lockSuffix = ".lock"
+
+var backupFileName = regexp.MustCompile(`^pos-printer-(\d{8}-\d{6}\.\d{3})\.sqlite\.db$`)
+
+// CreateBackup snapshots the database into the backup directory with
+// SQLite's online backup API, which copies a consistent state while jobs
+// keep being written. The copy must pass an integrity check before it is
+// kept, and the oldest backups beyond BackupConfig.Keep are deleted.
+func (s *SQLite) CreateBackup() (*model.Backup, error) {
+	dir := s.cfg.BackupConfig.Dir
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	f, err := os.CreateTemp(dir, "pos-printer-*.tmp")
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	tmp := f.Name()
+	defer os.Remove(tmp)
+	if err := s.backupTo(tmp); err != nil {
+		return nil, fmt.Errorf("backup failed: %w", err)
+	}
+	if err := checkIntegrity(tmp); err != nil {
+		return nil, fmt.Errorf("backup failed its integrity check: %w", err)
+	}
+
+	// Linking fails rather than replace a backup taken in the same
+	// millisecond, which then moves to the next one.
+	now := time.Now().Truncate(time.Millisecond)
+	var path string
+	for {
+		path = filepath.Join(dir, "pos-printer-"+now.Format(backupTimeLayout)+".sqlite.db")
+		err := os.Link(tmp, path)
+		if err == nil {
+			break
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		now = now.Add(time.Millisecond)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := pruneBackups(dir, s.cfg.BackupConfig.Keep); err != nil {
+		slog.Error("Error deleting old backups", "error", err)
+	}
+	return &model.Backup{Name: filepath.Base(path), Size: info.Size(), CreatedAt: now, Path: path}, nil
+}
+
+func (s *SQLite) backupTo(dest string) error {
+	destDB, err := sql.Open("sqlite3", dest)
+	if err != nil {
+		return err
+	}
+	defer destDB.Close()
+
+	ctx := context.Background()
+	destConn, err := destDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer destConn.Close()
+	srcConn, err := s.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer srcConn.Close()
+
+	return destConn.Raw(func(destDriverConn any) error {
+		return srcConn.Raw(func(srcDriverConn any) error {
+			backup, err := destDriverConn.(*sqlite3.SQLiteConn).Backup("main", srcDriverConn.(*sqlite3.SQLiteConn), "main")
+			if err != nil {
+				return err
+			}
+			if _, err := backup.Step(-1); err != nil {
+				backup.Finish()
+				return err
+			}
+			return backup.Finish()
+		})
+	})
+}
+
+// CreateBackup is not supported for PostgreSQL.
+func (p *Postgres) CreateBackup() (*model.Backup, error) {
+	return nil, ErrBackupUnsupported
+}
+
+// ListBackups returns the backups in dir, newest first.
+func ListBackups(dir string) ([]model.Backup, error) {
+	entries, err := os.ReadDir(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return []model.Backup{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	backups := []model.Backup{}
+	for _, entry := range entries {
+		m := backupFileName.FindStringSubmatch(entry.Name())
+		if m == nil || entry.IsDir() {
+			continue
+		}
+		created, err := time.ParseInLocation(backupTimeLayout, m[1], time.Local)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return nil, err
+		}
+		backups = append(backups, model.Backup{
+			Name:      entry.Name(),
+			Size:      info.Size(),
+			CreatedAt: created,
+			Path:      filepath.Join(dir, entry.Name()),
+		})
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].Name > backups[j].Name })
+	return backups, nil
+}
+
+// FindBackup resolves a backup given by name in dir, as "latest", or as a
+// path to any SQLite file.
+func FindBackup(dir string, name string) (*model.Backup, error) {
+	if name == "latest" || backupFileName.MatchString(name) {
+		backups, err := ListBackups(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range backups {
+			if name == "latest" || b.Name == name {
+				return &b, nil
+			}
+		}
+		return nil, fmt.Errorf("no backup %s in %s", name, dir)
+	}
+
+	info, err := os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return &model.Backup{Name: filepath.Base(name), Size: info.Size(), CreatedAt: info.ModTime(), Path: name}, nil
+}
+
+func pruneBackups(dir string, keep int) error {
+	if keep <= 0 {
+		return nil
+	}
+	backups, err := ListBackups(dir)
+	if err != nil {
+		return err
+	}
+	for _, b := range backups[min(keep, len(backups)):] {
+		if err := os.Remove(b.Path); err != nil {
+			return err
+		}
+		slog.Info("Deleted old backup", "backup", b.Name)
+	}
+	return nil
+}
+
+// checkIntegrity runs PRAGMA integrity_check on a database file.
+func checkIntegrity(path string) error {
+	db, err := sql.Open("sqlite3", "file:"+path+"?_busy_timeout=5000")
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	rows, err := db.Query(`PRAGMA integrity_check`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return err
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(problems) > 0 {
+		if len(problems) > 3 {
+			problems = append(problems[:3], fmt.Sprintf("and %d more problems", len(problems)-3))
+		}
+		return errors.New(strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// CheckSQLite runs PRAGMA integrity_check on the database before it is
+// opened for use. If the database is damaged and BackupConfig.AutoRestore
+// is on, it is replaced by the newest backup that passes the same check,
+// and the name of that backup is returned.
+func CheckSQLite(cfg *config.Config) (string, error) {
+	path, err := filepath.Abs(cfg.DBConfig.SQLitePath)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(path); errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+
+	checkErr := checkIntegrity(path)
+	if checkErr == nil {
+		return "", nil
+	}
+	if !cfg.BackupConfig.AutoRestore {
+		return "", fmt.Errorf("database failed its integrity check: %w", checkErr)
+	}
+	slog.Error("Database failed its integrity check", "error", checkErr)
+
+	backups, err := ListBackups(cfg.BackupConfig.Dir)
+	if err != nil {
+		return "", err
+	}
+	for _, b := range backups {
+		if err := RestoreSQLite(cfg, b.Path); err != nil {
+			slog.Warn("Not restoring backup", "backup", b.Name, "error", err)
+			continue
+		}
+		return b.Name, nil
+	}
+	return "", fmt.Errorf("database failed its integrity check and there is no good backup in %s: %w", cfg.BackupConfig.Dir, checkErr)
+}
+
+// RestoreSQLite replaces the database file with a backup, which must pass
+// an integrity check first. It returns ErrDatabaseInUse while any process
+// has the database open. The replaced database and its WAL are kept next
+// to it with a .replaced-<time> suffix, in case they hold jobs worth
+// saving.
+func RestoreSQLite(cfg *config.Config, backupPath string) error {
+	if err := checkIntegrity(backupPath); err != nil {
+		return fmt.Errorf("backup failed its integrity check: %w", err)
+	}
+	path, err := filepath.Abs(cfg.DBConfig.SQLitePath)
+	if err != nil {
+		return err
+	}
+	lock, err := lockFile(path+lockSuffix, true)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	// Copy first, so a failed copy leaves the database in place.
+	tmp := path + ".restoring"
+	if err := copyFile(backupPath, tmp); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to copy backup: %w", err)
+	}
+
+	replaced := path + ".replaced-" + time.Now().Format(backupTimeLayout)
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.Rename(path+suffix, replaced+suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			os.Remove(tmp)
+			return fmt.Errorf("failed to move the database aside: %w", err)
+		}
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	slog.Warn("Restored the database from a backup", "path", path, "backup", backupPath, "replaced", replaced)
+	return nil
+}
+
+func copyFile(src, dest string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
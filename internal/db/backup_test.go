@@ -0,0 +1,135 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestCreateBackupNamesAreUnique(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.BackupConfig.Dir = t.TempDir()
+	cfg.BackupConfig.Keep = 0
+	store := newTestSQLite(t, cfg)
+
+	names := map[string]bool{}
+	for i := 0; i < 5; i++ {
+		backup, err := store.CreateBackup()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if names[backup.Name] {
+			t.Errorf("backup %s was taken twice", backup.Name)
+		}
+		names[backup.Name] = true
+	}
+	backups, err := ListBackups(cfg.BackupConfig.Dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 5 {
+		t.Errorf("listed %d backups, want 5", len(backups))
+	}
+	if tmp, _ := filepath.Glob(filepath.Join(cfg.BackupConfig.Dir, "*.tmp")); len(tmp) > 0 {
+		t.Errorf("temporary files left behind: %v", tmp)
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	dir := t.TempDir()
+	names := []string{
+		"pos-printer-20250102-030000.000.sqlite.db",
+		"pos-printer-20241231-030000.000.sqlite.db",
+		"pos-printer-20250102-030000.001.sqlite.db",
+		"pos-printer-20250101-030000.000.sqlite.db",
+		"notes.txt",
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := pruneBackups(dir, 2); err != nil {
+		t.Fatal(err)
+	}
+	backups, err := ListBackups(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []string
+	for _, b := range backups {
+		kept = append(kept, b.Name)
+	}
+	want := []string{"pos-printer-20250102-030000.001.sqlite.db", "pos-printer-20250102-030000.000.sqlite.db"}
+	if !slices.Equal(kept, want) {
+		t.Errorf("kept %v, want the newest first %v", kept, want)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "notes.txt")); err != nil {
+		t.Errorf("a file that is not a backup was touched: %v", err)
+	}
+}
+
+func TestCheckSQLiteRestoresDamagedDatabase(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.BackupConfig.Dir = t.TempDir()
+	store := newTestSQLite(t, cfg)
+	ids := enqueueTestJobs(t, store, 2, 1)
+	if _, err := store.CreateBackup(); err != nil {
+		t.Fatal(err)
+	}
+	later := enqueueTestJobs(t, store, 1, 1)
+	store.Close()
+
+	// A power cut leaves garbage where the database was.
+	garbage := make([]byte, 8192)
+	for i := range garbage {
+		garbage[i] = byte(i)
+	}
+	if err := os.WriteFile(cfg.DBConfig.SQLitePath, garbage, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.BackupConfig.IntegrityCheck = true
+	cfg.BackupConfig.AutoRestore = false
+	if _, err := NewSQLite(cfg); err == nil {
+		t.Fatal("opened a damaged database without auto restore")
+	}
+
+	cfg.BackupConfig.AutoRestore = true
+	store = newTestSQLite(t, cfg)
+	for _, id := range ids {
+		if _, err := store.FetchBarcodeJob(strconv.Itoa(id)); err != nil {
+			t.Errorf("job %d from the backup: %v", id, err)
+		}
+	}
+	if _, err := store.FetchBarcodeJob(strconv.Itoa(later[0])); err == nil {
+		t.Errorf("job %d enqueued after the backup survived the restore", later[0])
+	}
+	if replaced, _ := filepath.Glob(cfg.DBConfig.SQLitePath + ".replaced-*"); len(replaced) != 1 {
+		t.Errorf("damaged database kept as %v, want one file", replaced)
+	}
+}
+
+func TestRestoreSQLite(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.BackupConfig.Dir = t.TempDir()
+	store := newTestSQLite(t, cfg)
+	backup, err := store.CreateBackup()
+	if err != nil {
+		t.Fatal(err)
+	}
+	enqueueTestJobs(t, store, 1, 1)
+
+	store.Close()
+	if err := RestoreSQLite(cfg, backup.Path); err != nil {
+		t.Fatal(err)
+	}
+
+	store = newTestSQLite(t, cfg)
+	if job, err := store.FetchBarcodeJob("1"); err == nil {
+		t.Errorf("job %d enqueued after the backup survived the restore", job.ID)
+	}
+}
@@ -2,48 +2,113 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
-	"fmt"
+	"log/slog"
 	"pos-printer/internal/model"
+	"strings"
+	"time"
 )
 
-func (s *SQLite) FetchBarcodeJob(id string) (*model.BarcodeJob, error) {
-	var job model.BarcodeJob
-
-	query := `SELECT 
-	id, vid, pid, sizeX, sizeY, direction, topText, barcodeData, 
-    printCount, labelGapLength, labelGapOffset, status, attempts, createdAt, updatedAt
-    FROM barcode_jobs
-    WHERE id = ?`
+const barcodeJobColumns = `id, vid, pid, sizeX, sizeY, direction, topText, barcodeData, 
+    printCount, labelGapLength, labelGapOffset, status, attempts, createdAt, updatedAt,
+    leaseOwner, leaseExpiresAt, priority, notBefore, printedCount, serial, apiKeyId, requestId`
 
-	row := s.db.QueryRow(query, id)
+func scanBarcodeJob(row rowScanner) (*model.BarcodeJob, error) {
+	var job model.BarcodeJob
+	var leaseOwner, serial, requestID sql.NullString
+	var leaseExpiresAt, notBefore sql.NullTime
+	var apiKeyID sql.NullInt64
 
 	err := row.Scan(
 		&job.ID, &job.VID, &job.PID, &job.SizeX, &job.SizeY,
 		&job.Direction, &job.TopText, &job.BarcodeData,
 		&job.PrintCount, &job.LabelGapLength, &job.LabelGapOffset,
 		&job.Status, &job.Attempts, &job.CreatedAt, &job.UpdatedAt,
+		&leaseOwner, &leaseExpiresAt, &job.Priority, &notBefore, &job.PrintedCount, &serial,
+		&apiKeyID, &requestID,
 	)
-
 	if err != nil {
-		fmt.Println("Error fetching barcode job", err)
+		return nil, err
+	}
+
+	job.LeaseOwner = leaseOwner.String
+	job.RequestID = requestID.String
+	if leaseExpiresAt.Valid {
+		job.LeaseExpiresAt = &leaseExpiresAt.Time
+	}
+	if notBefore.Valid {
+		job.NotBefore = &notBefore.Time
+	}
+	if apiKeyID.Valid {
+		job.APIKeyID = &apiKeyID.Int64
+	}
+	if err := scanSerial(serial, &job); err != nil {
 		return nil, err
 	}
 	return &job, nil
 }
 
-func (s *SQLite) FetchBarcodeAndUpdateStatusToInProgress() (*model.BarcodeJob, error) {
+func (s *SQLite) FetchBarcodeJob(id string) (*model.BarcodeJob, error) {
+	query := `SELECT ` + barcodeJobColumns + `
+    FROM barcode_jobs
+    WHERE id = ?`
+
+	job, err := scanBarcodeJob(s.db.QueryRow(query, id))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.Error("Error fetching barcode job", "job_id", id, "error", err)
+		}
+		return nil, err
+	}
+	return job, nil
+}
 
+// ClaimBarcodeJob atomically moves the next claimable pending job to
+// in_progress, leased to this instance, and returns it, or nil if there
+// is none. Selecting and updating in one statement guarantees that two
+// workers can never claim the same job.
+//
+// Every printer has its own queue, ordered by priority and then age, and
+// prints one job at a time. The next job is taken from the queue with the
+// most urgent head; ties go to the printer that has waited longest since
+// its last claim, so one busy printer cannot starve the others. With
+// WorkerConfig.Printers set, only jobs for those printers are claimed.
+func (s *SQLite) ClaimBarcodeJob() (*model.BarcodeJob, error) {
+	printers, printerArgs := printerFilter(s.cfg.WorkerConfig.Printers, func(int) string { return "?" })
 	query := `
-		SELECT id, vid, pid, sizeX, sizeY, direction, topText, barcodeData, printCount, labelGapLength, labelGapOffset, attempts
-		FROM barcode_jobs WHERE status = ? AND attempts < ? ORDER BY createdAt LIMIT 1`
+		UPDATE barcode_jobs
+		SET status = ?, attempts = attempts + 1, updatedAt = CURRENT_TIMESTAMP,
+			leaseOwner = ?, leaseExpiresAt = DATETIME('now', ?),
+			claimedAt = STRFTIME('%Y-%m-%d %H:%M:%f', 'now')
+		WHERE id = (
+			SELECT j.id FROM barcode_jobs j
+			WHERE j.status = ? AND j.attempts < ?
+			AND (j.notBefore IS NULL OR j.notBefore <= DATETIME('now'))
+			AND NOT EXISTS (
+				SELECT 1 FROM barcode_jobs b
+				WHERE b.printerKey = j.printerKey AND b.status = ?
+			)` + printers + `
+			ORDER BY j.priority DESC,
+				(SELECT MAX(c.claimedAt) FROM barcode_jobs c WHERE c.printerKey = j.printerKey),
+				j.createdAt, j.id
+			LIMIT 1
+		) AND status = ?
+		RETURNING id, vid, pid, sizeX, sizeY, direction, topText, barcodeData, printCount, labelGapLength, labelGapOffset, status, attempts, priority, printedCount, serial, apiKeyId, requestId`
 
-	row := s.db.QueryRow(query,
+	args := []any{
+		s.cfg.WorkerConfig.JobStatus.StatusInProgress,
+		s.cfg.WorkerConfig.InstanceID,
+		s.leaseModifier(),
 		s.cfg.WorkerConfig.JobStatus.StatusPending,
 		s.cfg.WorkerConfig.MaxJobAttempts,
-	)
+		s.cfg.WorkerConfig.JobStatus.StatusInProgress,
+	}
+	args = append(append(args, printerArgs...), s.cfg.WorkerConfig.JobStatus.StatusPending)
+	row := s.db.QueryRow(query, args...)
 
 	var job model.BarcodeJob
+	var serial, requestID sql.NullString
 
 	err := row.Scan(
 		&job.ID,
@@ -57,7 +122,13 @@ func (s *SQLite) FetchBarcodeAndUpdateStatusToInProgress() (*model.BarcodeJob, e
 		&job.PrintCount,
 		&job.LabelGapLength,
 		&job.LabelGapOffset,
+		&job.Status,
 		&job.Attempts,
+		&job.Priority,
+		&job.PrintedCount,
+		&serial,
+		&job.APIKeyID,
+		&requestID,
 	)
 
 	if err != nil {
@@ -66,14 +137,53 @@ func (s *SQLite) FetchBarcodeAndUpdateStatusToInProgress() (*model.BarcodeJob, e
 		}
 		return nil, err
 	}
+	job.RequestID = requestID.String
+	if err := scanSerial(serial, &job); err != nil {
+		return nil, err
+	}
+
+	return &job, nil
+}
 
-	err = s.UpdateBarcodeJobAttempts(job.ID)
+// NextBarcodeJobDue returns when the earliest held pending job becomes
+// claimable, or nil if no job is held.
+func (s *SQLite) NextBarcodeJobDue() (*time.Time, error) {
+	var next sql.NullString
+	err := s.db.QueryRow(
+		`SELECT MIN(notBefore) FROM barcode_jobs
+		 WHERE status = ? AND notBefore > DATETIME('now')`,
+		s.cfg.WorkerConfig.JobStatus.StatusPending,
+	).Scan(&next)
+	if err != nil || !next.Valid {
+		return nil, err
+	}
+	t, err := time.Parse(sqliteTimeLayout, next.String)
 	if err != nil {
 		return nil, err
 	}
+	return &t, nil
+}
 
-	job.Status = s.cfg.WorkerConfig.JobStatus.StatusInProgress
-	job.Attempts = job.Attempts + 1
+// printerFilter restricts a claim to the given printer keys. placeholder
+// returns the parameter marker for the n-th key.
+func printerFilter(keys []string, placeholder func(n int) string) (string, []any) {
+	if len(keys) == 0 {
+		return "", nil
+	}
+	markers := make([]string, len(keys))
+	args := make([]any, len(keys))
+	for i, key := range keys {
+		markers[i] = placeholder(i)
+		args[i] = key
+	}
+	return `
+			AND j.printerKey IN (` + strings.Join(markers, ",") + `)`, args
+}
 
-	return &job, nil
+func scanSerial(serial sql.NullString, job *model.BarcodeJob) error {
+	if !serial.Valid || serial.String == "" {
+		return nil
+	}
+	job.Serial = &model.Serial{}
+	return json.Unmarshal([]byte(serial.String), job.Serial)
 }
@@ -0,0 +1,196 @@
+package db
+
+import (
+	"fmt"
+	"path/filepath"
+	"pos-printer/internal/config"
+	"pos-printer/internal/model"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testConfig returns the default configuration for a SQLite database in a
+// temporary directory, whatever the environment of the test run sets.
+func testConfig(t *testing.T) *config.Config {
+	t.Helper()
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DBConfig.Driver = config.DriverSQLite
+	cfg.DBConfig.SQLitePath = filepath.Join(t.TempDir(), "db.sqlite")
+	cfg.DBConfig.Migrate = true
+	cfg.BackupConfig.IntegrityCheck = false
+	cfg.WorkerConfig.Printers = nil
+	return cfg
+}
+
+// newTestSQLite opens a migrated database for cfg, closed with the test.
+func newTestSQLite(t *testing.T, cfg *config.Config) *SQLite {
+	t.Helper()
+	store, err := NewSQLite(cfg)
+	if err != nil {
+		t.Fatalf("NewSQLite: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// enqueueTestJobs enqueues n one-label jobs spread over the given number
+// of printers and returns their ids.
+func enqueueTestJobs(t *testing.T, store JobStore, n, printers int) []int {
+	t.Helper()
+	ids := make([]int, n)
+	for i := range ids {
+		id, err := store.EnqueueBarcodeJob(model.PrintBarcodeRequest{
+			VID: "0x0fe6", PID: fmt.Sprintf("0x%04x", i%printers), SizeX: 45, SizeY: 35,
+			BarcodeData: strconv.Itoa(i), PrintCount: 1,
+		})
+		if err != nil {
+			t.Fatalf("EnqueueBarcodeJob: %v", err)
+		}
+		ids[i] = int(id)
+	}
+	return ids
+}
+
+// claimAll claims and completes jobs until the queue stays empty, and
+// returns the ids it claimed. work, if set, runs on each job before it is
+// completed. It stops at the first error, or with one if the queue is not
+// empty by deadline.
+func claimAll(store JobStore, done string, deadline time.Time, work func(job *model.BarcodeJob) error) ([]int, error) {
+	var claimed []int
+	for idle := 0; idle < 20; {
+		if time.Now().After(deadline) {
+			return claimed, fmt.Errorf("queue not drained after %d claims", len(claimed))
+		}
+		job, err := store.ClaimBarcodeJob()
+		if err != nil {
+			return claimed, fmt.Errorf("ClaimBarcodeJob: %w", err)
+		}
+		if job == nil {
+			idle++
+			time.Sleep(5 * time.Millisecond)
+			continue
+		}
+		idle = 0
+		claimed = append(claimed, job.ID)
+		if work != nil {
+			if err := work(job); err != nil {
+				return claimed, err
+			}
+		}
+		if err := store.CompleteBarcodeJob(job.ID, done); err != nil {
+			return claimed, fmt.Errorf("CompleteBarcodeJob(%d): %w", job.ID, err)
+		}
+	}
+	return claimed, nil
+}
+
+func TestClaimBarcodeJobConcurrently(t *testing.T) {
+	forEachDriver(t, testClaimBarcodeJobConcurrently)
+}
+
+func testClaimBarcodeJobConcurrently(t *testing.T, cfg *config.Config) {
+	const (
+		jobs     = 300
+		printers = 8
+		stores   = 3 // separate connection pools, as separate processes have
+		workers  = 6 // per store
+	)
+
+	ids := enqueueTestJobs(t, newTestStore(t, cfg), jobs, printers)
+
+	deadline := time.Now().Add(time.Minute)
+	errs := make(chan error, stores*workers)
+	claims := make(chan []int, stores*workers)
+	var wg sync.WaitGroup
+	for s := 0; s < stores; s++ {
+		storeCfg := *cfg
+		storeCfg.WorkerConfig.InstanceID = fmt.Sprintf("test-%d", s)
+		store := newTestStore(t, &storeCfg)
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				claimed, err := claimAll(store, cfg.WorkerConfig.JobStatus.StatusDone, deadline, nil)
+				if err != nil {
+					errs <- err
+				}
+				claims <- claimed
+			}()
+		}
+	}
+	wg.Wait()
+	close(errs)
+	close(claims)
+
+	for err := range errs {
+		t.Error(err)
+	}
+	count := map[int]int{}
+	for claimed := range claims {
+		for _, id := range claimed {
+			count[id]++
+		}
+	}
+	for _, id := range ids {
+		switch n := count[id]; {
+		case n == 0:
+			t.Errorf("job %d was never claimed", id)
+		case n > 1:
+			t.Errorf("job %d was claimed %d times", id, n)
+		}
+	}
+	if len(count) != len(ids) {
+		t.Errorf("claimed %d distinct jobs, want %d", len(count), len(ids))
+	}
+}
+
+func TestClaimBarcodeJobOrder(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, cfg *config.Config) {
+		store := newTestStore(t, cfg)
+		enqueue := func(name, pid string, priority int) {
+			t.Helper()
+			_, err := store.EnqueueBarcodeJob(model.PrintBarcodeRequest{
+				VID: "0x0fe6", PID: pid, SizeX: 45, SizeY: 35,
+				BarcodeData: name, PrintCount: 1, Priority: priority,
+			})
+			if err != nil {
+				t.Fatalf("EnqueueBarcodeJob: %v", err)
+			}
+		}
+		// Printer A has a backlog, B one job; an urgent reprint for A and an
+		// overnight batch for B arrive last.
+		enqueue("a1", "0x000a", 0)
+		enqueue("a2", "0x000a", 0)
+		enqueue("a3", "0x000a", 0)
+		enqueue("b1", "0x000b", 0)
+		enqueue("a-urgent", "0x000a", 5)
+		enqueue("b-batch", "0x000b", -5)
+
+		var order []string
+		for {
+			job, err := store.ClaimBarcodeJob()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if job == nil {
+				break
+			}
+			order = append(order, job.BarcodeData)
+			if err := store.CompleteBarcodeJob(job.ID, cfg.WorkerConfig.JobStatus.StatusDone); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// Priority first; then the printer that has waited longest, so B
+		// gets its turn before A's backlog; then order of arrival.
+		want := []string{"a-urgent", "b1", "a1", "a2", "a3", "b-batch"}
+		if !slices.Equal(order, want) {
+			t.Errorf("claimed %v, want %v", order, want)
+		}
+	})
+}
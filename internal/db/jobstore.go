@@ -0,0 +1,136 @@
+package db
+
+import (
+	"fmt"
+	"log/slog"
+	"pos-printer/internal/config"
+	"pos-printer/internal/model"
+	"time"
+)
+
+// JobStore is the job database, shared by the API and the workers. SQLite
+// keeps it in a file next to a single print server; PostgreSQL lets a
+// central service and several print servers work one queue.
+type JobStore interface {
+	Close() error
+
+	EnqueueBarcodeJob(req model.PrintBarcodeRequest) (int64, error)
+	FetchBarcodeJob(id string) (*model.BarcodeJob, error)
+	UpdateBarcodeJobStatus(jobID int, status string) error
+	ResolveBarcodeJob(id string, status string) error
+	CancelBarcodeJob(id string) error
+	RetryBarcodeJob(id string) error
+
+	BarcodeJobReady() <-chan struct{}
+	ClaimBarcodeJob() (*model.BarcodeJob, error)
+	RenewBarcodeJobLease(jobID int) error
+	UpdateBarcodeJobProgress(jobID int, printedCount int) error
+	CompleteBarcodeJob(jobID int, status string) error
+	UrgentBarcodeJobWaiting(printerKey string, priority int) (bool, error)
+	YieldBarcodeJob(jobID int) error
+	RecoverExpiredBarcodeJobs() ([]int, error)
+	RecoverOrphanedBarcodeJobs() ([]int, error)
+	NextBarcodeJobDue() (*time.Time, error)
+
+	KeyLabelsSince(apiKeyID int64, since time.Time) (int, error)
+	PrinterLabelsSince(printerKey string, since time.Time) (int, error)
+	QueuedBarcodeJobs(printerKey string) (int, error)
+
+	CreateBarcodeSchedule(sched *model.BarcodeSchedule) (int64, error)
+	UpdateBarcodeSchedule(sched *model.BarcodeSchedule) error
+	DeleteBarcodeSchedule(id string) error
+	FetchBarcodeSchedule(id string) (*model.BarcodeSchedule, error)
+	ListBarcodeSchedules() ([]*model.BarcodeSchedule, error)
+	DueBarcodeSchedules(now time.Time) ([]*model.BarcodeSchedule, error)
+	NextBarcodeScheduleRun() (*time.Time, error)
+	FireBarcodeSchedule(sched *model.BarcodeSchedule, job model.PrintBarcodeRequest, nextRunAt time.Time) (int64, bool, error)
+	SkipBarcodeSchedule(sched *model.BarcodeSchedule, nextRunAt time.Time, disable bool) (bool, error)
+
+	BarcodeJobsToPurge(status string, maxAge time.Duration, keep int, limit int) ([]*model.BarcodeJob, error)
+	DeleteBarcodeJobs(status string, ids []int) (int64, error)
+	Optimize() error
+	CreateBackup() (*model.Backup, error)
+
+	CreateAPIKey(key *model.APIKey, hash string) (int64, error)
+	FetchAPIKey(id string) (*model.APIKey, error)
+	FetchAPIKeyByHash(hash string) (*model.APIKey, error)
+	FetchAPIKeyByClientCert(cn string) (*model.APIKey, error)
+	ListAPIKeys() ([]*model.APIKey, error)
+	RevokeAPIKey(id string) error
+	TouchAPIKey(id int64) error
+
+	AppendAuditEntry(e *model.AuditEntry) error
+	ListAuditEntries(f model.AuditFilter) ([]*model.AuditEntry, error)
+
+	MigrationStatus() ([]MigrationStatus, error)
+	MigrateUp() ([]Migration, error)
+	MigrateDown(steps int) ([]Migration, error)
+}
+
+var (
+	_ JobStore = (*SQLite)(nil)
+	_ JobStore = (*Postgres)(nil)
+)
+
+// NewJobStore opens the configured database and brings its schema up to
+// date, or with migration disabled, checks that it is.
+func NewJobStore(cfg *config.Config) (JobStore, error) {
+	switch cfg.DBConfig.Driver {
+	case config.DriverSQLite:
+		return asJobStore(NewSQLite(cfg))
+	case config.DriverPostgres:
+		return asJobStore(NewPostgres(cfg))
+	}
+	return nil, fmt.Errorf("unknown database driver %q", cfg.DBConfig.Driver)
+}
+
+// OpenJobStore opens the configured database without touching its schema.
+func OpenJobStore(cfg *config.Config) (JobStore, error) {
+	switch cfg.DBConfig.Driver {
+	case config.DriverSQLite:
+		return asJobStore(OpenSQLite(cfg))
+	case config.DriverPostgres:
+		return asJobStore(OpenPostgres(cfg))
+	}
+	return nil, fmt.Errorf("unknown database driver %q", cfg.DBConfig.Driver)
+}
+
+// asJobStore keeps a failed constructor's nil pointer from becoming a
+// non-nil JobStore.
+func asJobStore[S JobStore](store S, err error) (JobStore, error) {
+	if err != nil {
+		return nil, err
+	}
+	return store, nil
+}
+
+// openMigrated finishes opening a store: it brings the schema up to date,
+// or with migration disabled, checks that it is, and closes the store if
+// either fails.
+func openMigrated[S JobStore](store S, cfg *config.Config) (S, error) {
+	var zero S
+	if cfg.DBConfig.Migrate {
+		applied, err := store.MigrateUp()
+		for _, mig := range applied {
+			slog.Info("Applied migration", "version", mig.Version, "name", mig.Name)
+		}
+		if err != nil {
+			store.Close()
+			return zero, fmt.Errorf("failed to migrate %s database: %v", cfg.DBConfig.Driver, err)
+		}
+		return store, nil
+	}
+
+	status, err := store.MigrationStatus()
+	if err != nil {
+		store.Close()
+		return zero, err
+	}
+	for _, st := range status {
+		if st.AppliedAt == nil {
+			store.Close()
+			return zero, ErrSchemaBehind
+		}
+	}
+	return store, nil
+}
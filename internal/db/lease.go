@@ -0,0 +1,177 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"pos-printer/internal/config"
+)
+
+// ErrLeaseLost is returned when a job is no longer leased to this
+// instance, because its lease expired and the job was recovered.
+var ErrLeaseLost = errors.New("job lease lost")
+
+func (s *SQLite) leaseModifier() string {
+	return fmt.Sprintf("+%d seconds", int(s.cfg.WorkerConfig.LeaseDuration.Seconds()))
+}
+
+// RenewBarcodeJobLease extends the lease on a job this instance is
+// printing. It is called periodically as a heartbeat.
+func (s *SQLite) RenewBarcodeJobLease(jobID int) error {
+	res, err := s.db.Exec(
+		`UPDATE barcode_jobs
+			 SET leaseExpiresAt = DATETIME('now', ?)
+			 WHERE id = ? AND status = ? AND leaseOwner = ?`,
+		s.leaseModifier(),
+		jobID,
+		s.cfg.WorkerConfig.JobStatus.StatusInProgress,
+		s.cfg.WorkerConfig.InstanceID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// UpdateBarcodeJobProgress records how many labels of a job this instance
+// is printing have been sent to the printer, so a retry can resume there.
+func (s *SQLite) UpdateBarcodeJobProgress(jobID int, printedCount int) error {
+	res, err := s.db.Exec(
+		`UPDATE barcode_jobs
+			 SET printedCount = ?, leaseExpiresAt = DATETIME('now', ?), updatedAt = CURRENT_TIMESTAMP
+			 WHERE id = ? AND status = ? AND leaseOwner = ?`,
+		printedCount,
+		s.leaseModifier(),
+		jobID,
+		s.cfg.WorkerConfig.JobStatus.StatusInProgress,
+		s.cfg.WorkerConfig.InstanceID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// UrgentBarcodeJobWaiting reports whether a claimable job for the printer
+// has a higher priority than priority, so that the job printing on it
+// gives way after its current chunk.
+func (s *SQLite) UrgentBarcodeJobWaiting(printerKey string, priority int) (bool, error) {
+	var waiting bool
+	err := s.db.QueryRow(
+		`SELECT EXISTS (
+			SELECT 1 FROM barcode_jobs
+			WHERE printerKey = ? AND status = ? AND priority > ? AND attempts < ?
+			AND (notBefore IS NULL OR notBefore <= DATETIME('now'))
+		)`,
+		printerKey,
+		s.cfg.WorkerConfig.JobStatus.StatusPending,
+		priority,
+		s.cfg.WorkerConfig.MaxJobAttempts,
+	).Scan(&waiting)
+	return waiting, err
+}
+
+// YieldBarcodeJob puts a job this instance is printing back in the queue
+// with its progress, releasing its lease. The attempt is not counted, the
+// job gave way rather than failed.
+func (s *SQLite) YieldBarcodeJob(jobID int) error {
+	res, err := s.db.Exec(
+		`UPDATE barcode_jobs
+			 SET status = ?, attempts = attempts - 1, leaseOwner = NULL, leaseExpiresAt = NULL, updatedAt = CURRENT_TIMESTAMP
+			 WHERE id = ? AND status = ? AND leaseOwner = ?`,
+		s.cfg.WorkerConfig.JobStatus.StatusPending,
+		jobID,
+		s.cfg.WorkerConfig.JobStatus.StatusInProgress,
+		s.cfg.WorkerConfig.InstanceID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrLeaseLost
+	}
+	s.notifyBarcodeJobReady()
+	return nil
+}
+
+// CompleteBarcodeJob stores the outcome of a job this instance printed
+// and releases its lease. If the lease was lost in the meantime the job
+// has been recovered elsewhere and ErrLeaseLost is returned instead.
+func (s *SQLite) CompleteBarcodeJob(jobID int, status string) error {
+	res, err := s.db.Exec(
+		`UPDATE barcode_jobs
+			 SET status = ?, leaseOwner = NULL, leaseExpiresAt = NULL, updatedAt = CURRENT_TIMESTAMP
+			 WHERE id = ? AND status = ? AND leaseOwner = ?`,
+		status,
+		jobID,
+		s.cfg.WorkerConfig.JobStatus.StatusInProgress,
+		s.cfg.WorkerConfig.InstanceID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// RecoverExpiredBarcodeJobs applies the recovery policy to in-progress
+// jobs whose lease has expired, and returns their ids. Jobs without a
+// lease were claimed by a version that did not take leases.
+func (s *SQLite) RecoverExpiredBarcodeJobs() ([]int, error) {
+	return s.recoverBarcodeJobs(
+		`leaseExpiresAt IS NULL OR leaseExpiresAt < DATETIME('now')`,
+	)
+}
+
+// RecoverOrphanedBarcodeJobs applies the recovery policy to in-progress
+// jobs leased to this instance. It must run before the workers start, when
+// any such job was left behind by a crash of the previous run.
+func (s *SQLite) RecoverOrphanedBarcodeJobs() ([]int, error) {
+	return s.recoverBarcodeJobs(`leaseOwner = ?`, s.cfg.WorkerConfig.InstanceID)
+}
+
+func (s *SQLite) recoverBarcodeJobs(where string, args ...any) ([]int, error) {
+	status := s.cfg.WorkerConfig.JobStatus
+	var set string
+	var setArgs []any
+	switch s.cfg.WorkerConfig.RecoveryPolicy {
+	case config.RecoveryUnknown:
+		set = `status = ?`
+		setArgs = []any{status.StatusUnknown}
+	default:
+		set = `status = CASE WHEN attempts < ? THEN ? ELSE ? END`
+		setArgs = []any{s.cfg.WorkerConfig.MaxJobAttempts, status.StatusPending, status.StatusFailed}
+	}
+
+	query := fmt.Sprintf(
+		`UPDATE barcode_jobs
+			 SET %s, leaseOwner = NULL, leaseExpiresAt = NULL, updatedAt = CURRENT_TIMESTAMP
+			 WHERE status = ? AND (%s)
+			 RETURNING id`,
+		set, where,
+	)
+	queryArgs := append(append(setArgs, status.StatusInProgress), args...)
+
+	rows, err := s.db.Query(query, queryArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
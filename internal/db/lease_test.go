@@ -0,0 +1,171 @@
+package db
+
+import (
+	"errors"
+	"pos-printer/internal/config"
+	"pos-printer/internal/model"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRestartRecoversOrphanedJobs(t *testing.T) {
+	t.Setenv("POS_PRINTER_INSTANCE_ID", "")
+	forEachDriver(t, func(t *testing.T, cfg *config.Config) {
+		store := newTestStore(t, cfg)
+		ids := enqueueTestJobs(t, store, 2, 2)
+		job, err := store.ClaimBarcodeJob()
+		if err != nil || job == nil {
+			t.Fatalf("ClaimBarcodeJob = %+v, %v", job, err)
+		}
+		// The process crashes mid-print, its lease still running.
+		store.Close()
+
+		restarted, err := config.Load()
+		if err != nil {
+			t.Fatal(err)
+		}
+		restarted.DBConfig = cfg.DBConfig
+		restarted.BackupConfig = cfg.BackupConfig
+		if restarted.WorkerConfig.InstanceID != cfg.WorkerConfig.InstanceID {
+			t.Fatalf("default instance ID changed across restarts: %q, then %q",
+				cfg.WorkerConfig.InstanceID, restarted.WorkerConfig.InstanceID)
+		}
+		store = newTestStore(t, restarted)
+		recovered, err := store.RecoverOrphanedBarcodeJobs()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(recovered, []int{job.ID}) {
+			t.Errorf("recovered %v, want the claimed job %d of %v", recovered, job.ID, ids)
+		}
+		got, err := store.FetchBarcodeJob(strconv.Itoa(job.ID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != cfg.WorkerConfig.JobStatus.StatusPending {
+			t.Errorf("recovered job status = %q, want pending", got.Status)
+		}
+	})
+}
+
+func TestBarcodeJobLease(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, cfg *config.Config) {
+		cfg.WorkerConfig.LeaseDuration = time.Second
+		ownerCfg, otherCfg := *cfg, *cfg
+		ownerCfg.WorkerConfig.InstanceID = "owner"
+		otherCfg.WorkerConfig.InstanceID = "other"
+		owner, other := newTestStore(t, &ownerCfg), newTestStore(t, &otherCfg)
+		enqueueTestJobs(t, owner, 1, 1)
+
+		job, err := owner.ClaimBarcodeJob()
+		if err != nil || job == nil {
+			t.Fatalf("ClaimBarcodeJob = %+v, %v", job, err)
+		}
+		if err := owner.RenewBarcodeJobLease(job.ID); err != nil {
+			t.Errorf("owner RenewBarcodeJobLease: %v", err)
+		}
+		if err := other.RenewBarcodeJobLease(job.ID); !errors.Is(err, ErrLeaseLost) {
+			t.Errorf("other RenewBarcodeJobLease = %v, want ErrLeaseLost", err)
+		}
+		if ids, err := other.RecoverExpiredBarcodeJobs(); err != nil || len(ids) > 0 {
+			t.Errorf("RecoverExpiredBarcodeJobs before expiry = %v, %v, want nothing", ids, err)
+		}
+
+		// The owner stops renewing; another instance recovers the job.
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			ids, err := other.RecoverExpiredBarcodeJobs()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if slices.Equal(ids, []int{job.ID}) {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatal("expired lease was not recovered")
+			}
+			time.Sleep(100 * time.Millisecond)
+		}
+
+		if err := owner.UpdateBarcodeJobProgress(job.ID, 1); !errors.Is(err, ErrLeaseLost) {
+			t.Errorf("UpdateBarcodeJobProgress after recovery = %v, want ErrLeaseLost", err)
+		}
+		if err := owner.CompleteBarcodeJob(job.ID, cfg.WorkerConfig.JobStatus.StatusDone); !errors.Is(err, ErrLeaseLost) {
+			t.Errorf("CompleteBarcodeJob after recovery = %v, want ErrLeaseLost", err)
+		}
+		got, err := owner.FetchBarcodeJob(strconv.Itoa(job.ID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != cfg.WorkerConfig.JobStatus.StatusPending || got.Attempts != 1 {
+			t.Errorf("recovered job status = %q, attempts %d; want pending, 1", got.Status, got.Attempts)
+		}
+	})
+}
+
+func TestYieldBarcodeJob(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, cfg *config.Config) {
+		store := newTestStore(t, cfg)
+		printerKey := config.PrinterKey("0x0fe6", "0x0000")
+		bulk, err := store.EnqueueBarcodeJob(model.PrintBarcodeRequest{
+			VID: "0x0fe6", PID: "0x0000", SizeX: 45, SizeY: 35, BarcodeData: "bulk", PrintCount: 100,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		job, err := store.ClaimBarcodeJob()
+		if err != nil || job == nil || job.ID != int(bulk) {
+			t.Fatalf("ClaimBarcodeJob = %+v, %v, want the bulk job", job, err)
+		}
+		if err := store.UpdateBarcodeJobProgress(job.ID, 40); err != nil {
+			t.Fatal(err)
+		}
+
+		if waiting, err := store.UrgentBarcodeJobWaiting(printerKey, job.Priority); err != nil || waiting {
+			t.Errorf("UrgentBarcodeJobWaiting with an empty queue = %v, %v", waiting, err)
+		}
+		for _, priority := range []int{0, 3} {
+			_, err := store.EnqueueBarcodeJob(model.PrintBarcodeRequest{
+				VID: "0x0fe6", PID: "0x0000", SizeX: 45, SizeY: 35, BarcodeData: "reprint", PrintCount: 1, Priority: priority,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			waiting, err := store.UrgentBarcodeJobWaiting(printerKey, job.Priority)
+			if err != nil || waiting != (priority > 0) {
+				t.Errorf("UrgentBarcodeJobWaiting after a priority %d job = %v, %v", priority, waiting, err)
+			}
+		}
+		if waiting, err := store.UrgentBarcodeJobWaiting(config.PrinterKey("0x0fe6", "0x0001"), 0); err != nil || waiting {
+			t.Errorf("UrgentBarcodeJobWaiting for another printer = %v, %v", waiting, err)
+		}
+
+		if err := store.YieldBarcodeJob(job.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.YieldBarcodeJob(job.ID); !errors.Is(err, ErrLeaseLost) {
+			t.Errorf("second YieldBarcodeJob = %v, want ErrLeaseLost", err)
+		}
+		got, err := store.FetchBarcodeJob(strconv.Itoa(job.ID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Status != cfg.WorkerConfig.JobStatus.StatusPending || got.PrintedCount != 40 || got.Attempts != 0 {
+			t.Errorf("yielded job status = %q, printed %d, attempts %d; want pending, 40, 0",
+				got.Status, got.PrintedCount, got.Attempts)
+		}
+
+		// The urgent reprint prints next, then the bulk job resumes.
+		next, err := store.ClaimBarcodeJob()
+		if err != nil || next == nil || next.Priority != 3 {
+			t.Fatalf("ClaimBarcodeJob = %+v, %v, want the urgent reprint", next, err)
+		}
+		store.CompleteBarcodeJob(next.ID, cfg.WorkerConfig.JobStatus.StatusDone)
+		next, err = store.ClaimBarcodeJob()
+		if err != nil || next == nil || next.ID != job.ID || next.PrintedCount != 40 || next.Attempts != 1 {
+			t.Errorf("ClaimBarcodeJob = %+v, %v, want the bulk job at 40 labels, attempt 1", next, err)
+		}
+	})
+}
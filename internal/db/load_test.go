@@ -0,0 +1,143 @@
+package db
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"pos-printer/internal/model"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testLoadLimitsEnv, when set, makes TestSQLiteUnderLoad fail on low
+// throughput or slow reads as well. These depend on the machine, so they
+// are off by default.
+const testLoadLimitsEnv = "POS_PRINTER_TEST_LOAD_LIMITS"
+
+// TestSQLiteUnderLoad claims, progresses and completes jobs from many
+// workers on separate connection pools while readers fetch jobs the way
+// the API does. With WAL and busy_timeout no statement may fail, "database
+// is locked" least of all, and reads must not queue behind the writes.
+func TestSQLiteUnderLoad(t *testing.T) {
+	if testing.Short() {
+		t.Skip("load test")
+	}
+	const (
+		jobs     = 1000
+		printers = 16
+		stores   = 4
+		workers  = 4 // per store
+		readers  = 4
+
+		minJobsPerSecond = 50
+		maxReadP99       = 250 * time.Millisecond
+	)
+
+	cfg := testConfig(t)
+	reader := newTestSQLite(t, cfg)
+	ids := enqueueTestJobs(t, reader, jobs, printers)
+
+	var errMu sync.Mutex
+	var errs []error
+	report := func(err error) {
+		errMu.Lock()
+		errs = append(errs, err)
+		errMu.Unlock()
+	}
+
+	start := time.Now()
+	deadline := start.Add(time.Minute)
+	claims := make(chan []int, stores*workers)
+	var wg sync.WaitGroup
+	for s := 0; s < stores; s++ {
+		storeCfg := *cfg
+		storeCfg.WorkerConfig.InstanceID = fmt.Sprintf("load-%d", s)
+		store := newTestSQLite(t, &storeCfg)
+		// A worker renews its lease and records progress while it prints,
+		// then completes the job.
+		work := func(job *model.BarcodeJob) error {
+			if err := store.RenewBarcodeJobLease(job.ID); err != nil {
+				return fmt.Errorf("RenewBarcodeJobLease(%d): %w", job.ID, err)
+			}
+			if err := store.UpdateBarcodeJobProgress(job.ID, job.PrintCount); err != nil {
+				return fmt.Errorf("UpdateBarcodeJobProgress(%d): %w", job.ID, err)
+			}
+			return nil
+		}
+		for w := 0; w < workers; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				claimed, err := claimAll(store, cfg.WorkerConfig.JobStatus.StatusDone, deadline, work)
+				if err != nil {
+					report(err)
+				}
+				claims <- claimed
+			}()
+		}
+	}
+
+	done := make(chan struct{})
+	latencies := make(chan []time.Duration, readers)
+	for r := 0; r < readers; r++ {
+		go func() {
+			var reads []time.Duration
+			for {
+				select {
+				case <-done:
+					latencies <- reads
+					return
+				default:
+				}
+				readStart := time.Now()
+				if _, err := reader.FetchBarcodeJob(strconv.Itoa(ids[rand.Intn(len(ids))])); err != nil {
+					report(fmt.Errorf("FetchBarcodeJob: %w", err))
+				}
+				reads = append(reads, time.Since(readStart))
+			}
+		}()
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	close(done)
+
+	var reads []time.Duration
+	for r := 0; r < readers; r++ {
+		reads = append(reads, <-latencies...)
+	}
+
+	for _, err := range errs {
+		t.Error(err)
+	}
+	close(claims)
+	count := 0
+	for claimed := range claims {
+		count += len(claimed)
+	}
+	if count != jobs {
+		t.Errorf("claimed %d jobs, want %d", count, jobs)
+	}
+
+	if len(reads) == 0 {
+		t.Fatal("no reads completed")
+	}
+	// The workers idle for about 100ms before they give up.
+	rate := float64(jobs) / elapsed.Seconds()
+	slices.Sort(reads)
+	p99 := reads[(len(reads)-1)*99/100]
+	t.Logf("%d jobs in %s (%.0f/s), %d reads, p50 %s, p99 %s",
+		jobs, elapsed.Round(time.Millisecond), rate, len(reads), reads[len(reads)/2], p99)
+
+	if os.Getenv(testLoadLimitsEnv) == "" {
+		return
+	}
+	if rate < minJobsPerSecond {
+		t.Errorf("processed %.0f jobs/s, want at least %d", rate, minJobsPerSecond)
+	}
+	if p99 > maxReadP99 {
+		t.Errorf("read p99 = %s, want at most %s", p99, maxReadP99)
+	}
+}
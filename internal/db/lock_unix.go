@@ -0,0 +1,32 @@
+//go:build unix
+
+package db
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// lockFile takes a lock on path, creating the file, and holds it until
+// the returned file is closed. Any number of shared locks may be held at
+// once, an exclusive lock only alone. It does not wait: a lock that
+// cannot be had at once is ErrDatabaseInUse.
+func lockFile(path string, exclusive bool) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	if err := syscall.Flock(int(f.Fd()), how|syscall.LOCK_NB); err != nil {
+		f.Close()
+		if errors.Is(err, syscall.EWOULDBLOCK) {
+			return nil, ErrDatabaseInUse
+		}
+		return nil, err
+	}
+	return f, nil
+}
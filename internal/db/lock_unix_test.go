@@ -0,0 +1,30 @@
+//go:build unix
+
+package db
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRestoreRefusesOpenDatabase(t *testing.T) {
+	cfg := testConfig(t)
+	cfg.BackupConfig.Dir = t.TempDir()
+	store := newTestSQLite(t, cfg)
+	backup, err := store.CreateBackup()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := RestoreSQLite(cfg, backup.Path); !errors.Is(err, ErrDatabaseInUse) {
+		t.Fatalf("restoring an open database: err = %v, want ErrDatabaseInUse", err)
+	}
+	// Other commands may open it alongside the service.
+	other := newTestSQLite(t, cfg)
+	other.Close()
+
+	store.Close()
+	if err := RestoreSQLite(cfg, backup.Path); err != nil {
+		t.Errorf("restoring a closed database: %v", err)
+	}
+}
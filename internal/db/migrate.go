@@ -0,0 +1,386 @@
+package db
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"pos-printer/internal/config"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// ErrSchemaBehind is returned when the database needs migrations that
+// were not applied because automatic migration is off.
+var ErrSchemaBehind = errors.New("database schema is behind, run pos-printer migrate up")
+
+//go:embed migrations/sqlite/*.sql migrations/postgres/*.sql
+var migrationFiles embed.FS
+
+// Migration is one schema change, read from a pair of
+// migrations/<driver>/<version>_<name>.up.sql and .down.sql files.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       string
+	Down     string
+	Checksum string // sha256 of Up
+}
+
+type MigrationStatus struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// migrator applies the migrations of one driver to a database. The SQL
+// it runs itself is written with ? placeholders and passed through rebind.
+type migrator struct {
+	db     *sql.DB
+	dir    string
+	rebind func(query string) string
+
+	// tableExists counts the schema_migrations tables in the database.
+	tableExists string
+	// lock, if set, runs first in every migration transaction, to keep two
+	// processes from migrating at once.
+	lock string
+	// hooks run inside the transaction of a migration, after its up SQL,
+	// for data changes that cannot be written in SQL.
+	hooks map[int]func(tx *sql.Tx) error
+	// legacy identifies how far a database created before versioned
+	// migrations got: each query counts an object the migration created.
+	legacy map[int]string
+}
+
+var sqliteMigrationHooks = map[int]func(tx *sql.Tx) error{
+	3: backfillPrinterKeys,
+}
+
+// Releases before versioned migrations shipped only the baseline schema.
+var sqliteLegacyMarkers = map[int]string{
+	1: `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'barcode_jobs'`,
+}
+
+const schemaMigrationsTableStmt = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	version INTEGER PRIMARY KEY,
+	name TEXT NOT NULL,
+	checksum TEXT NOT NULL,
+	appliedAt TIMESTAMP NOT NULL
+);`
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+func (s *SQLite) migrator() *migrator {
+	return &migrator{
+		db:          s.db,
+		dir:         "migrations/sqlite",
+		rebind:      func(query string) string { return query },
+		tableExists: `SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'schema_migrations'`,
+		hooks:       sqliteMigrationHooks,
+		legacy:      sqliteLegacyMarkers,
+	}
+}
+
+// Migrations returns the migrations built into this binary for the given
+// driver, in order.
+func Migrations(driver string) ([]Migration, error) {
+	switch driver {
+	case config.DriverSQLite, config.DriverPostgres:
+		return readMigrations("migrations/" + driver)
+	}
+	return nil, fmt.Errorf("unknown database driver %q", driver)
+}
+
+func readMigrations(dir string) ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		m := migrationFileName.FindStringSubmatch(entry.Name())
+		if m == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", entry.Name())
+		}
+		version, _ := strconv.Atoi(m[1])
+		body, err := fs.ReadFile(migrationFiles, dir+"/"+entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		mig := byVersion[version]
+		if mig == nil {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migration %d has two names, %s and %s", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(body)
+			sum := sha256.Sum256(body)
+			mig.Checksum = hex.EncodeToString(sum[:])
+		} else {
+			mig.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" || mig.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", mig.Version, mig.Name)
+		}
+		migrations = append(migrations, *mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, mig := range migrations {
+		if mig.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+	}
+	return migrations, nil
+}
+
+// MigrationStatus lists every migration built into this binary and when it
+// was applied. It fails if an applied migration was changed after the fact
+// or the database is newer than this binary.
+func (s *SQLite) MigrationStatus() ([]MigrationStatus, error) {
+	return s.migrator().status()
+}
+
+// MigrateUp applies every pending migration, each in its own transaction,
+// and returns the ones it applied.
+func (s *SQLite) MigrateUp() ([]Migration, error) {
+	return s.migrator().up()
+}
+
+// MigrateDown reverts the last steps applied migrations, newest first, and
+// returns the ones it reverted.
+func (s *SQLite) MigrateDown(steps int) ([]Migration, error) {
+	return s.migrator().down(steps)
+}
+
+func (m *migrator) status() ([]MigrationStatus, error) {
+	migrations, err := readMigrations(m.dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.prepare(migrations); err != nil {
+		return nil, err
+	}
+
+	rows, err := m.db.Query(`SELECT version, name, checksum, appliedAt FROM schema_migrations ORDER BY version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	status := make([]MigrationStatus, len(migrations))
+	for i, mig := range migrations {
+		status[i].Migration = mig
+	}
+	for rows.Next() {
+		var version int
+		var name, checksum string
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &name, &checksum, &appliedAt); err != nil {
+			return nil, err
+		}
+		if version > len(migrations) {
+			return nil, fmt.Errorf("database schema has migration %d_%s, which this build does not know; upgrade pos-printer", version, name)
+		}
+		if mig := migrations[version-1]; checksum != mig.Checksum {
+			return nil, fmt.Errorf("migration %d_%s was changed after it was applied (checksum %.12s, expected %.12s)", version, mig.Name, checksum, mig.Checksum)
+		}
+		status[version-1].AppliedAt = &appliedAt
+	}
+	return status, rows.Err()
+}
+
+func (m *migrator) up() ([]Migration, error) {
+	status, err := m.status()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []Migration
+	for _, st := range status {
+		if st.AppliedAt != nil {
+			continue
+		}
+		ok, err := m.apply(st.Migration, true)
+		if err != nil {
+			return applied, err
+		}
+		if ok {
+			applied = append(applied, st.Migration)
+		}
+	}
+	return applied, nil
+}
+
+func (m *migrator) down(steps int) ([]Migration, error) {
+	status, err := m.status()
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []Migration
+	for i := len(status) - 1; i >= 0 && len(reverted) < steps; i-- {
+		if status[i].AppliedAt == nil {
+			continue
+		}
+		ok, err := m.apply(status[i].Migration, false)
+		if err != nil {
+			return reverted, err
+		}
+		if ok {
+			reverted = append(reverted, status[i].Migration)
+		}
+	}
+	return reverted, nil
+}
+
+// apply runs one migration up or down in a transaction. It returns false
+// if another process already did while this one waited for the lock.
+func (m *migrator) apply(mig Migration, up bool) (bool, error) {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if m.lock != "" {
+		if _, err := tx.Exec(m.lock); err != nil {
+			return false, err
+		}
+	}
+	var applied int
+	err = tx.QueryRow(m.rebind(`SELECT COUNT(*) FROM schema_migrations WHERE version = ?`), mig.Version).Scan(&applied)
+	if err != nil {
+		return false, err
+	}
+	if (applied == 1) == up {
+		return false, nil
+	}
+
+	direction, stmt := "up", mig.Up
+	if !up {
+		direction, stmt = "down", mig.Down
+	}
+	if _, err := tx.Exec(stmt); err != nil {
+		return false, fmt.Errorf("migration %d_%s %s failed: %w", mig.Version, mig.Name, direction, err)
+	}
+
+	if up {
+		if hook := m.hooks[mig.Version]; hook != nil {
+			if err := hook(tx); err != nil {
+				return false, fmt.Errorf("migration %d_%s failed: %w", mig.Version, mig.Name, err)
+			}
+		}
+		_, err = tx.Exec(
+			m.rebind(`INSERT INTO schema_migrations (version, name, checksum, appliedAt) VALUES (?,?,?,?)`),
+			mig.Version, mig.Name, mig.Checksum, time.Now().UTC(),
+		)
+	} else {
+		_, err = tx.Exec(m.rebind(`DELETE FROM schema_migrations WHERE version = ?`), mig.Version)
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// prepare creates the schema_migrations table and, for a database created
+// before it existed, records the migrations whose changes are already
+// there.
+func (m *migrator) prepare(migrations []Migration) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if m.lock != "" {
+		if _, err := tx.Exec(m.lock); err != nil {
+			return err
+		}
+	}
+	// Checked inside the transaction, so two processes starting together
+	// cannot both adopt the same database.
+	var exists int
+	if err := tx.QueryRow(m.tableExists).Scan(&exists); err != nil {
+		return err
+	}
+	if exists == 1 {
+		return nil
+	}
+
+	if _, err := tx.Exec(schemaMigrationsTableStmt); err != nil {
+		return err
+	}
+	for _, mig := range migrations {
+		marker, ok := m.legacy[mig.Version]
+		if !ok {
+			break
+		}
+		var found int
+		if err := tx.QueryRow(marker).Scan(&found); err != nil {
+			return err
+		}
+		if found == 0 {
+			break
+		}
+		slog.Info("Adopting existing schema as migration", "version", mig.Version, "name", mig.Name)
+		// Hooks only fill in data, so they are safe to run again.
+		if hook := m.hooks[mig.Version]; hook != nil {
+			if err := hook(tx); err != nil {
+				return fmt.Errorf("migration %d_%s failed: %w", mig.Version, mig.Name, err)
+			}
+		}
+		_, err := tx.Exec(
+			m.rebind(`INSERT INTO schema_migrations (version, name, checksum, appliedAt) VALUES (?,?,?,?)`),
+			mig.Version, mig.Name, mig.Checksum, time.Now().UTC(),
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// backfillPrinterKeys sets the queue key of jobs enqueued before
+// per-printer queues.
+func backfillPrinterKeys(tx *sql.Tx) error {
+	rows, err := tx.Query(`SELECT id, vid, pid FROM barcode_jobs WHERE printerKey IS NULL`)
+	if err != nil {
+		return err
+	}
+	keys := map[int]string{}
+	for rows.Next() {
+		var id int
+		var vid, pid sql.NullString
+		if err := rows.Scan(&id, &vid, &pid); err != nil {
+			rows.Close()
+			return err
+		}
+		keys[id] = config.PrinterKey(vid.String, pid.String)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, key := range keys {
+		if _, err := tx.Exec(`UPDATE barcode_jobs SET printerKey = ? WHERE id = ?`, key, id); err != nil {
+			return fmt.Errorf("failed to backfill printer key of job %d: %w", id, err)
+		}
+	}
+	return nil
+}
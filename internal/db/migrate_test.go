@@ -0,0 +1,48 @@
+package db
+
+import (
+	"database/sql"
+	"pos-printer/internal/config"
+	"testing"
+)
+
+// A database made by a release before versioned migrations has only the
+// baseline tables; it is adopted at version 1 and migrated from there.
+func TestAdoptBaselineSchema(t *testing.T) {
+	cfg := testConfig(t)
+	baseline, err := migrationFiles.ReadFile("migrations/sqlite/0001_initial.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	legacy, err := sql.Open("sqlite3", cfg.DBConfig.SQLitePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = legacy.Exec(string(baseline))
+	if err == nil {
+		_, err = legacy.Exec(`INSERT INTO barcode_jobs (vid, pid, sizeX, sizeY, barcodeData, printCount, status, attempts)
+			VALUES ('0x0fe6', '0x8800', 45, 35, 'legacy', 1, 'pending', 0)`)
+	}
+	legacy.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := newTestSQLite(t, cfg)
+	status, err := store.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range status {
+		if s.AppliedAt == nil {
+			t.Errorf("migration %d_%s not applied", s.Version, s.Name)
+		}
+	}
+	var key string
+	if err := store.db.QueryRow(`SELECT printerKey FROM barcode_jobs`).Scan(&key); err != nil {
+		t.Fatal(err)
+	}
+	if want := config.PrinterKey("0x0fe6", "0x8800"); key != want {
+		t.Errorf("printer key = %q, want %q", key, want)
+	}
+}
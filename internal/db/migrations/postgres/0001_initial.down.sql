@@ -0,0 +1,3 @@
+DROP TABLE job_schedules;
+DROP TABLE receipt_pdf_jobs;
+DROP TABLE barcode_jobs;
@@ -0,0 +1,65 @@
+-- The PostgreSQL schema starts at the state SQLite reached with migration
+-- 0007, so its versions do not line up with SQLite's.
+CREATE TABLE barcode_jobs (
+	id BIGSERIAL PRIMARY KEY,
+	vid TEXT, pid TEXT,
+	sizeX INTEGER, sizeY INTEGER,
+	direction INTEGER, topText TEXT,
+	barcodeData TEXT, printCount INTEGER,
+	labelGapLength INTEGER DEFAULT 0,
+	labelGapOffset INTEGER DEFAULT 0,
+	status TEXT, attempts INTEGER,
+	createdAt TIMESTAMPTZ, updatedAt TIMESTAMPTZ,
+	leaseOwner TEXT, leaseExpiresAt TIMESTAMPTZ,
+	priority INTEGER DEFAULT 0,
+	printerKey TEXT,
+	claimedAt TIMESTAMPTZ,
+	notBefore TIMESTAMPTZ,
+	printedCount INTEGER DEFAULT 0,
+	serial TEXT
+);
+
+CREATE INDEX barcode_jobs_queue
+	ON barcode_jobs (status, printerKey, priority DESC, createdAt, id);
+CREATE INDEX barcode_jobs_claimed
+	ON barcode_jobs (printerKey, claimedAt);
+CREATE INDEX barcode_jobs_retention
+	ON barcode_jobs (status, updatedAt, id);
+
+-- A printer prints one job at a time. Claims skip locked rows instead of
+-- waiting for them, so two claims can each pick a different job of the
+-- same printer; this index makes the second one fail.
+CREATE UNIQUE INDEX barcode_jobs_printing
+	ON barcode_jobs (printerKey) WHERE status = 'in_progress';
+
+CREATE TABLE receipt_pdf_jobs (
+	id               BIGSERIAL PRIMARY KEY,
+	file_path        TEXT    NOT NULL,
+	print_count      INTEGER DEFAULT 1,
+	connection_type  TEXT    NOT NULL CHECK(connection_type IN ('network','usb')),
+	printer_ip       TEXT,
+	printer_port     INTEGER,
+	usb_vendor_id    INTEGER,
+	usb_product_id   INTEGER,
+	usb_interface    INTEGER DEFAULT 0,
+	printer_width    INTEGER DEFAULT 576,
+	threshold        INTEGER DEFAULT 100,
+	feed_lines       INTEGER DEFAULT 1,
+	zoom             REAL    DEFAULT 2.0,
+	status           TEXT    DEFAULT 'pending',
+	retry_count      INTEGER DEFAULT 0,
+	last_error       TEXT,
+	created_at       TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+	updated_at       TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE job_schedules (
+	id BIGSERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	cron TEXT NOT NULL,
+	enabled BOOLEAN DEFAULT TRUE,
+	job TEXT NOT NULL,
+	nextRunAt TIMESTAMPTZ, lastRunAt TIMESTAMPTZ,
+	lastJobId BIGINT,
+	createdAt TIMESTAMPTZ, updatedAt TIMESTAMPTZ
+);
@@ -0,0 +1,3 @@
+ALTER TABLE job_schedules DROP COLUMN apiKeyId;
+ALTER TABLE barcode_jobs DROP COLUMN apiKeyId;
+DROP TABLE api_keys;
@@ -0,0 +1,12 @@
+CREATE TABLE api_keys (
+	id BIGSERIAL PRIMARY KEY,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL,
+	printers TEXT NOT NULL DEFAULT '',
+	createdAt TIMESTAMPTZ, lastUsedAt TIMESTAMPTZ, revokedAt TIMESTAMPTZ
+);
+
+ALTER TABLE barcode_jobs ADD COLUMN apiKeyId BIGINT;
+ALTER TABLE job_schedules ADD COLUMN apiKeyId BIGINT;
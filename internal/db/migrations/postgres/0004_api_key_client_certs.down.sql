@@ -0,0 +1,2 @@
+DROP INDEX api_keys_client_cert;
+ALTER TABLE api_keys DROP COLUMN clientCertCN;
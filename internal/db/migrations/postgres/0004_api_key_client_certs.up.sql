@@ -0,0 +1,3 @@
+ALTER TABLE api_keys ADD COLUMN clientCertCN TEXT;
+CREATE UNIQUE INDEX api_keys_client_cert
+	ON api_keys (clientCertCN) WHERE clientCertCN IS NOT NULL AND revokedAt IS NULL;
@@ -0,0 +1,2 @@
+DROP INDEX barcode_jobs_api_key;
+ALTER TABLE api_keys DROP COLUMN dailyLabelQuota;
@@ -0,0 +1,5 @@
+-- A NULL quota falls back to POS_PRINTER_QUOTA_KEY_DAILY_LABELS.
+ALTER TABLE api_keys ADD COLUMN dailyLabelQuota INTEGER;
+
+CREATE INDEX barcode_jobs_api_key
+	ON barcode_jobs (apiKeyId, createdAt);
@@ -0,0 +1,32 @@
+CREATE TABLE audit_log (
+	id BIGSERIAL PRIMARY KEY,
+	at TIMESTAMPTZ NOT NULL,
+	source TEXT NOT NULL,
+	action TEXT NOT NULL,
+	apiKeyId BIGINT,
+	apiKeyName TEXT,
+	ip TEXT,
+	userAgent TEXT,
+	osUser TEXT,
+	targetType TEXT,
+	targetId TEXT,
+	printerKey TEXT,
+	beforeState JSONB,
+	afterState JSONB
+);
+
+CREATE INDEX audit_log_at ON audit_log (at);
+CREATE INDEX audit_log_action ON audit_log (action, at);
+CREATE INDEX audit_log_api_key ON audit_log (apiKeyId, at);
+CREATE INDEX audit_log_target ON audit_log (targetType, targetId);
+
+-- The log is append-only; entries leave it only with the table.
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_append_only
+	BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_log
+	FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
@@ -0,0 +1,2 @@
+DROP TABLE receipt_pdf_jobs;
+DROP TABLE barcode_jobs;
@@ -0,0 +1,2 @@
+ALTER TABLE barcode_jobs DROP COLUMN leaseExpiresAt;
+ALTER TABLE barcode_jobs DROP COLUMN leaseOwner;
@@ -0,0 +1,2 @@
+ALTER TABLE barcode_jobs ADD COLUMN leaseOwner TEXT;
+ALTER TABLE barcode_jobs ADD COLUMN leaseExpiresAt DATETIME;
@@ -0,0 +1,6 @@
+DROP INDEX barcode_jobs_claimed;
+DROP INDEX barcode_jobs_queue;
+
+ALTER TABLE barcode_jobs DROP COLUMN claimedAt;
+ALTER TABLE barcode_jobs DROP COLUMN printerKey;
+ALTER TABLE barcode_jobs DROP COLUMN priority;
@@ -0,0 +1,10 @@
+-- printerKey is backfilled for existing jobs by the Go hook of this
+-- migration, as it needs config.PrinterKey.
+ALTER TABLE barcode_jobs ADD COLUMN priority INTEGER DEFAULT 0;
+ALTER TABLE barcode_jobs ADD COLUMN printerKey TEXT;
+ALTER TABLE barcode_jobs ADD COLUMN claimedAt DATETIME;
+
+CREATE INDEX barcode_jobs_queue
+	ON barcode_jobs (status, printerKey, priority DESC, createdAt, id);
+CREATE INDEX barcode_jobs_claimed
+	ON barcode_jobs (printerKey, claimedAt);
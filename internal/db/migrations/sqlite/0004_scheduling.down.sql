@@ -0,0 +1,3 @@
+DROP TABLE job_schedules;
+
+ALTER TABLE barcode_jobs DROP COLUMN notBefore;
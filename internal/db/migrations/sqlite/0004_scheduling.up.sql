@@ -0,0 +1,12 @@
+ALTER TABLE barcode_jobs ADD COLUMN notBefore DATETIME;
+
+CREATE TABLE job_schedules (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	cron TEXT NOT NULL,
+	enabled INTEGER DEFAULT 1,
+	job TEXT NOT NULL,
+	nextRunAt DATETIME, lastRunAt DATETIME,
+	lastJobId INTEGER,
+	createdAt DATETIME, updatedAt DATETIME
+);
@@ -0,0 +1 @@
+ALTER TABLE barcode_jobs DROP COLUMN serial;
@@ -0,0 +1 @@
+ALTER TABLE barcode_jobs ADD COLUMN serial TEXT;
@@ -0,0 +1 @@
+DROP INDEX barcode_jobs_retention;
@@ -0,0 +1,2 @@
+CREATE INDEX barcode_jobs_retention
+	ON barcode_jobs (status, updatedAt, id);
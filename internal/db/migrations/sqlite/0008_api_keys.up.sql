@@ -0,0 +1,12 @@
+CREATE TABLE api_keys (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	name TEXT NOT NULL,
+	prefix TEXT NOT NULL,
+	hash TEXT NOT NULL UNIQUE,
+	scopes TEXT NOT NULL,
+	printers TEXT NOT NULL DEFAULT '',
+	createdAt DATETIME, lastUsedAt DATETIME, revokedAt DATETIME
+);
+
+ALTER TABLE barcode_jobs ADD COLUMN apiKeyId INTEGER;
+ALTER TABLE job_schedules ADD COLUMN apiKeyId INTEGER;
@@ -0,0 +1,31 @@
+CREATE TABLE audit_log (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	at DATETIME NOT NULL,
+	source TEXT NOT NULL,
+	action TEXT NOT NULL,
+	apiKeyId INTEGER,
+	apiKeyName TEXT,
+	ip TEXT,
+	userAgent TEXT,
+	osUser TEXT,
+	targetType TEXT,
+	targetId TEXT,
+	printerKey TEXT,
+	beforeState TEXT,
+	afterState TEXT
+);
+
+CREATE INDEX audit_log_at ON audit_log (at);
+CREATE INDEX audit_log_action ON audit_log (action, at);
+CREATE INDEX audit_log_api_key ON audit_log (apiKeyId, at);
+CREATE INDEX audit_log_target ON audit_log (targetType, targetId);
+
+-- The log is append-only; entries leave it only with the table.
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
+CREATE TRIGGER audit_log_no_delete BEFORE DELETE ON audit_log
+BEGIN
+	SELECT RAISE(ABORT, 'audit_log is append-only');
+END;
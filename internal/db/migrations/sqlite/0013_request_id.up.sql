@@ -0,0 +1,3 @@
+-- The X-Request-ID of the request that enqueued the job, so its worker
+-- log lines can be matched with the request's.
+ALTER TABLE barcode_jobs ADD COLUMN requestId TEXT;
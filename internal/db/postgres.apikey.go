@@ -0,0 +1,67 @@
+package db
+
+import (
+	"database/sql"
+	"pos-printer/internal/model"
+	"strings"
+)
+
+func (p *Postgres) CreateAPIKey(key *model.APIKey, hash string) (int64, error) {
+	var id int64
+	err := p.db.QueryRow(
+		`INSERT INTO api_keys (name, prefix, hash, scopes, printers, origins, clientCertCN, dailyLabelQuota, createdAt)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8,now())
+		 RETURNING id`,
+		key.Name, key.Prefix, hash, strings.Join(key.Scopes, ","), strings.Join(key.Printers, ","),
+		strings.Join(key.Origins, ","), nullString(key.ClientCertCN), key.DailyLabelQuota,
+	).Scan(&id)
+	return id, clientCertTaken(err)
+}
+
+func (p *Postgres) FetchAPIKey(id string) (*model.APIKey, error) {
+	keyID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	return scanAPIKey(p.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE id = $1`, keyID))
+}
+
+// FetchAPIKeyByHash returns the key with the given hash, or sql.ErrNoRows
+// if there is none or it was revoked.
+func (p *Postgres) FetchAPIKeyByHash(hash string) (*model.APIKey, error) {
+	return scanAPIKey(p.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE hash = $1 AND revokedAt IS NULL`, hash))
+}
+
+// FetchAPIKeyByClientCert returns the key a client certificate with the
+// given common name authenticates as, or sql.ErrNoRows if there is none or
+// it was revoked.
+func (p *Postgres) FetchAPIKeyByClientCert(cn string) (*model.APIKey, error) {
+	return scanAPIKey(p.db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys WHERE clientCertCN = $1 AND revokedAt IS NULL`, cn))
+}
+
+func (p *Postgres) ListAPIKeys() ([]*model.APIKey, error) {
+	return queryAPIKeys(p.db, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY id`)
+}
+
+// RevokeAPIKey stops a key from authenticating. It returns sql.ErrNoRows
+// if the key does not exist or is already revoked.
+func (p *Postgres) RevokeAPIKey(id string) error {
+	keyID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	res, err := p.db.Exec(`UPDATE api_keys SET revokedAt = now() WHERE id = $1 AND revokedAt IS NULL`, keyID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// TouchAPIKey records that a key was used.
+func (p *Postgres) TouchAPIKey(id int64) error {
+	_, err := p.db.Exec(`UPDATE api_keys SET lastUsedAt = now() WHERE id = $1`, id)
+	return err
+}
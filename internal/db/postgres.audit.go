@@ -0,0 +1,21 @@
+package db
+
+import (
+	"pos-printer/internal/model"
+	"time"
+)
+
+func (p *Postgres) AppendAuditEntry(e *model.AuditEntry) error {
+	_, err := p.db.Exec(
+		`INSERT INTO audit_log (at, source, action, apiKeyId, apiKeyName, ip, userAgent, osUser, targetType, targetId, printerKey, beforeState, afterState)
+		 VALUES (now(),$1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12)`,
+		e.Source, e.Action, e.APIKeyID, nullString(e.APIKeyName), nullString(e.IP), nullString(e.UserAgent), nullString(e.OSUser),
+		nullString(e.TargetType), nullString(e.TargetID), nullString(e.PrinterKey), nullJSON(e.Before), nullJSON(e.After),
+	)
+	return err
+}
+
+func (p *Postgres) ListAuditEntries(f model.AuditFilter) ([]*model.AuditEntry, error) {
+	query, args := auditQuery(f, func(t time.Time) any { return t })
+	return queryAuditEntries(p.db, rebind(query), args...)
+}
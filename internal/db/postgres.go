@@ -0,0 +1,198 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"pos-printer/internal/config"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+// barcodeJobChannel is the LISTEN/NOTIFY channel on which every process
+// sharing the database announces enqueued barcode jobs.
+const barcodeJobChannel = "barcode_jobs"
+
+// migrationLockID serializes migrations between processes starting at
+// the same time, as a transaction-scoped advisory lock.
+const migrationLockID = 7244331
+
+// Postgres is the job store for central deployments, where one database
+// is shared by the API and the workers of several print servers.
+type Postgres struct {
+	db  *sql.DB
+	cfg *config.Config
+
+	barcodeJobReady chan struct{}
+	stopListening   context.CancelFunc
+	listenerDone    chan struct{}
+}
+
+// NewPostgres connects to the database and brings its schema up to date,
+// or with migration disabled, checks that it is.
+func NewPostgres(cfg *config.Config) (*Postgres, error) {
+	pg, err := OpenPostgres(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return openMigrated(pg, cfg)
+}
+
+// OpenPostgres connects to the database without touching its schema.
+func OpenPostgres(cfg *config.Config) (*Postgres, error) {
+	if cfg.DBConfig.PostgresURL == "" {
+		return nil, errors.New("POS_PRINTER_DB_POSTGRES_URL is required for the postgres driver")
+	}
+
+	db, err := sql.Open("pgx", cfg.DBConfig.PostgresURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PostgreSQL database: %w", err)
+	}
+	db.SetMaxOpenConns(cfg.DBConfig.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.DBConfig.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DBConfig.ConnMaxLifetime)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to PostgreSQL database: %w", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pg := &Postgres{
+		db:              db,
+		cfg:             cfg,
+		barcodeJobReady: make(chan struct{}, 1),
+		stopListening:   cancel,
+		listenerDone:    make(chan struct{}),
+	}
+	go pg.listen(ctx)
+	return pg, nil
+}
+
+func (p *Postgres) Close() error {
+	p.stopListening()
+	<-p.listenerDone
+	return p.db.Close()
+}
+
+// BarcodeJobReady is signalled whenever a barcode job is enqueued by any
+// process sharing the database. Signals are coalesced, a receiver must
+// drain the queue.
+func (p *Postgres) BarcodeJobReady() <-chan struct{} {
+	return p.barcodeJobReady
+}
+
+func (p *Postgres) notifyBarcodeJobReady() {
+	select {
+	case p.barcodeJobReady <- struct{}{}:
+	default:
+	}
+}
+
+// announceBarcodeJob tells every process listening on the database that a
+// job is ready. Inside a transaction, the notification is sent on commit.
+func announceBarcodeJob(db execer) error {
+	_, err := db.Exec(`SELECT pg_notify($1, '')`, barcodeJobChannel)
+	return err
+}
+
+// listen relays notifications on barcodeJobChannel to BarcodeJobReady,
+// reconnecting until the store is closed. While it is down, workers fall
+// back to polling.
+func (p *Postgres) listen(ctx context.Context) {
+	defer close(p.listenerDone)
+	for {
+		err := p.listenOnce(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		slog.Warn("Job notifications interrupted, reconnecting", "error", err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (p *Postgres) listenOnce(ctx context.Context) error {
+	conn, err := p.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		pgConn := driverConn.(*stdlib.Conn).Conn()
+		if _, err := pgConn.Exec(ctx, "LISTEN "+barcodeJobChannel); err != nil {
+			return err
+		}
+		// Jobs may have been enqueued while no one was listening.
+		p.notifyBarcodeJobReady()
+		for {
+			if _, err := pgConn.WaitForNotification(ctx); err != nil {
+				return err
+			}
+			p.notifyBarcodeJobReady()
+		}
+	})
+}
+
+func (p *Postgres) migrator() *migrator {
+	return &migrator{
+		db:          p.db,
+		dir:         "migrations/postgres",
+		rebind:      rebind,
+		tableExists: `SELECT COUNT(*) FROM pg_tables WHERE schemaname = current_schema() AND tablename = 'schema_migrations'`,
+		lock:        fmt.Sprintf(`SELECT pg_advisory_xact_lock(%d)`, migrationLockID),
+	}
+}
+
+// MigrationStatus lists every migration built into this binary and when it
+// was applied.
+func (p *Postgres) MigrationStatus() ([]MigrationStatus, error) {
+	return p.migrator().status()
+}
+
+// MigrateUp applies every pending migration, each in its own transaction,
+// and returns the ones it applied.
+func (p *Postgres) MigrateUp() ([]Migration, error) {
+	return p.migrator().up()
+}
+
+// MigrateDown reverts the last steps applied migrations, newest first, and
+// returns the ones it reverted.
+func (p *Postgres) MigrateDown(steps int) ([]Migration, error) {
+	return p.migrator().down(steps)
+}
+
+// rebind turns the ? placeholders of a query into PostgreSQL's $1, $2, ...
+// The queries it is used on have no ? in string literals.
+func rebind(query string) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range query {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// parseID parses a job or schedule id from a URL. An id that is not a
+// number matches no row.
+func parseID(id string) (int64, error) {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return 0, sql.ErrNoRows
+	}
+	return n, nil
+}
@@ -0,0 +1,483 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"pos-printer/internal/config"
+	"pos-printer/internal/model"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// claimAttempts bounds how often a claim is retried after losing a race
+// for a printer to another process.
+const claimAttempts = 3
+
+type queryRower interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+func (p *Postgres) EnqueueBarcodeJob(req model.PrintBarcodeRequest) (int64, error) {
+	id, err := p.insertBarcodeJob(p.db, req)
+	if err != nil {
+		slog.Error("Failed to enqueue job", "request_id", req.RequestID, "error", err)
+		return 0, err
+	}
+	if err := announceBarcodeJob(p.db); err != nil {
+		slog.Warn("Error announcing barcode job", "job_id", id, "error", err)
+	}
+	p.notifyBarcodeJobReady()
+	return id, nil
+}
+
+func (p *Postgres) insertBarcodeJob(db queryRower, req model.PrintBarcodeRequest) (int64, error) {
+	now := time.Now()
+	var serial any
+	if req.Serial != nil {
+		b, err := json.Marshal(req.Serial)
+		if err != nil {
+			return 0, err
+		}
+		serial = string(b)
+	}
+	var id int64
+	err := db.QueryRow(rebind(
+		`INSERT INTO barcode_jobs
+		(vid, pid, sizeX, sizeY, direction, topText, barcodeData, printCount, labelGapLength, labelGapOffset, status, attempts, createdAt, updatedAt, priority, printerKey, notBefore, serial, apiKeyId, requestId)
+		 VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)
+		 RETURNING id`),
+		req.VID, req.PID, req.SizeX, req.SizeY,
+		req.Direction, req.TopText, req.BarcodeData,
+		req.PrintCount, req.LabelGap.Length, req.LabelGap.Offset,
+		p.cfg.WorkerConfig.JobStatus.StatusPending, 0, now, now,
+		req.Priority, config.PrinterKey(req.VID, req.PID), req.NotBefore, serial, req.APIKeyID, nullString(req.RequestID),
+	).Scan(&id)
+	return id, err
+}
+
+func (p *Postgres) FetchBarcodeJob(id string) (*model.BarcodeJob, error) {
+	jobID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	job, err := scanBarcodeJob(p.db.QueryRow(`SELECT `+barcodeJobColumns+` FROM barcode_jobs WHERE id = $1`, jobID))
+	if err != nil {
+		if !errors.Is(err, sql.ErrNoRows) {
+			slog.Error("Error fetching barcode job", "job_id", jobID, "error", err)
+		}
+		return nil, err
+	}
+	return job, nil
+}
+
+func (p *Postgres) UpdateBarcodeJobStatus(jobID int, status string) error {
+	_, err := p.db.Exec(`UPDATE barcode_jobs SET status = $1, updatedAt = now() WHERE id = $2`, status, jobID)
+	if err != nil {
+		slog.Error("Error updating barcode job status", "job_id", jobID, "error", err)
+		return err
+	}
+	return nil
+}
+
+// ResolveBarcodeJob records an operator's decision on a job recovered as
+// unknown. Resolving it as pending prints it again with fresh attempts.
+func (p *Postgres) ResolveBarcodeJob(id string, status string) error {
+	jobID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current string
+	if err := tx.QueryRow(`SELECT status FROM barcode_jobs WHERE id = $1 FOR UPDATE`, jobID).Scan(&current); err != nil {
+		return err
+	}
+	if current != p.cfg.WorkerConfig.JobStatus.StatusUnknown {
+		return ErrJobNotUnknown
+	}
+
+	pending := status == p.cfg.WorkerConfig.JobStatus.StatusPending
+	_, err = tx.Exec(
+		`UPDATE barcode_jobs
+			 SET status = $1, attempts = CASE WHEN $2 THEN 0 ELSE attempts END, updatedAt = now()
+			 WHERE id = $3`,
+		status, pending, jobID,
+	)
+	if err != nil {
+		slog.Error("Error resolving barcode job", "job_id", jobID, "error", err)
+		return err
+	}
+	if pending {
+		if err := announceBarcodeJob(tx); err != nil {
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if pending {
+		p.notifyBarcodeJobReady()
+	}
+	return nil
+}
+
+// CancelBarcodeJob withdraws a job that has not started printing.
+func (p *Postgres) CancelBarcodeJob(id string) error {
+	status := p.cfg.WorkerConfig.JobStatus
+	return p.moveBarcodeJob(id, status.StatusPending, status.StatusCancelled, ErrJobNotPending)
+}
+
+// RetryBarcodeJob queues a failed job again with fresh attempts. It
+// resumes after the labels it already printed.
+func (p *Postgres) RetryBarcodeJob(id string) error {
+	status := p.cfg.WorkerConfig.JobStatus
+	if err := p.moveBarcodeJob(id, status.StatusFailed, status.StatusPending, ErrJobNotFailed); err != nil {
+		return err
+	}
+	p.notifyBarcodeJobReady()
+	return nil
+}
+
+// moveBarcodeJob changes a job from one status to another as in SQLite,
+// announcing it to the other instances if it becomes pending.
+func (p *Postgres) moveBarcodeJob(id string, from, to string, errWrongStatus error) error {
+	jobID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	tx, err := p.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current string
+	if err := tx.QueryRow(`SELECT status FROM barcode_jobs WHERE id = $1 FOR UPDATE`, jobID).Scan(&current); err != nil {
+		return err
+	}
+	if current != from {
+		return errWrongStatus
+	}
+
+	pending := to == p.cfg.WorkerConfig.JobStatus.StatusPending
+	_, err = tx.Exec(
+		`UPDATE barcode_jobs
+			 SET status = $1, attempts = CASE WHEN $2 THEN 0 ELSE attempts END, updatedAt = now()
+			 WHERE id = $3`,
+		to, pending, jobID,
+	)
+	if err != nil {
+		slog.Error("Error updating barcode job status", "job_id", jobID, "error", err)
+		return err
+	}
+	if pending {
+		if err := announceBarcodeJob(tx); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ClaimBarcodeJob moves the next claimable pending job to in_progress,
+// leased to this instance, and returns it, or nil if there is none. The
+// queues are ordered as in SQLite. Candidates locked by a concurrent claim
+// are skipped rather than waited for; if the concurrent claim took another
+// job of the same printer, the barcode_jobs_printing index rejects this
+// one and the claim is tried again.
+func (p *Postgres) ClaimBarcodeJob() (*model.BarcodeJob, error) {
+	for attempt := 1; ; attempt++ {
+		job, err := p.claimBarcodeJob()
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == "23505" && attempt < claimAttempts {
+			continue
+		}
+		return job, err
+	}
+}
+
+func (p *Postgres) claimBarcodeJob() (*model.BarcodeJob, error) {
+	status := p.cfg.WorkerConfig.JobStatus
+	printers, printerArgs := printerFilter(p.cfg.WorkerConfig.Printers, func(int) string { return "?" })
+	query := rebind(`
+		WITH next AS (
+			SELECT j.id FROM barcode_jobs j
+			WHERE j.status = ? AND j.attempts < ?
+			AND (j.notBefore IS NULL OR j.notBefore <= now())
+			AND NOT EXISTS (
+				SELECT 1 FROM barcode_jobs b
+				WHERE b.printerKey = j.printerKey AND b.status = ?
+			)` + printers + `
+			ORDER BY j.priority DESC,
+				(SELECT MAX(c.claimedAt) FROM barcode_jobs c WHERE c.printerKey = j.printerKey) NULLS FIRST,
+				j.createdAt, j.id
+			LIMIT 1
+			FOR UPDATE OF j SKIP LOCKED
+		)
+		UPDATE barcode_jobs
+		SET status = ?, attempts = attempts + 1, updatedAt = now(),
+			leaseOwner = ?, leaseExpiresAt = now() + make_interval(secs => ?),
+			claimedAt = clock_timestamp()
+		FROM next
+		WHERE barcode_jobs.id = next.id
+		RETURNING barcode_jobs.id, vid, pid, sizeX, sizeY, direction, topText, barcodeData, printCount, labelGapLength, labelGapOffset, status, attempts, priority, printedCount, serial, apiKeyId, requestId`)
+
+	args := []any{status.StatusPending, p.cfg.WorkerConfig.MaxJobAttempts, status.StatusInProgress}
+	args = append(args, printerArgs...)
+	args = append(args, status.StatusInProgress, p.cfg.WorkerConfig.InstanceID, p.leaseSeconds())
+
+	var job model.BarcodeJob
+	var serial, requestID sql.NullString
+	err := p.db.QueryRow(query, args...).Scan(
+		&job.ID, &job.VID, &job.PID, &job.SizeX, &job.SizeY,
+		&job.Direction, &job.TopText, &job.BarcodeData,
+		&job.PrintCount, &job.LabelGapLength, &job.LabelGapOffset,
+		&job.Status, &job.Attempts, &job.Priority, &job.PrintedCount, &serial, &job.APIKeyID, &requestID,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	job.RequestID = requestID.String
+	if err := scanSerial(serial, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// NextBarcodeJobDue returns when the earliest held pending job becomes
+// claimable, or nil if no job is held.
+func (p *Postgres) NextBarcodeJobDue() (*time.Time, error) {
+	var next sql.NullTime
+	err := p.db.QueryRow(
+		`SELECT MIN(notBefore) FROM barcode_jobs WHERE status = $1 AND notBefore > now()`,
+		p.cfg.WorkerConfig.JobStatus.StatusPending,
+	).Scan(&next)
+	if err != nil || !next.Valid {
+		return nil, err
+	}
+	return &next.Time, nil
+}
+
+func (p *Postgres) leaseSeconds() float64 {
+	return p.cfg.WorkerConfig.LeaseDuration.Seconds()
+}
+
+// RenewBarcodeJobLease extends the lease on a job this instance is
+// printing. It is called periodically as a heartbeat.
+func (p *Postgres) RenewBarcodeJobLease(jobID int) error {
+	return p.updateLeasedJob(
+		`leaseExpiresAt = now() + make_interval(secs => ?)`,
+		jobID, p.leaseSeconds(),
+	)
+}
+
+// UpdateBarcodeJobProgress records how many labels of a job this instance
+// is printing have been sent to the printer, so a retry can resume there.
+func (p *Postgres) UpdateBarcodeJobProgress(jobID int, printedCount int) error {
+	return p.updateLeasedJob(
+		`printedCount = ?, leaseExpiresAt = now() + make_interval(secs => ?), updatedAt = now()`,
+		jobID, printedCount, p.leaseSeconds(),
+	)
+}
+
+// UrgentBarcodeJobWaiting reports whether a claimable job for the printer
+// has a higher priority than priority, as in SQLite.
+func (p *Postgres) UrgentBarcodeJobWaiting(printerKey string, priority int) (bool, error) {
+	var waiting bool
+	err := p.db.QueryRow(
+		`SELECT EXISTS (
+			SELECT 1 FROM barcode_jobs
+			WHERE printerKey = $1 AND status = $2 AND priority > $3 AND attempts < $4
+			AND (notBefore IS NULL OR notBefore <= now())
+		)`,
+		printerKey,
+		p.cfg.WorkerConfig.JobStatus.StatusPending,
+		priority,
+		p.cfg.WorkerConfig.MaxJobAttempts,
+	).Scan(&waiting)
+	return waiting, err
+}
+
+// YieldBarcodeJob puts a job this instance is printing back in the queue
+// with its progress, as in SQLite, and announces it to every instance.
+func (p *Postgres) YieldBarcodeJob(jobID int) error {
+	err := p.updateLeasedJob(
+		`status = ?, attempts = attempts - 1, leaseOwner = NULL, leaseExpiresAt = NULL, updatedAt = now()`,
+		jobID, p.cfg.WorkerConfig.JobStatus.StatusPending,
+	)
+	if err != nil {
+		return err
+	}
+	p.notifyBarcodeJobReady()
+	return announceBarcodeJob(p.db)
+}
+
+// CompleteBarcodeJob stores the outcome of a job this instance printed
+// and releases its lease. If the lease was lost in the meantime the job
+// has been recovered elsewhere and ErrLeaseLost is returned instead.
+func (p *Postgres) CompleteBarcodeJob(jobID int, status string) error {
+	return p.updateLeasedJob(
+		`status = ?, leaseOwner = NULL, leaseExpiresAt = NULL, updatedAt = now()`,
+		jobID, status,
+	)
+}
+
+// updateLeasedJob applies set to a job only while this instance holds its
+// lease.
+func (p *Postgres) updateLeasedJob(set string, jobID int, setArgs ...any) error {
+	args := append(setArgs, jobID, p.cfg.WorkerConfig.JobStatus.StatusInProgress, p.cfg.WorkerConfig.InstanceID)
+	res, err := p.db.Exec(
+		rebind(`UPDATE barcode_jobs SET `+set+` WHERE id = ? AND status = ? AND leaseOwner = ?`),
+		args...,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// RecoverExpiredBarcodeJobs applies the recovery policy to in-progress
+// jobs whose lease has expired, and returns their ids.
+func (p *Postgres) RecoverExpiredBarcodeJobs() ([]int, error) {
+	return p.recoverBarcodeJobs(`leaseExpiresAt IS NULL OR leaseExpiresAt < now()`)
+}
+
+// RecoverOrphanedBarcodeJobs applies the recovery policy to in-progress
+// jobs leased to this instance. It must run before the workers start.
+func (p *Postgres) RecoverOrphanedBarcodeJobs() ([]int, error) {
+	return p.recoverBarcodeJobs(`leaseOwner = ?`, p.cfg.WorkerConfig.InstanceID)
+}
+
+func (p *Postgres) recoverBarcodeJobs(where string, args ...any) ([]int, error) {
+	status := p.cfg.WorkerConfig.JobStatus
+	var set string
+	var setArgs []any
+	switch p.cfg.WorkerConfig.RecoveryPolicy {
+	case config.RecoveryUnknown:
+		set = `status = ?`
+		setArgs = []any{status.StatusUnknown}
+	default:
+		set = `status = CASE WHEN attempts < ? THEN ? ELSE ? END`
+		setArgs = []any{p.cfg.WorkerConfig.MaxJobAttempts, status.StatusPending, status.StatusFailed}
+	}
+
+	query := rebind(fmt.Sprintf(
+		`UPDATE barcode_jobs
+			 SET %s, leaseOwner = NULL, leaseExpiresAt = NULL, updatedAt = now()
+			 WHERE status = ? AND (%s)
+			 RETURNING id`,
+		set, where,
+	))
+	queryArgs := append(append(setArgs, status.StatusInProgress), args...)
+
+	rows, err := p.db.Query(query, queryArgs...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// Requeued jobs may be claimable by other print servers.
+	if len(ids) > 0 && p.cfg.WorkerConfig.RecoveryPolicy != config.RecoveryUnknown {
+		if err := announceBarcodeJob(p.db); err != nil {
+			slog.Warn("Error announcing recovered jobs", "error", err)
+		}
+	}
+	return ids, nil
+}
+
+// BarcodeJobsToPurge returns up to limit jobs with the given status that
+// are older than maxAge, or beyond the newest keep jobs, oldest first.
+func (p *Postgres) BarcodeJobsToPurge(status string, maxAge time.Duration, keep int, limit int) ([]*model.BarcodeJob, error) {
+	var bounds []string
+	args := []any{status}
+	if maxAge > 0 {
+		bounds = append(bounds, `updatedAt < now() - make_interval(secs => ?)`)
+		args = append(args, maxAge.Seconds())
+	}
+	if keep > 0 {
+		bounds = append(bounds, `id IN (
+			SELECT id FROM barcode_jobs WHERE status = ?
+			ORDER BY updatedAt DESC, id DESC OFFSET ?)`)
+		args = append(args, status, keep)
+	}
+	if len(bounds) == 0 {
+		return nil, nil
+	}
+	args = append(args, limit)
+
+	rows, err := p.db.Query(rebind(
+		`SELECT `+barcodeJobColumns+` FROM barcode_jobs
+		 WHERE status = ? AND (`+strings.Join(bounds, " OR ")+`)
+		 ORDER BY updatedAt, id LIMIT ?`),
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*model.BarcodeJob
+	for rows.Next() {
+		job, err := scanBarcodeJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// DeleteBarcodeJobs deletes the given jobs, skipping any that have left
+// the status they were selected in.
+func (p *Postgres) DeleteBarcodeJobs(status string, ids []int) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	args := []any{status}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	res, err := p.db.Exec(
+		rebind(`DELETE FROM barcode_jobs WHERE status = ? AND id IN (?`+strings.Repeat(",?", len(ids)-1)+`)`),
+		args...,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Optimize refreshes the query planner statistics and reclaims the space
+// of purged jobs for reuse. Autovacuum does the same on its own schedule.
+func (p *Postgres) Optimize() error {
+	if _, err := p.db.Exec(`VACUUM (ANALYZE) barcode_jobs, job_schedules`); err != nil {
+		return fmt.Errorf("vacuum failed: %w", err)
+	}
+	return nil
+}
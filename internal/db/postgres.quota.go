@@ -0,0 +1,32 @@
+package db
+
+import "time"
+
+func (p *Postgres) KeyLabelsSince(apiKeyID int64, since time.Time) (int, error) {
+	var n int
+	err := p.db.QueryRow(
+		`SELECT COALESCE(SUM(printCount), 0) FROM barcode_jobs
+		 WHERE apiKeyId = $1 AND createdAt >= $2`,
+		apiKeyID, since,
+	).Scan(&n)
+	return n, err
+}
+
+func (p *Postgres) PrinterLabelsSince(printerKey string, since time.Time) (int, error) {
+	var n int
+	err := p.db.QueryRow(
+		`SELECT COALESCE(SUM(printCount), 0) FROM barcode_jobs
+		 WHERE printerKey = $1 AND createdAt >= $2`,
+		printerKey, since,
+	).Scan(&n)
+	return n, err
+}
+
+func (p *Postgres) QueuedBarcodeJobs(printerKey string) (int, error) {
+	var n int
+	err := p.db.QueryRow(
+		`SELECT COUNT(*) FROM barcode_jobs WHERE status IN ($1, $2) AND printerKey = $3`,
+		p.cfg.WorkerConfig.JobStatus.StatusPending, p.cfg.WorkerConfig.JobStatus.StatusInProgress, printerKey,
+	).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,156 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"pos-printer/internal/model"
+	"time"
+)
+
+func (p *Postgres) CreateBarcodeSchedule(sched *model.BarcodeSchedule) (int64, error) {
+	job, err := json.Marshal(sched.Job)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	var id int64
+	err = p.db.QueryRow(
+		`INSERT INTO job_schedules (name, cron, enabled, job, nextRunAt, createdAt, updatedAt, apiKeyId)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+		 RETURNING id`,
+		sched.Name, sched.Cron, sched.Enabled, string(job), sched.NextRunAt, now, now, sched.APIKeyID,
+	).Scan(&id)
+	return id, err
+}
+
+// UpdateBarcodeSchedule replaces a schedule's definition, keeping its run
+// history. It returns sql.ErrNoRows if the schedule does not exist.
+func (p *Postgres) UpdateBarcodeSchedule(sched *model.BarcodeSchedule) error {
+	job, err := json.Marshal(sched.Job)
+	if err != nil {
+		return err
+	}
+	res, err := p.db.Exec(
+		`UPDATE job_schedules
+			 SET name = $1, cron = $2, enabled = $3, job = $4, nextRunAt = $5, updatedAt = now()
+			 WHERE id = $6`,
+		sched.Name, sched.Cron, sched.Enabled, string(job), sched.NextRunAt, sched.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (p *Postgres) DeleteBarcodeSchedule(id string) error {
+	schedID, err := parseID(id)
+	if err != nil {
+		return err
+	}
+	res, err := p.db.Exec(`DELETE FROM job_schedules WHERE id = $1`, schedID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (p *Postgres) FetchBarcodeSchedule(id string) (*model.BarcodeSchedule, error) {
+	schedID, err := parseID(id)
+	if err != nil {
+		return nil, err
+	}
+	return scanSchedule(p.db.QueryRow(`SELECT `+scheduleColumns+` FROM job_schedules WHERE id = $1`, schedID))
+}
+
+func (p *Postgres) ListBarcodeSchedules() ([]*model.BarcodeSchedule, error) {
+	return querySchedules(p.db, `SELECT `+scheduleColumns+` FROM job_schedules ORDER BY id`)
+}
+
+// DueBarcodeSchedules returns the enabled schedules whose next run is at
+// or before now.
+func (p *Postgres) DueBarcodeSchedules(now time.Time) ([]*model.BarcodeSchedule, error) {
+	return querySchedules(p.db,
+		`SELECT `+scheduleColumns+` FROM job_schedules
+		 WHERE enabled AND nextRunAt IS NOT NULL AND nextRunAt <= $1
+		 ORDER BY nextRunAt, id`,
+		now,
+	)
+}
+
+// NextBarcodeScheduleRun returns the earliest next run of any enabled
+// schedule, or nil if there is none.
+func (p *Postgres) NextBarcodeScheduleRun() (*time.Time, error) {
+	var next sql.NullTime
+	err := p.db.QueryRow(`SELECT MIN(nextRunAt) FROM job_schedules WHERE enabled`).Scan(&next)
+	if err != nil || !next.Valid {
+		return nil, err
+	}
+	return &next.Time, nil
+}
+
+// FireBarcodeSchedule enqueues job for a due schedule and advances it to
+// nextRunAt, in one transaction. If another process fired the schedule
+// first, nothing is enqueued and fired is false. The job is attributed to
+// the key that created the schedule.
+func (p *Postgres) FireBarcodeSchedule(sched *model.BarcodeSchedule, job model.PrintBarcodeRequest, nextRunAt time.Time) (jobID int64, fired bool, err error) {
+	tx, err := p.db.Begin()
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(
+		`UPDATE job_schedules
+			 SET nextRunAt = $1, lastRunAt = now(), updatedAt = now()
+			 WHERE id = $2 AND enabled AND nextRunAt = $3`,
+		nextRunAt, sched.ID, sched.NextRunAt,
+	)
+	if err != nil {
+		return 0, false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, false, nil
+	}
+
+	job.APIKeyID = sched.APIKeyID
+	jobID, err = p.insertBarcodeJob(tx, job)
+	if err != nil {
+		return 0, false, err
+	}
+	if _, err := tx.Exec(`UPDATE job_schedules SET lastJobId = $1 WHERE id = $2`, jobID, sched.ID); err != nil {
+		return 0, false, err
+	}
+	if err := announceBarcodeJob(tx); err != nil {
+		return 0, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, false, err
+	}
+
+	p.notifyBarcodeJobReady()
+	return jobID, true, nil
+}
+
+// SkipBarcodeSchedule advances a due schedule to nextRunAt without
+// enqueuing its job, and with disable, turns it off. Like
+// FireBarcodeSchedule, it does nothing and returns false if another
+// process got to the schedule first.
+func (p *Postgres) SkipBarcodeSchedule(sched *model.BarcodeSchedule, nextRunAt time.Time, disable bool) (bool, error) {
+	res, err := p.db.Exec(
+		`UPDATE job_schedules
+			 SET nextRunAt = $1, enabled = enabled AND NOT $2, updatedAt = now()
+			 WHERE id = $3 AND enabled AND nextRunAt = $4`,
+		nextRunAt, disable, sched.ID, sched.NextRunAt,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"pos-printer/internal/config"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testPostgresURLEnv names the database the Postgres tests run against.
+// They are skipped when it is not set. Every test works in a schema of its
+// own, dropped when the test ends.
+const testPostgresURLEnv = "POS_PRINTER_TEST_POSTGRES_URL"
+
+// testDriver opens databases of one driver for the tests that run against
+// every driver.
+type testDriver struct {
+	name   string
+	config func(t *testing.T) *config.Config // a new, empty database
+}
+
+var testDrivers = []testDriver{
+	{name: "sqlite", config: testConfig},
+	{name: "postgres", config: testPostgresConfig},
+}
+
+// forEachDriver runs test against a new database of every driver.
+func forEachDriver(t *testing.T, test func(t *testing.T, cfg *config.Config)) {
+	for _, driver := range testDrivers {
+		t.Run(driver.name, func(t *testing.T) {
+			test(t, driver.config(t))
+		})
+	}
+}
+
+// newTestStore opens a migrated store for cfg, closed with the test.
+func newTestStore(t *testing.T, cfg *config.Config) JobStore {
+	t.Helper()
+	store, err := NewJobStore(cfg)
+	if err != nil {
+		t.Fatalf("NewJobStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// testPostgresConfig returns the default configuration for a new schema
+// in the database of testPostgresURLEnv, or skips the test.
+func testPostgresConfig(t *testing.T) *config.Config {
+	t.Helper()
+	dbURL := os.Getenv(testPostgresURLEnv)
+	if dbURL == "" {
+		t.Skip(testPostgresURLEnv + " is not set")
+	}
+
+	admin, err := sql.Open("pgx", dbURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("pos_printer_test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		admin.Close()
+		t.Fatalf("creating schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`); err != nil {
+			t.Errorf("dropping schema: %v", err)
+		}
+		admin.Close()
+	})
+
+	cfg, err := config.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DBConfig.Driver = config.DriverPostgres
+	cfg.DBConfig.PostgresURL = withSearchPath(dbURL, schema)
+	cfg.DBConfig.Migrate = true
+	cfg.WorkerConfig.Printers = nil
+	return cfg
+}
+
+// withSearchPath points a connection string, URL or key/value, at schema.
+func withSearchPath(dbURL, schema string) string {
+	if !strings.HasPrefix(dbURL, "postgres://") && !strings.HasPrefix(dbURL, "postgresql://") {
+		return dbURL + " search_path=" + schema
+	}
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		return dbURL
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func TestRebind(t *testing.T) {
+	for query, want := range map[string]string{
+		`SELECT 1`:                           `SELECT 1`,
+		`WHERE id = ?`:                       `WHERE id = $1`,
+		`SET a = ?, b = ? WHERE c IN (?, ?)`: `SET a = $1, b = $2 WHERE c IN ($3, $4)`,
+	} {
+		if got := rebind(query); got != want {
+			t.Errorf("rebind(%q) = %q, want %q", query, got, want)
+		}
+	}
+}
+
+// TestPostgresAnnouncesJobs checks that a job enqueued by one instance
+// wakes the workers of another through LISTEN/NOTIFY.
+func TestPostgresAnnouncesJobs(t *testing.T) {
+	cfg := testPostgresConfig(t)
+	producer := newTestStore(t, cfg)
+	consumer := newTestStore(t, cfg)
+
+	// The listener signals once when it connects, for jobs enqueued while
+	// no one was listening.
+	select {
+	case <-consumer.BarcodeJobReady():
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener did not connect")
+	}
+
+	enqueueTestJobs(t, producer, 1, 1)
+	select {
+	case <-consumer.BarcodeJobReady():
+	case <-time.After(5 * time.Second):
+		t.Fatal("the other instance was not woken by the enqueued job")
+	}
+}
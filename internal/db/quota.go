@@ -0,0 +1,38 @@
+package db
+
+import "time"
+
+// KeyLabelsSince sums the labels of the jobs an API key enqueued since the
+// given time, whatever became of them.
+func (s *SQLite) KeyLabelsSince(apiKeyID int64, since time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRow(
+		`SELECT COALESCE(SUM(printCount), 0) FROM barcode_jobs
+		 WHERE apiKeyId = ? AND DATETIME(createdAt) >= ?`,
+		apiKeyID, sqliteTime(&since),
+	).Scan(&n)
+	return n, err
+}
+
+// PrinterLabelsSince sums the labels of the jobs enqueued for a printer
+// since the given time, whatever became of them.
+func (s *SQLite) PrinterLabelsSince(printerKey string, since time.Time) (int, error) {
+	var n int
+	err := s.db.QueryRow(
+		`SELECT COALESCE(SUM(printCount), 0) FROM barcode_jobs
+		 WHERE printerKey = ? AND DATETIME(createdAt) >= ?`,
+		printerKey, sqliteTime(&since),
+	).Scan(&n)
+	return n, err
+}
+
+// QueuedBarcodeJobs counts a printer's pending and printing jobs, delayed
+// ones included.
+func (s *SQLite) QueuedBarcodeJobs(printerKey string) (int, error) {
+	var n int
+	err := s.db.QueryRow(
+		`SELECT COUNT(*) FROM barcode_jobs WHERE status IN (?, ?) AND printerKey = ?`,
+		s.cfg.WorkerConfig.JobStatus.StatusPending, s.cfg.WorkerConfig.JobStatus.StatusInProgress, printerKey,
+	).Scan(&n)
+	return n, err
+}
@@ -0,0 +1,84 @@
+package db
+
+import (
+	"fmt"
+	"pos-printer/internal/model"
+	"strings"
+	"time"
+)
+
+// BarcodeJobsToPurge returns up to limit jobs with the given status that
+// are older than maxAge, or beyond the newest keep jobs, oldest first. A
+// zero maxAge or keep disables that bound.
+func (s *SQLite) BarcodeJobsToPurge(status string, maxAge time.Duration, keep int, limit int) ([]*model.BarcodeJob, error) {
+	var bounds []string
+	args := []any{status}
+	if maxAge > 0 {
+		bounds = append(bounds, `updatedAt < DATETIME('now', ?)`)
+		args = append(args, fmt.Sprintf("-%d seconds", int(maxAge.Seconds())))
+	}
+	if keep > 0 {
+		bounds = append(bounds, `id IN (
+			SELECT id FROM barcode_jobs WHERE status = ?
+			ORDER BY updatedAt DESC, id DESC LIMIT -1 OFFSET ?)`)
+		args = append(args, status, keep)
+	}
+	if len(bounds) == 0 {
+		return nil, nil
+	}
+	args = append(args, limit)
+
+	rows, err := s.db.Query(
+		`SELECT `+barcodeJobColumns+` FROM barcode_jobs
+		 WHERE status = ? AND (`+strings.Join(bounds, " OR ")+`)
+		 ORDER BY updatedAt, id LIMIT ?`,
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var jobs []*model.BarcodeJob
+	for rows.Next() {
+		job, err := scanBarcodeJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, rows.Err()
+}
+
+// DeleteBarcodeJobs deletes the given jobs, skipping any that have left
+// the status they were selected in.
+func (s *SQLite) DeleteBarcodeJobs(status string, ids []int) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	args := []any{status}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	res, err := s.db.Exec(
+		`DELETE FROM barcode_jobs WHERE status = ? AND id IN (?`+strings.Repeat(",?", len(ids)-1)+`)`,
+		args...,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Optimize refreshes the query planner statistics and rebuilds the
+// database file to return the space freed by purged jobs.
+func (s *SQLite) Optimize() error {
+	if _, err := s.db.Exec(`ANALYZE`); err != nil {
+		return fmt.Errorf("analyze failed: %w", err)
+	}
+	if _, err := s.db.Exec(`VACUUM`); err != nil {
+		return fmt.Errorf("vacuum failed: %w", err)
+	}
+	return nil
+}
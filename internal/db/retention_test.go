@@ -0,0 +1,105 @@
+package db
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestBarcodeJobsToPurge(t *testing.T) {
+	cfg := testConfig(t)
+	status := cfg.WorkerConfig.JobStatus
+	store := newTestSQLite(t, cfg)
+
+	// Jobs 3 and 4 were last updated at the same time.
+	jobs := []struct {
+		status string
+		age    time.Duration
+	}{
+		{status.StatusDone, 50 * time.Hour},
+		{status.StatusDone, 30 * time.Hour},
+		{status.StatusDone, 10 * time.Hour},
+		{status.StatusDone, time.Hour},
+		{status.StatusDone, time.Hour},
+		{status.StatusFailed, 100 * time.Hour},
+	}
+	ids := enqueueTestJobs(t, store, len(jobs), 1)
+	now := time.Now().UTC()
+	for i, job := range jobs {
+		_, err := store.db.Exec(`UPDATE barcode_jobs SET status = ?, updatedAt = ? WHERE id = ?`,
+			job.status, now.Add(-job.age).Format(time.DateTime), ids[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		status string
+		maxAge time.Duration
+		keep   int
+		limit  int
+		want   []int // indexes into jobs, in the order returned
+	}{
+		{name: "no bounds", status: status.StatusDone},
+		{name: "older than the max age", status: status.StatusDone, maxAge: 24 * time.Hour, want: []int{0, 1}},
+		{name: "just within the max age", status: status.StatusDone, maxAge: 31 * time.Hour, want: []int{0}},
+		{name: "beyond the newest kept", status: status.StatusDone, keep: 2, want: []int{0, 1, 2}},
+		{name: "kept ties go to the higher id", status: status.StatusDone, keep: 1, want: []int{0, 1, 2, 3}},
+		{name: "fewer jobs than kept", status: status.StatusDone, keep: 5},
+		{name: "either bound", status: status.StatusDone, maxAge: 40 * time.Hour, keep: 3, want: []int{0, 1}},
+		{name: "limit takes the oldest", status: status.StatusDone, keep: 1, limit: 2, want: []int{0, 1}},
+		{name: "other statuses are not counted", status: status.StatusFailed, keep: 1},
+		{name: "only the given status", status: status.StatusFailed, maxAge: 24 * time.Hour, want: []int{5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limit := tt.limit
+			if limit == 0 {
+				limit = len(jobs)
+			}
+			got, err := store.BarcodeJobsToPurge(tt.status, tt.maxAge, tt.keep, limit)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var gotIDs, wantIDs []int
+			for _, job := range got {
+				gotIDs = append(gotIDs, job.ID)
+			}
+			for _, i := range tt.want {
+				wantIDs = append(wantIDs, ids[i])
+			}
+			if !reflect.DeepEqual(gotIDs, wantIDs) {
+				t.Errorf("BarcodeJobsToPurge = %v, want %v", gotIDs, wantIDs)
+			}
+		})
+	}
+}
+
+func TestDeleteBarcodeJobs(t *testing.T) {
+	cfg := testConfig(t)
+	status := cfg.WorkerConfig.JobStatus
+	store := newTestSQLite(t, cfg)
+	ids := enqueueTestJobs(t, store, 3, 1)
+	if _, err := store.db.Exec(`UPDATE barcode_jobs SET status = ?`, status.StatusDone); err != nil {
+		t.Fatal(err)
+	}
+
+	// A job retried after it was selected is no longer purged.
+	if _, err := store.db.Exec(`UPDATE barcode_jobs SET status = ? WHERE id = ?`, status.StatusPending, ids[1]); err != nil {
+		t.Fatal(err)
+	}
+	n, err := store.DeleteBarcodeJobs(status.StatusDone, ids)
+	if err != nil || n != 2 {
+		t.Fatalf("DeleteBarcodeJobs = %d, %v, want 2 deleted", n, err)
+	}
+	if _, err := store.FetchBarcodeJob(strconv.Itoa(ids[1])); err != nil {
+		t.Errorf("the job that left the status was deleted: %v", err)
+	}
+
+	if n, err := store.DeleteBarcodeJobs(status.StatusDone, nil); err != nil || n != 0 {
+		t.Errorf("DeleteBarcodeJobs(nil) = %d, %v, want 0", n, err)
+	}
+}
@@ -0,0 +1,215 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"pos-printer/internal/model"
+	"time"
+)
+
+const scheduleColumns = `id, name, cron, enabled, job, nextRunAt, lastRunAt, lastJobId, createdAt, updatedAt, apiKeyId`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSchedule(row rowScanner) (*model.BarcodeSchedule, error) {
+	var sched model.BarcodeSchedule
+	var job string
+	var nextRunAt, lastRunAt sql.NullTime
+	var lastJobID, apiKeyID sql.NullInt64
+
+	err := row.Scan(
+		&sched.ID, &sched.Name, &sched.Cron, &sched.Enabled, &job,
+		&nextRunAt, &lastRunAt, &lastJobID, &sched.CreatedAt, &sched.UpdatedAt,
+		&apiKeyID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(job), &sched.Job); err != nil {
+		return nil, err
+	}
+	if nextRunAt.Valid {
+		sched.NextRunAt = &nextRunAt.Time
+	}
+	if lastRunAt.Valid {
+		sched.LastRunAt = &lastRunAt.Time
+	}
+	if lastJobID.Valid {
+		sched.LastJobID = &lastJobID.Int64
+	}
+	if apiKeyID.Valid {
+		sched.APIKeyID = &apiKeyID.Int64
+	}
+	return &sched, nil
+}
+
+func (s *SQLite) CreateBarcodeSchedule(sched *model.BarcodeSchedule) (int64, error) {
+	job, err := json.Marshal(sched.Job)
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now().UTC()
+	res, err := s.db.Exec(
+		`INSERT INTO job_schedules (name, cron, enabled, job, nextRunAt, createdAt, updatedAt, apiKeyId)
+		 VALUES (?,?,?,?,?,?,?,?)`,
+		sched.Name, sched.Cron, sched.Enabled, string(job), sqliteTime(sched.NextRunAt),
+		sqliteTime(&now), sqliteTime(&now), sched.APIKeyID,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.LastInsertId()
+}
+
+// UpdateBarcodeSchedule replaces a schedule's definition, keeping its run
+// history. It returns sql.ErrNoRows if the schedule does not exist.
+func (s *SQLite) UpdateBarcodeSchedule(sched *model.BarcodeSchedule) error {
+	job, err := json.Marshal(sched.Job)
+	if err != nil {
+		return err
+	}
+	res, err := s.db.Exec(
+		`UPDATE job_schedules
+			 SET name = ?, cron = ?, enabled = ?, job = ?, nextRunAt = ?, updatedAt = DATETIME('now')
+			 WHERE id = ?`,
+		sched.Name, sched.Cron, sched.Enabled, string(job), sqliteTime(sched.NextRunAt), sched.ID,
+	)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *SQLite) DeleteBarcodeSchedule(id string) error {
+	res, err := s.db.Exec(`DELETE FROM job_schedules WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (s *SQLite) FetchBarcodeSchedule(id string) (*model.BarcodeSchedule, error) {
+	row := s.db.QueryRow(`SELECT `+scheduleColumns+` FROM job_schedules WHERE id = ?`, id)
+	return scanSchedule(row)
+}
+
+func (s *SQLite) ListBarcodeSchedules() ([]*model.BarcodeSchedule, error) {
+	return querySchedules(s.db, `SELECT `+scheduleColumns+` FROM job_schedules ORDER BY id`)
+}
+
+// DueBarcodeSchedules returns the enabled schedules whose next run is at
+// or before now.
+func (s *SQLite) DueBarcodeSchedules(now time.Time) ([]*model.BarcodeSchedule, error) {
+	return querySchedules(s.db,
+		`SELECT `+scheduleColumns+` FROM job_schedules
+		 WHERE enabled = 1 AND nextRunAt IS NOT NULL AND nextRunAt <= ?
+		 ORDER BY nextRunAt, id`,
+		sqliteTime(&now),
+	)
+}
+
+// NextBarcodeScheduleRun returns the earliest next run of any enabled
+// schedule, or nil if there is none.
+func (s *SQLite) NextBarcodeScheduleRun() (*time.Time, error) {
+	var next sql.NullString
+	err := s.db.QueryRow(
+		`SELECT MIN(nextRunAt) FROM job_schedules WHERE enabled = 1`,
+	).Scan(&next)
+	if err != nil || !next.Valid {
+		return nil, err
+	}
+	t, err := time.Parse(sqliteTimeLayout, next.String)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+func querySchedules(db querier, query string, args ...any) ([]*model.BarcodeSchedule, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []*model.BarcodeSchedule{}
+	for rows.Next() {
+		sched, err := scanSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, sched)
+	}
+	return schedules, rows.Err()
+}
+
+// FireBarcodeSchedule enqueues job for a due schedule and advances it to
+// nextRunAt, in one transaction. If another process fired the schedule
+// first, nothing is enqueued and fired is false. The job is attributed to
+// the key that created the schedule.
+func (s *SQLite) FireBarcodeSchedule(sched *model.BarcodeSchedule, job model.PrintBarcodeRequest, nextRunAt time.Time) (jobID int64, fired bool, err error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	now := time.Now()
+	res, err := tx.Exec(
+		`UPDATE job_schedules
+			 SET nextRunAt = ?, lastRunAt = ?, updatedAt = DATETIME('now')
+			 WHERE id = ? AND enabled = 1 AND nextRunAt = ?`,
+		sqliteTime(&nextRunAt), sqliteTime(&now), sched.ID, sqliteTime(sched.NextRunAt),
+	)
+	if err != nil {
+		return 0, false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return 0, false, nil
+	}
+
+	job.APIKeyID = sched.APIKeyID
+	jobID, err = s.insertBarcodeJob(tx, job)
+	if err != nil {
+		return 0, false, err
+	}
+	if _, err := tx.Exec(`UPDATE job_schedules SET lastJobId = ? WHERE id = ?`, jobID, sched.ID); err != nil {
+		return 0, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, false, err
+	}
+
+	s.notifyBarcodeJobReady()
+	return jobID, true, nil
+}
+
+// SkipBarcodeSchedule advances a due schedule to nextRunAt without
+// enqueuing its job, and with disable, turns it off. Like
+// FireBarcodeSchedule, it does nothing and returns false if another
+// process got to the schedule first.
+func (s *SQLite) SkipBarcodeSchedule(sched *model.BarcodeSchedule, nextRunAt time.Time, disable bool) (bool, error) {
+	res, err := s.db.Exec(
+		`UPDATE job_schedules
+			 SET nextRunAt = ?, enabled = enabled AND NOT ?, updatedAt = DATETIME('now')
+			 WHERE id = ? AND enabled = 1 AND nextRunAt = ?`,
+		sqliteTime(&nextRunAt), disable, sched.ID, sqliteTime(sched.NextRunAt),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
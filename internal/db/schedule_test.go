@@ -0,0 +1,53 @@
+package db
+
+import (
+	"pos-printer/internal/model"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestSkipBarcodeSchedule(t *testing.T) {
+	for _, disable := range []bool{false, true} {
+		t.Run("disable="+strconv.FormatBool(disable), func(t *testing.T) {
+			store := newTestSQLite(t, testConfig(t))
+			due := time.Now().Add(-time.Minute).Truncate(time.Second)
+			sched := &model.BarcodeSchedule{
+				Name: "morning", Cron: "@daily", Enabled: true, NextRunAt: &due,
+				Job: model.PrintBarcodeRequest{VID: "0x0fe6", PID: "0x8800", BarcodeData: "1", PrintCount: 1},
+			}
+			id, err := store.CreateBarcodeSchedule(sched)
+			if err != nil {
+				t.Fatalf("CreateBarcodeSchedule: %v", err)
+			}
+			sched.ID = int(id)
+
+			next := due.Add(24 * time.Hour)
+			skipped, err := store.SkipBarcodeSchedule(sched, next, disable)
+			if err != nil || !skipped {
+				t.Fatalf("SkipBarcodeSchedule = %v, %v, want skipped", skipped, err)
+			}
+			// The run is taken, a second skip or a fire finds nothing to do.
+			if skipped, err := store.SkipBarcodeSchedule(sched, next, disable); err != nil || skipped {
+				t.Errorf("second SkipBarcodeSchedule = %v, %v, want not skipped", skipped, err)
+			}
+			if _, fired, err := store.FireBarcodeSchedule(sched, sched.Job, next); err != nil || fired {
+				t.Errorf("FireBarcodeSchedule = %v, %v, want not fired", fired, err)
+			}
+
+			got, err := store.FetchBarcodeSchedule(strconv.Itoa(sched.ID))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Enabled == disable {
+				t.Errorf("enabled = %v, want %v", got.Enabled, !disable)
+			}
+			if got.NextRunAt == nil || !got.NextRunAt.Equal(next) {
+				t.Errorf("nextRunAt = %v, want %v", got.NextRunAt, next)
+			}
+			if got.LastJobID != nil {
+				t.Errorf("lastJobId = %d, want no job", *got.LastJobID)
+			}
+		})
+	}
+}
@@ -3,41 +3,65 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
 	"path/filepath"
 	"pos-printer/internal/config"
-	"sync"
+	"strconv"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
-var dbMu sync.Mutex
-
 type SQLite struct {
-	db  *sql.DB
-	cfg *config.Config
+	db   *sql.DB
+	cfg  *config.Config
+	lock *os.File // shared lock on the database, see lockFile
+
+	barcodeJobReady chan struct{}
 }
 
+// NewSQLite checks the database for damage, opens it and brings its schema
+// up to date, or with migration disabled, checks that it is.
 func NewSQLite(cfg *config.Config) (*SQLite, error) {
+	if cfg.BackupConfig.IntegrityCheck {
+		restored, err := CheckSQLite(cfg)
+		if err != nil {
+			return nil, err
+		}
+		if restored != "" {
+			slog.Warn("Database was damaged and has been restored from a backup", "backup", restored)
+		}
+	}
+
+	sqlite, err := OpenSQLite(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return openMigrated(sqlite, cfg)
+}
+
+// OpenSQLite opens the database without touching its schema.
+func OpenSQLite(cfg *config.Config) (*SQLite, error) {
 
 	absPath, err := filepath.Abs(cfg.DBConfig.SQLitePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get absolute path: %w", err)
 	}
 
-	fmt.Println("Opening SQLite database at:", absPath)
+	slog.Info("Opening SQLite database", "path", absPath)
 
 	dir := filepath.Dir(absPath)
 
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		fmt.Println("Directory does not exist, creating:", dir)
+		slog.Info("Creating the database directory", "path", dir)
 		if err := os.MkdirAll(dir, 0755); err != nil {
 			return nil, fmt.Errorf("failed to create directory: %w", err)
 		}
 	}
 
 	if _, err := os.Stat(absPath); os.IsNotExist(err) {
-		fmt.Println("SQLite database does not exist, creating new one")
+		slog.Info("SQLite database does not exist, creating a new one")
 		file, err := os.Create(absPath)
 		if err != nil {
 			return nil, fmt.Errorf("failed to create database file: %w", err)
@@ -45,45 +69,62 @@ func NewSQLite(cfg *config.Config) (*SQLite, error) {
 		file.Close()
 	}
 
-	db, err := sql.Open("sqlite3", absPath)
+	// A restore takes the lock exclusively, so it cannot replace the
+	// database under a process that has it open.
+	lock, err := lockFile(absPath+lockSuffix, false)
 	if err != nil {
+		return nil, fmt.Errorf("failed to lock SQLite database: %w", err)
+	}
+
+	db, err := sql.Open("sqlite3", dsn(absPath, cfg.DBConfig))
+	if err != nil {
+		lock.Close()
 		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
 	}
+	db.SetMaxOpenConns(cfg.DBConfig.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.DBConfig.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.DBConfig.ConnMaxLifetime)
 
 	if err := db.Ping(); err != nil {
+		db.Close()
+		lock.Close()
 		return nil, fmt.Errorf("failed to ping SQLite database: %w", err)
 	}
 
-	sqlite := &SQLite{db: db, cfg: cfg}
+	return &SQLite{db: db, cfg: cfg, lock: lock, barcodeJobReady: make(chan struct{}, 1)}, nil
+}
 
-	if cfg.DBConfig.Migrate {
-		if err := sqlite.migrate(); err != nil {
-			return nil, fmt.Errorf("failed to migrate SQLite database: %v", err)
-		}
+// dsn builds the connection string, so that every connection in the pool
+// gets the same pragmas. Transactions begin IMMEDIATE: they take the write
+// lock up front, waiting for it under busy_timeout, instead of failing
+// with "database is locked" when a read turns into a write.
+func dsn(path string, cfg config.DBConfig) string {
+	params := url.Values{}
+	params.Set("_journal_mode", cfg.JournalMode)
+	params.Set("_synchronous", cfg.Synchronous)
+	params.Set("_busy_timeout", strconv.Itoa(int(cfg.BusyTimeout.Milliseconds())))
+	params.Set("_txlock", "immediate")
+	if cfg.ForeignKeys {
+		params.Set("_foreign_keys", "on")
 	}
-
-	return sqlite, nil
+	return "file:" + path + "?" + params.Encode()
 }
 
 func (s *SQLite) Close() error {
-	return s.db.Close()
+	err := s.db.Close()
+	s.lock.Close()
+	return err
 }
 
-func (s *SQLite) migrate() error {
-	stmts := []string{
-		BarcodeJobTableStmt,
-		ReceiptPDFJobTableStmt,
-	}
-
-	executeStmt := func(stmt string) error {
-		_, err := s.db.Exec(stmt)
-		return err
-	}
+// BarcodeJobReady is signalled whenever a barcode job is enqueued by this
+// process. Signals are coalesced, a receiver must drain the queue.
+func (s *SQLite) BarcodeJobReady() <-chan struct{} {
+	return s.barcodeJobReady
+}
 
-	for _, stmt := range stmts {
-		if err := executeStmt(stmt); err != nil {
-			return err
-		}
+func (s *SQLite) notifyBarcodeJobReady() {
+	select {
+	case s.barcodeJobReady <- struct{}{}:
+	default:
 	}
-	return nil
 }
@@ -1,26 +1,60 @@
 package db
 
 import (
-	"fmt"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"pos-printer/internal/config"
 	"pos-printer/internal/model"
 	"time"
 )
 
+// sqliteTimeLayout matches DATETIME('now'), so stored times compare
+// correctly against it.
+const sqliteTimeLayout = "2006-01-02 15:04:05"
+
+func sqliteTime(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
 func (s *SQLite) EnqueueBarcodeJob(req model.PrintBarcodeRequest) (int64, error) {
+	id, err := s.insertBarcodeJob(s.db, req)
+	if err != nil {
+		slog.Error("Failed to enqueue job", "request_id", req.RequestID, "error", err)
+		return 0, err
+	}
+	s.notifyBarcodeJobReady()
+	return id, nil
+}
+
+func (s *SQLite) insertBarcodeJob(db execer, req model.PrintBarcodeRequest) (int64, error) {
 	now := time.Now()
-	dbMu.Lock()
-	defer dbMu.Unlock()
-	res, err := s.db.Exec(
+	var serial any
+	if req.Serial != nil {
+		b, err := json.Marshal(req.Serial)
+		if err != nil {
+			return 0, err
+		}
+		serial = string(b)
+	}
+	res, err := db.Exec(
 		`INSERT INTO barcode_jobs 
-		(vid, pid, sizeX, sizeY, direction, topText, barcodeData, printCount, labelGapLength, labelGapOffset, status, attempts, createdAt, updatedAt)
-		 VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
+		(vid, pid, sizeX, sizeY, direction, topText, barcodeData, printCount, labelGapLength, labelGapOffset, status, attempts, createdAt, updatedAt, priority, printerKey, notBefore, serial, apiKeyId, requestId)
+		 VALUES (?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?,?)`,
 		req.VID, req.PID, req.SizeX, req.SizeY,
 		req.Direction, req.TopText, req.BarcodeData,
 		req.PrintCount, req.LabelGap.Length, req.LabelGap.Offset,
 		"pending", 0, now, now,
+		req.Priority, config.PrinterKey(req.VID, req.PID), sqliteTime(req.NotBefore), serial, req.APIKeyID, nullString(req.RequestID),
 	)
 	if err != nil {
-		fmt.Println("Failed to enqueue job", err)
 		return 0, err
 	}
 	return res.LastInsertId()
@@ -0,0 +1,206 @@
+//go:build stress
+
+package db
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"pos-printer/internal/config"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// Flags of TestClaimStress, given after -args.
+var (
+	stressJobs     = flag.Int("jobs", 2000, "number of jobs to enqueue")
+	stressProcs    = flag.Int("procs", 4, "number of worker processes")
+	stressWorkers  = flag.Int("workers", 8, "claiming goroutines per process")
+	stressPrinters = flag.Int("printers", 16, "number of printers the jobs are spread over")
+	stressReaders  = flag.Int("readers", 4, "goroutines fetching jobs while the workers run")
+	stressFor      = flag.Duration("for", 5*time.Minute, "how long the workers may take to drain the queue")
+)
+
+// stressChildEnv carries the SQLite path to a worker process, and marks
+// the test binary as one.
+const stressChildEnv = "POS_PRINTER_CLAIM_STRESS_DB"
+
+// stressErrorPrefix marks a line of worker output that reports a failed
+// statement rather than a claimed job id.
+const stressErrorPrefix = "error: "
+
+func stressConfig(path string) (*config.Config, error) {
+	cfg, err := config.Load()
+	if err != nil {
+		return nil, err
+	}
+	cfg.DBConfig.SQLitePath = path
+	cfg.BackupConfig.IntegrityCheck = false
+	cfg.WorkerConfig.Printers = nil
+	return cfg, nil
+}
+
+// TestClaimStress is a larger version of TestClaimBarcodeJobConcurrently
+// that claims from several worker processes sharing one database, while
+// readers fetch jobs the way the API does. It uses a temporary SQLite file,
+// or with POS_PRINTER_DB_DRIVER=postgres, the configured PostgreSQL
+// database:
+//
+//	go test -tags stress -run TestClaimStress ./internal/db -args -jobs 2000 -procs 4
+func TestClaimStress(t *testing.T) {
+	if path, ok := os.LookupEnv(stressChildEnv); ok {
+		runStressWorkers(path)
+		return
+	}
+
+	cfg, err := stressConfig(filepath.Join(t.TempDir(), "stress.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg.DBConfig.Migrate = true
+	store := newTestStore(t, cfg)
+	ids := enqueueTestJobs(t, store, *stressJobs, *stressPrinters)
+
+	start := time.Now()
+	claims := make(map[int]int)
+	var errs int64
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for p := 0; p < *stressProcs; p++ {
+		cmd := exec.Command(os.Args[0], "-test.run=^TestClaimStress$",
+			"-workers", strconv.Itoa(*stressWorkers), "-for", stressFor.String())
+		cmd.Env = append(os.Environ(), stressChildEnv+"="+cfg.DBConfig.SQLitePath)
+		cmd.Stderr = os.Stderr
+		out, err := cmd.StdoutPipe()
+		if err != nil {
+			t.Fatalf("failed to start worker process: %v", err)
+		}
+		if err := cmd.Start(); err != nil {
+			t.Fatalf("failed to start worker process: %v", err)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			scanner := bufio.NewScanner(out)
+			for scanner.Scan() {
+				if msg, ok := strings.CutPrefix(scanner.Text(), stressErrorPrefix); ok {
+					atomic.AddInt64(&errs, 1)
+					t.Error(msg)
+					continue
+				}
+				// Anything else, such as the test binary's PASS, is not a claim.
+				id, err := strconv.Atoi(scanner.Text())
+				if err != nil {
+					continue
+				}
+				mu.Lock()
+				claims[id]++
+				mu.Unlock()
+			}
+			if err := cmd.Wait(); err != nil {
+				t.Errorf("worker process failed: %v", err)
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	latencies := make(chan []time.Duration, *stressReaders)
+	for r := 0; r < *stressReaders; r++ {
+		go func() {
+			var reads []time.Duration
+			for {
+				select {
+				case <-done:
+					latencies <- reads
+					return
+				default:
+				}
+				readStart := time.Now()
+				if _, err := store.FetchBarcodeJob(strconv.Itoa(ids[rand.Intn(len(ids))])); err != nil {
+					atomic.AddInt64(&errs, 1)
+					t.Errorf("FetchBarcodeJob: %v", err)
+				}
+				reads = append(reads, time.Since(readStart))
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+
+	var reads []time.Duration
+	for r := 0; r < *stressReaders; r++ {
+		reads = append(reads, <-latencies...)
+	}
+
+	duplicates, missing := 0, 0
+	for _, id := range ids {
+		switch n := claims[id]; {
+		case n == 0:
+			missing++
+		case n > 1:
+			duplicates++
+			t.Errorf("job %d was claimed %d times", id, n)
+		}
+	}
+	if missing > 0 {
+		t.Errorf("%d jobs were never claimed", missing)
+	}
+
+	t.Logf("%d jobs, %d processes x %d workers: %d claims in %s, %d duplicated, %d missed",
+		*stressJobs, *stressProcs, *stressWorkers, len(claims), time.Since(start).Round(time.Millisecond), duplicates, missing)
+	if len(reads) > 0 {
+		slices.Sort(reads)
+		t.Logf("%d reads by %d readers: p50 %s, p99 %s, max %s",
+			len(reads), *stressReaders, reads[(len(reads)-1)/2], reads[(len(reads)-1)*99/100], reads[len(reads)-1])
+	}
+	t.Logf("%d database errors", errs)
+}
+
+// runStressWorkers claims jobs until the queue stays empty, printing the
+// id of every claimed job on stdout. Failed statements are reported on
+// stdout too, since busy_timeout should have made every one of them
+// succeed.
+func runStressWorkers(path string) {
+	cfg, err := stressConfig(path)
+	if err != nil {
+		fmt.Printf(stressErrorPrefix+"invalid configuration: %v\n", err)
+		return
+	}
+	cfg.DBConfig.Migrate = false
+	cfg.WorkerConfig.InstanceID = fmt.Sprintf("claim-stress-%d", os.Getpid())
+	store, err := NewJobStore(cfg)
+	if err != nil {
+		fmt.Printf(stressErrorPrefix+"failed to open database: %v\n", err)
+		return
+	}
+	defer store.Close()
+
+	deadline := time.Now().Add(*stressFor)
+	var out sync.Mutex
+	var wg sync.WaitGroup
+	for w := 0; w < *stressWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			claimed, err := claimAll(store, cfg.WorkerConfig.JobStatus.StatusDone, deadline, nil)
+			out.Lock()
+			defer out.Unlock()
+			for _, id := range claimed {
+				fmt.Println(id)
+			}
+			if err != nil {
+				fmt.Println(stressErrorPrefix + err.Error())
+			}
+		}()
+	}
+	wg.Wait()
+}
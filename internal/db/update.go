@@ -1,51 +1,113 @@
 package db
 
 import (
-	"fmt"
-	"log"
+	"errors"
+	"log/slog"
 )
 
-func (s *SQLite) UpdateStaleBarcodeJobs() error {
-	dbMu.Lock()
-	defer dbMu.Unlock()
-	_, err := s.db.Exec(
-		`UPDATE barcode_jobs
-			 SET status = ?, updatedAt = CURRENT_TIMESTAMP
-			 WHERE status = ?
-			 AND updatedAt < DATETIME('now', ?)`,
-		s.cfg.WorkerConfig.JobStatus.StatusPending,
-		s.cfg.WorkerConfig.JobStatus.StatusInProgress,
-		fmt.Sprintf(
-			"-%d minutes",
-			int(s.cfg.WorkerConfig.StaleThreshold.Minutes()),
-		),
-	)
-	return err
-}
+// ErrJobNotUnknown is returned when resolving a job that is not waiting
+// for operator review.
+var ErrJobNotUnknown = errors.New("job is not in unknown state")
+
+// ErrJobNotPending is returned when cancelling a job that has started
+// printing or has finished.
+var ErrJobNotPending = errors.New("job is not pending")
+
+// ErrJobNotFailed is returned when retrying a job that has not failed.
+var ErrJobNotFailed = errors.New("job has not failed")
 
 func (s *SQLite) UpdateBarcodeJobStatus(jobID int, status string) error {
-	dbMu.Lock()
-	defer dbMu.Unlock()
 	_, err := s.db.Exec(
 		`UPDATE barcode_jobs SET status = ?, updatedAt = CURRENT_TIMESTAMP WHERE id = ?`,
 		status, jobID,
 	)
 	if err != nil {
-		log.Printf("Error updating barcode job status: %v", err)
+		slog.Error("Error updating barcode job status", "job_id", jobID, "error", err)
 		return err
 	}
 	return nil
 }
 
-func (s *SQLite) UpdateBarcodeJobAttempts(jobID int) error {
-	dbMu.Lock()
-	defer dbMu.Unlock()
-	_, err := s.db.Exec(
-		`UPDATE barcode_jobs SET status = ?, attempts = attempts + 1, updatedAt = CURRENT_TIMESTAMP WHERE id = ?`,
-		s.cfg.WorkerConfig.JobStatus.StatusInProgress, jobID,
+// ResolveBarcodeJob records an operator's decision on a job recovered as
+// unknown. Resolving it as pending prints it again with fresh attempts.
+func (s *SQLite) ResolveBarcodeJob(id string, status string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current string
+	if err := tx.QueryRow(`SELECT status FROM barcode_jobs WHERE id = ?`, id).Scan(&current); err != nil {
+		return err
+	}
+	if current != s.cfg.WorkerConfig.JobStatus.StatusUnknown {
+		return ErrJobNotUnknown
+	}
+
+	_, err = tx.Exec(
+		`UPDATE barcode_jobs
+			 SET status = ?, attempts = CASE WHEN ? = ? THEN 0 ELSE attempts END, updatedAt = CURRENT_TIMESTAMP
+			 WHERE id = ?`,
+		status, status, s.cfg.WorkerConfig.JobStatus.StatusPending, id,
 	)
 	if err != nil {
+		slog.Error("Error resolving barcode job", "job_id", id, "error", err)
 		return err
 	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	if status == s.cfg.WorkerConfig.JobStatus.StatusPending {
+		s.notifyBarcodeJobReady()
+	}
 	return nil
 }
+
+// CancelBarcodeJob withdraws a job that has not started printing.
+func (s *SQLite) CancelBarcodeJob(id string) error {
+	status := s.cfg.WorkerConfig.JobStatus
+	return s.moveBarcodeJob(id, status.StatusPending, status.StatusCancelled, ErrJobNotPending)
+}
+
+// RetryBarcodeJob queues a failed job again with fresh attempts. It
+// resumes after the labels it already printed.
+func (s *SQLite) RetryBarcodeJob(id string) error {
+	status := s.cfg.WorkerConfig.JobStatus
+	if err := s.moveBarcodeJob(id, status.StatusFailed, status.StatusPending, ErrJobNotFailed); err != nil {
+		return err
+	}
+	s.notifyBarcodeJobReady()
+	return nil
+}
+
+// moveBarcodeJob changes a job from one status to another, resetting its
+// attempts if it becomes pending. It returns errWrongStatus if the job is
+// in another status.
+func (s *SQLite) moveBarcodeJob(id string, from, to string, errWrongStatus error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var current string
+	if err := tx.QueryRow(`SELECT status FROM barcode_jobs WHERE id = ?`, id).Scan(&current); err != nil {
+		return err
+	}
+	if current != from {
+		return errWrongStatus
+	}
+
+	_, err = tx.Exec(
+		`UPDATE barcode_jobs
+			 SET status = ?, attempts = CASE WHEN ? = ? THEN 0 ELSE attempts END, updatedAt = CURRENT_TIMESTAMP
+			 WHERE id = ? AND status = ?`,
+		to, to, s.cfg.WorkerConfig.JobStatus.StatusPending, id, from,
+	)
+	if err != nil {
+		slog.Error("Error updating barcode job status", "job_id", id, "error", err)
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,67 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"pos-printer/internal/config"
+	"strconv"
+	"testing"
+)
+
+func TestCancelAndRetryBarcodeJob(t *testing.T) {
+	forEachDriver(t, func(t *testing.T, cfg *config.Config) {
+		cfg.WorkerConfig.MaxJobAttempts = 1
+		status := cfg.WorkerConfig.JobStatus
+		store := newTestStore(t, cfg)
+		ids := enqueueTestJobs(t, store, 2, 2)
+		failed, pending := strconv.Itoa(ids[0]), strconv.Itoa(ids[1])
+
+		// The first job fails its only attempt.
+		job, err := store.ClaimBarcodeJob()
+		if err != nil || job == nil || job.ID != ids[0] {
+			t.Fatalf("ClaimBarcodeJob = %+v, %v, want job %d", job, err, ids[0])
+		}
+		if err := store.CompleteBarcodeJob(job.ID, status.StatusFailed); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.CancelBarcodeJob(failed); !errors.Is(err, ErrJobNotPending) {
+			t.Errorf("cancelling a failed job: err = %v, want ErrJobNotPending", err)
+		}
+		if err := store.RetryBarcodeJob(pending); !errors.Is(err, ErrJobNotFailed) {
+			t.Errorf("retrying a pending job: err = %v, want ErrJobNotFailed", err)
+		}
+		for _, id := range []string{"999", "x"} {
+			if err := store.CancelBarcodeJob(id); !errors.Is(err, sql.ErrNoRows) {
+				t.Errorf("cancelling missing job %q: err = %v, want sql.ErrNoRows", id, err)
+			}
+		}
+
+		if err := store.CancelBarcodeJob(pending); err != nil {
+			t.Fatalf("CancelBarcodeJob: %v", err)
+		}
+		if err := store.RetryBarcodeJob(failed); err != nil {
+			t.Fatalf("RetryBarcodeJob: %v", err)
+		}
+
+		for id, want := range map[string]string{pending: status.StatusCancelled, failed: status.StatusPending} {
+			job, err := store.FetchBarcodeJob(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if job.Status != want {
+				t.Errorf("job %s status = %q, want %q", id, job.Status, want)
+			}
+			if id == failed && job.Attempts != 0 {
+				t.Errorf("retried job has %d attempts, want 0", job.Attempts)
+			}
+		}
+		// The retried job is claimed again, the cancelled one is not.
+		if job, err := store.ClaimBarcodeJob(); err != nil || job == nil || job.ID != ids[0] {
+			t.Errorf("ClaimBarcodeJob = %+v, %v, want job %d", job, err, ids[0])
+		}
+		if job, err := store.ClaimBarcodeJob(); err != nil || job != nil {
+			t.Errorf("ClaimBarcodeJob = %+v, %v, want no job", job, err)
+		}
+	})
+}
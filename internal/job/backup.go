@@ -0,0 +1,41 @@
+package job
+
+import (
+	"log/slog"
+	"pos-printer/internal/config"
+	"time"
+)
+
+// RunBackups snapshots the SQLite database on BackupConfig.Schedule.
+func (p *Processor) RunBackups() {
+	expr := p.cfg.BackupConfig.Schedule
+	if expr == "" || p.cfg.DBConfig.Driver != config.DriverSQLite {
+		return
+	}
+
+	for {
+		next, err := NextRun(expr, time.Now())
+		if err != nil {
+			slog.Warn("Scheduled backups disabled", "error", err)
+			return
+		}
+
+		select {
+		case <-time.After(time.Until(next)):
+			p.backupDatabase()
+		case <-p.stopChan:
+			slog.Debug("Backups stopping")
+			return
+		}
+	}
+}
+
+func (p *Processor) backupDatabase() {
+	start := time.Now()
+	backup, err := p.store.CreateBackup()
+	if err != nil {
+		slog.Error("Scheduled backup failed", "error", err)
+		return
+	}
+	slog.Info("Backed up the database", "backup", backup.Name, "duration", time.Since(start).Round(time.Millisecond))
+}
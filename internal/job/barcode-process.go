@@ -1,58 +1,241 @@
 package job
 
 import (
-	"log"
+	"errors"
+	"fmt"
+	"log/slog"
+	"pos-printer/internal/config"
+	"pos-printer/internal/db"
+	"pos-printer/internal/label"
 	"pos-printer/internal/model"
+	"strconv"
 	"time"
 )
 
-func (p *Processor) RequeueStaleBarcodeJobs() {
-	ticker := time.NewTicker(p.cfg.WorkerConfig.StaleInterval)
+// RecoverOrphanedBarcodeJobs recovers the jobs a previous run of this
+// instance was printing when it crashed.
+func (p *Processor) RecoverOrphanedBarcodeJobs() {
+	ids, err := p.store.RecoverOrphanedBarcodeJobs()
+	if err != nil {
+		slog.Error("Error recovering orphaned jobs", "error", err)
+		return
+	}
+	p.logRecovered("orphaned", ids)
+}
+
+// ReapExpiredBarcodeJobs periodically recovers jobs whose worker stopped
+// renewing its lease, in this or any other process.
+func (p *Processor) ReapExpiredBarcodeJobs() {
+	ticker := time.NewTicker(p.cfg.WorkerConfig.ReapInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			if err := p.db.UpdateStaleBarcodeJobs(); err != nil {
-				log.Printf("Error requeuing stale jobs: %v", err)
+			ids, err := p.store.RecoverExpiredBarcodeJobs()
+			if err != nil {
+				slog.Error("Error recovering expired jobs", "error", err)
+				continue
 			}
+			p.logRecovered("expired", ids)
 		case <-p.stopChan:
-			log.Println("Requeue worker stopping")
+			slog.Debug("Lease reaper stopping")
 			return
 		}
 	}
 }
 
+func (p *Processor) logRecovered(reason string, ids []int) {
+	if len(ids) == 0 {
+		return
+	}
+	policy := p.cfg.WorkerConfig.RecoveryPolicy
+	for _, id := range ids {
+		slog.Warn("Recovered job", "job_id", id, "reason", reason, "policy", policy)
+		p.audit(&model.AuditEntry{
+			Source:     model.AuditSourceWorker,
+			Action:     model.AuditJobRecover,
+			TargetType: "job",
+			TargetID:   strconv.Itoa(id),
+			After:      model.AuditSnapshot(map[string]string{"reason": reason, "policy": policy}),
+		})
+	}
+	if policy != config.RecoveryUnknown {
+		p.wakeWorker()
+	}
+}
+
+// heartbeat renews the lease on a job until the returned function is
+// called.
+func (p *Processor) heartbeat(logger *slog.Logger, jobID int) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(p.cfg.WorkerConfig.HeartbeatInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if err := p.store.RenewBarcodeJobLease(jobID); err != nil {
+					logger.Warn("Lease renewal failed", "error", err)
+					if errors.Is(err, db.ErrLeaseLost) {
+						return
+					}
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
 func (p *Processor) processBarcodeJob(workerID int, job *model.BarcodeJob) {
-	log.Printf("Barcode Worker %d processing job %d (attempt %d)", workerID, job.ID, job.Attempts)
+	// Every line about the job names the request that created it.
+	logger := slog.With("worker", workerID, "job_id", job.ID, "request_id", job.RequestID)
+	logger.Info("Processing job", "printer", config.PrinterKey(job.VID, job.PID), "attempt", job.Attempts)
 
-	err := p.posPrinter.PrintBarcode(
-		job.VID, job.PID,
-		job.SizeX, job.SizeY,
-		job.Direction, job.TopText,
-		job.BarcodeData, job.PrintCount,
-		job.LabelGapLength, job.LabelGapOffset,
-	)
+	stopHeartbeat := p.heartbeat(logger, job.ID)
+	err := p.printBarcodeChunks(logger, job)
+	stopHeartbeat()
+
+	if errors.Is(err, errYielded) {
+		if err := p.store.YieldBarcodeJob(job.ID); err != nil {
+			logger.Warn("Error giving way to a more urgent job", "error", err)
+			return
+		}
+		logger.Info("Gave way to a more urgent job", "printed", job.PrintedCount, "labels", job.PrintCount)
+		return
+	}
 
 	var newStatus string
 	if err != nil {
-		log.Printf("Barcode Worker %d job %d failed: %v", workerID, job.ID, err)
+		logger.Warn("Job attempt failed", "attempt", job.Attempts, "error", err)
 		if job.Attempts >= p.cfg.WorkerConfig.MaxJobAttempts {
 			newStatus = p.cfg.WorkerConfig.JobStatus.StatusFailed
 		} else {
 			newStatus = p.cfg.WorkerConfig.JobStatus.StatusPending
 		}
 	} else {
-		log.Printf("Barcode Worker %d job %d done", workerID, job.ID)
 		newStatus = p.cfg.WorkerConfig.JobStatus.StatusDone
 	}
 
-	uerr := p.db.UpdateBarcodeJobStatus(job.ID, newStatus)
+	uerr := p.store.CompleteBarcodeJob(job.ID, newStatus)
 
+	if errors.Is(uerr, db.ErrLeaseLost) {
+		logger.Warn("Lease lost, result discarded", "status", newStatus)
+		return
+	}
 	if uerr != nil {
-		log.Printf("Barcode Worker %d update job %d error: %v", workerID, job.ID, uerr)
+		logger.Error("Error updating job", "status", newStatus, "error", uerr)
 		return
 	}
 
-	log.Printf("Barcode Worker %d job %d done", workerID, job.ID)
+	// Retries are not audited, only how the job ended.
+	if newStatus != p.cfg.WorkerConfig.JobStatus.StatusPending {
+		action := model.AuditJobPrint
+		if newStatus == p.cfg.WorkerConfig.JobStatus.StatusFailed {
+			action = model.AuditJobFail
+		}
+		p.audit(&model.AuditEntry{
+			Source:     model.AuditSourceWorker,
+			Action:     action,
+			APIKeyID:   job.APIKeyID,
+			TargetType: "job",
+			TargetID:   strconv.Itoa(job.ID),
+			PrinterKey: config.PrinterKey(job.VID, job.PID),
+			After:      model.AuditSnapshot(map[string]any{"status": newStatus, "attempts": job.Attempts}),
+		})
+	}
+
+	logger.Info("Job finished", "status", newStatus)
+}
+
+// errYielded is returned by printBarcodeChunks when a more urgent job for
+// the printer is waiting and the job has to give way.
+var errYielded = errors.New("gave way to a more urgent job")
+
+// printBarcodeChunks prints the labels of a job that are still missing in
+// chunks of ChunkSize, recording progress after each chunk so that a retry
+// resumes after the last chunk sent instead of starting over. Between
+// chunks it gives way to a job of higher priority for the same printer.
+func (p *Processor) printBarcodeChunks(logger *slog.Logger, job *model.BarcodeJob) error {
+	lang, err := label.ParseLanguage(p.cfg.PrinterConfig.LabelLanguageFor(job.VID, job.PID))
+	if err != nil {
+		return err
+	}
+
+	if job.PrintedCount > 0 {
+		logger.Info("Resuming job", "label", job.PrintedCount+1, "labels", job.PrintCount)
+	}
+
+	for first := true; job.PrintedCount < job.PrintCount; first = false {
+		if !first && p.urgentJobWaiting(logger, job) {
+			return errYielded
+		}
+		count := job.PrintCount - job.PrintedCount
+		if size := p.cfg.WorkerConfig.ChunkSize; size > 0 && count > size {
+			count = size
+		}
+
+		err := p.printer.PrintBarcode(
+			job.VID, job.PID, lang,
+			barcodeLabels(job, job.PrintedCount, count),
+			first,
+		)
+		if err != nil {
+			return fmt.Errorf("after %d of %d labels: %w", job.PrintedCount, job.PrintCount, err)
+		}
+
+		job.PrintedCount += count
+		if err := p.store.UpdateBarcodeJobProgress(job.ID, job.PrintedCount); err != nil {
+			return err
+		}
+		logger.Debug("Sent labels", "printed", job.PrintedCount, "labels", job.PrintCount)
+	}
+	return nil
+}
+
+// urgentJobWaiting reports whether a job of higher priority is waiting for
+// the printer. If that cannot be told, the job keeps the printer.
+func (p *Processor) urgentJobWaiting(logger *slog.Logger, job *model.BarcodeJob) bool {
+	waiting, err := p.store.UrgentBarcodeJobWaiting(config.PrinterKey(job.VID, job.PID), job.Priority)
+	if err != nil {
+		logger.Warn("Error checking for more urgent jobs", "error", err)
+		return false
+	}
+	return waiting
+}
+
+// barcodeLabels returns labels first to first+count-1 of a job: one label
+// printed count times, or with a serial number, count numbered labels.
+func barcodeLabels(job *model.BarcodeJob, first, count int) []*label.Label {
+	if job.Serial == nil {
+		return []*label.Label{label.NewBarcodeLabel(
+			job.SizeX, job.SizeY,
+			job.Direction, job.TopText,
+			job.BarcodeData, count,
+			job.LabelGapLength, job.LabelGapOffset,
+			label.DefaultDotsPerMM,
+		)}
+	}
+
+	labels := make([]*label.Label, 0, count)
+	for i := first; i < first+count; i++ {
+		labels = append(labels, label.NewBarcodeLabel(
+			job.SizeX, job.SizeY,
+			job.Direction, job.Serial.Expand(job.TopText, i),
+			job.Serial.Expand(job.BarcodeData, i), 1,
+			job.LabelGapLength, job.LabelGapOffset,
+			label.DefaultDotsPerMM,
+		))
+	}
+	return labels
 }
@@ -0,0 +1,232 @@
+package job
+
+import (
+	"errors"
+	"pos-printer/internal/db"
+	"pos-printer/internal/model"
+	"reflect"
+	"testing"
+)
+
+func TestProcessBarcodeJob(t *testing.T) {
+	errPaper := errors.New("paper out")
+
+	tests := []struct {
+		name         string
+		job          func() *model.BarcodeJob
+		failAt       int
+		completeErr  error
+		urgent       int   // checks between chunks that find a more urgent job
+		wantCounts   []int // labels per print call
+		wantProgress []int
+		wantStatus   string // "" if the job is not completed
+		wantYielded  bool
+		wantAudit    string // "" for no audit entry
+	}{
+		{
+			name:         "prints in chunks",
+			job:          func() *model.BarcodeJob { j := testJob(1, 5); j.Attempts = 1; return j },
+			wantCounts:   []int{2, 2, 1},
+			wantProgress: []int{2, 4, 5},
+			wantStatus:   "done",
+			wantAudit:    model.AuditJobPrint,
+		},
+		{
+			name: "resumes after the labels already printed",
+			job: func() *model.BarcodeJob {
+				j := testJob(1, 5)
+				j.Attempts, j.PrintedCount = 2, 3
+				return j
+			},
+			wantCounts:   []int{2},
+			wantProgress: []int{5},
+			wantStatus:   "done",
+			wantAudit:    model.AuditJobPrint,
+		},
+		{
+			name:         "retries a failed attempt",
+			job:          func() *model.BarcodeJob { j := testJob(1, 5); j.Attempts = 1; return j },
+			failAt:       2,
+			wantCounts:   []int{2, 2},
+			wantProgress: []int{2},
+			wantStatus:   "pending",
+		},
+		{
+			name:       "fails on the last attempt",
+			job:        func() *model.BarcodeJob { j := testJob(1, 1); j.Attempts = 3; return j },
+			failAt:     1,
+			wantCounts: []int{1},
+			wantStatus: "failed",
+			wantAudit:  model.AuditJobFail,
+		},
+		{
+			name:         "gives way to a more urgent job between chunks",
+			job:          func() *model.BarcodeJob { j := testJob(1, 5); j.Attempts = 1; return j },
+			urgent:       1,
+			wantCounts:   []int{2},
+			wantProgress: []int{2},
+			wantYielded:  true,
+		},
+		{
+			name:         "discards the result of a lost lease",
+			job:          func() *model.BarcodeJob { j := testJob(1, 1); j.Attempts = 1; return j },
+			completeErr:  db.ErrLeaseLost,
+			wantCounts:   []int{1},
+			wantProgress: []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore()
+			store.completeErr = tt.completeErr
+			store.urgent = tt.urgent
+			printer := &fakePrinter{failAt: tt.failAt, err: errPaper}
+			p := NewProcessor(printer, store, testConfig())
+
+			job := tt.job()
+			p.processBarcodeJob(0, job)
+
+			var counts []int
+			for i, call := range printer.calls {
+				counts = append(counts, call.count)
+				if call.calibrate != (i == 0) {
+					t.Errorf("call %d: calibrate = %v, want only the first call to calibrate", i, call.calibrate)
+				}
+			}
+			if !reflect.DeepEqual(counts, tt.wantCounts) {
+				t.Errorf("labels per call = %v, want %v", counts, tt.wantCounts)
+			}
+			if got := store.progress[job.ID]; !reflect.DeepEqual(got, tt.wantProgress) {
+				t.Errorf("progress = %v, want %v", got, tt.wantProgress)
+			}
+			if got := store.completed[job.ID]; got != tt.wantStatus {
+				t.Errorf("status = %q, want %q", got, tt.wantStatus)
+			}
+			if yielded := len(store.yielded) > 0; yielded != tt.wantYielded {
+				t.Errorf("yielded = %v, want %v", yielded, tt.wantYielded)
+			}
+
+			var actions []string
+			for _, e := range store.audit {
+				actions = append(actions, e.Action)
+			}
+			var wantActions []string
+			if tt.wantAudit != "" {
+				wantActions = []string{tt.wantAudit}
+			}
+			if !reflect.DeepEqual(actions, wantActions) {
+				t.Errorf("audit = %v, want %v", actions, wantActions)
+			}
+		})
+	}
+}
+
+func TestProcessBarcodeJobNumbersSerialLabels(t *testing.T) {
+	store := newFakeStore()
+	printer := &fakePrinter{}
+	p := NewProcessor(printer, store, testConfig())
+
+	job := testJob(1, 3)
+	job.Attempts = 1
+	job.TopText = "No. {serial}"
+	job.Serial = &model.Serial{Start: 7, Step: 1, Width: 3}
+	p.processBarcodeJob(0, job)
+
+	var texts []string
+	for _, call := range printer.calls {
+		texts = append(texts, call.topTexts...)
+	}
+	want := []string{"No. 007", "No. 008", "No. 009"}
+	if !reflect.DeepEqual(texts, want) {
+		t.Errorf("top texts = %v, want %v", texts, want)
+	}
+	if store.completed[1] != "done" {
+		t.Errorf("status = %q, want done", store.completed[1])
+	}
+}
+
+func TestProcessBarcodeJobResumesFromRecordedProgress(t *testing.T) {
+	tests := []struct {
+		name       string
+		serial     *model.Serial
+		printCount int
+		failAt     int
+		wantFirst  []string // top texts sent by the failed attempt
+		wantRetry  []string // top texts sent by the retry, from the failed chunk on
+	}{
+		{
+			name: "copies", printCount: 5, failAt: 2,
+			wantFirst: []string{"No. {serial}", "No. {serial}", "No. {serial}", "No. {serial}"},
+			wantRetry: []string{"No. {serial}", "No. {serial}", "No. {serial}"},
+		},
+		{
+			name: "serial numbers", serial: &model.Serial{Start: 1, Step: 1, Width: 2}, printCount: 5, failAt: 2,
+			wantFirst: []string{"No. 01", "No. 02", "No. 03", "No. 04"},
+			wantRetry: []string{"No. 03", "No. 04", "No. 05"},
+		},
+		{
+			name: "serial numbers with a step", serial: &model.Serial{Start: 100, Step: 10}, printCount: 5, failAt: 3,
+			wantFirst: []string{"No. 100", "No. 110", "No. 120", "No. 130", "No. 140"},
+			wantRetry: []string{"No. 140"},
+		},
+		{
+			name: "failed first chunk", serial: &model.Serial{Start: 1, Step: 1}, printCount: 3, failAt: 1,
+			wantFirst: []string{"No. 1", "No. 2"},
+			wantRetry: []string{"No. 1", "No. 2", "No. 3"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore()
+			newJob := func(attempts int) *model.BarcodeJob {
+				j := testJob(1, tt.printCount)
+				j.TopText = "No. {serial}"
+				j.Serial = tt.serial
+				j.Attempts = attempts
+				return j
+			}
+
+			printer := &fakePrinter{failAt: tt.failAt, err: errors.New("paper out")}
+			NewProcessor(printer, store, testConfig()).processBarcodeJob(0, newJob(1))
+			if store.completed[1] != "pending" {
+				t.Fatalf("status after the failure = %q, want pending", store.completed[1])
+			}
+			if got := topTexts(printer); !reflect.DeepEqual(got, tt.wantFirst) {
+				t.Errorf("failed attempt sent %v, want %v", got, tt.wantFirst)
+			}
+
+			// The retry is claimed with the progress recorded so far.
+			job := newJob(2)
+			if progress := store.progress[1]; len(progress) > 0 {
+				job.PrintedCount = progress[len(progress)-1]
+			}
+			printer = &fakePrinter{}
+			NewProcessor(printer, store, testConfig()).processBarcodeJob(0, job)
+			if store.completed[1] != "done" {
+				t.Errorf("status after the retry = %q, want done", store.completed[1])
+			}
+			if got := topTexts(printer); !reflect.DeepEqual(got, tt.wantRetry) {
+				t.Errorf("retry sent %v, want %v", got, tt.wantRetry)
+			}
+			if job.PrintedCount != tt.printCount {
+				t.Errorf("printed %d labels in the end, want %d", job.PrintedCount, tt.printCount)
+			}
+		})
+	}
+}
+
+// topTexts returns the top text of every label sent to p, a label printed
+// several times counting once per copy.
+func topTexts(p *fakePrinter) []string {
+	var texts []string
+	for _, call := range p.calls {
+		for _, text := range call.topTexts {
+			for range call.count / len(call.topTexts) {
+				texts = append(texts, text)
+			}
+		}
+	}
+	return texts
+}
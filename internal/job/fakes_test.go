@@ -0,0 +1,222 @@
+package job
+
+import (
+	"database/sql"
+	"pos-printer/internal/config"
+	"pos-printer/internal/label"
+	"pos-printer/internal/model"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// fakeStore is an in-memory Store. Jobs in queue are claimed in order.
+type fakeStore struct {
+	mu          sync.Mutex
+	queue       []*model.BarcodeJob
+	claimErrs   []error // returned by the next claims, before any job
+	completeErr error
+	urgent      int // UrgentBarcodeJobWaiting reports a waiting job this many times
+	yielded     []int
+	completed   map[int]string
+	progress    map[int][]int
+	audit       []*model.AuditEntry
+	ready       chan struct{}
+
+	schedules []*model.BarcodeSchedule // all due
+	fired     []model.PrintBarcodeRequest
+	skipped   map[int]bool // whether each skipped schedule was disabled
+	keys      map[int64]*model.APIKey
+	queued    int // what QueuedBarcodeJobs reports for every printer
+	keyLabels int // what KeyLabelsSince reports for every key
+}
+
+func newFakeStore(jobs ...*model.BarcodeJob) *fakeStore {
+	return &fakeStore{
+		queue:     jobs,
+		completed: map[int]string{},
+		progress:  map[int][]int{},
+		skipped:   map[int]bool{},
+		keys:      map[int64]*model.APIKey{},
+		ready:     make(chan struct{}, 1),
+	}
+}
+
+// enqueue adds a job and announces it, as EnqueueBarcodeJob does.
+func (s *fakeStore) enqueue(job *model.BarcodeJob) {
+	s.mu.Lock()
+	s.queue = append(s.queue, job)
+	s.mu.Unlock()
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+func (s *fakeStore) completedCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.completed)
+}
+
+func (s *fakeStore) BarcodeJobReady() <-chan struct{} { return s.ready }
+
+func (s *fakeStore) ClaimBarcodeJob() (*model.BarcodeJob, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.claimErrs) > 0 {
+		err := s.claimErrs[0]
+		s.claimErrs = s.claimErrs[1:]
+		return nil, err
+	}
+	if len(s.queue) == 0 {
+		return nil, nil
+	}
+	job := s.queue[0]
+	s.queue = s.queue[1:]
+	job.Attempts++
+	return job, nil
+}
+
+func (s *fakeStore) RenewBarcodeJobLease(jobID int) error { return nil }
+
+func (s *fakeStore) UpdateBarcodeJobProgress(jobID int, printedCount int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.progress[jobID] = append(s.progress[jobID], printedCount)
+	return nil
+}
+
+func (s *fakeStore) CompleteBarcodeJob(jobID int, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.completeErr != nil {
+		return s.completeErr
+	}
+	s.completed[jobID] = status
+	return nil
+}
+
+func (s *fakeStore) UrgentBarcodeJobWaiting(printerKey string, priority int) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.urgent == 0 {
+		return false, nil
+	}
+	s.urgent--
+	return true, nil
+}
+
+func (s *fakeStore) YieldBarcodeJob(jobID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.yielded = append(s.yielded, jobID)
+	return nil
+}
+
+func (s *fakeStore) RecoverExpiredBarcodeJobs() ([]int, error)  { return nil, nil }
+func (s *fakeStore) RecoverOrphanedBarcodeJobs() ([]int, error) { return nil, nil }
+func (s *fakeStore) NextBarcodeJobDue() (*time.Time, error)     { return nil, nil }
+
+func (s *fakeStore) DueBarcodeSchedules(now time.Time) ([]*model.BarcodeSchedule, error) {
+	return s.schedules, nil
+}
+
+func (s *fakeStore) NextBarcodeScheduleRun() (*time.Time, error) { return nil, nil }
+
+func (s *fakeStore) FireBarcodeSchedule(sched *model.BarcodeSchedule, job model.PrintBarcodeRequest, nextRunAt time.Time) (int64, bool, error) {
+	job.APIKeyID = sched.APIKeyID
+	s.fired = append(s.fired, job)
+	return int64(len(s.fired)), true, nil
+}
+
+func (s *fakeStore) SkipBarcodeSchedule(sched *model.BarcodeSchedule, nextRunAt time.Time, disable bool) (bool, error) {
+	s.skipped[sched.ID] = disable
+	return true, nil
+}
+
+func (s *fakeStore) FetchAPIKey(id string) (*model.APIKey, error) {
+	for _, key := range s.keys {
+		if strconv.FormatInt(key.ID, 10) == id {
+			return key, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *fakeStore) KeyLabelsSince(apiKeyID int64, since time.Time) (int, error) {
+	return s.keyLabels, nil
+}
+
+func (s *fakeStore) PrinterLabelsSince(printerKey string, since time.Time) (int, error) {
+	return 0, nil
+}
+
+func (s *fakeStore) QueuedBarcodeJobs(printerKey string) (int, error) { return s.queued, nil }
+
+func (s *fakeStore) BarcodeJobsToPurge(status string, maxAge time.Duration, keep int, limit int) ([]*model.BarcodeJob, error) {
+	return nil, nil
+}
+
+func (s *fakeStore) DeleteBarcodeJobs(status string, ids []int) (int64, error) { return 0, nil }
+func (s *fakeStore) Optimize() error                                           { return nil }
+func (s *fakeStore) CreateBackup() (*model.Backup, error)                      { return nil, nil }
+
+func (s *fakeStore) AppendAuditEntry(e *model.AuditEntry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.audit = append(s.audit, e)
+	return nil
+}
+
+// printCall is one PrintBarcode call, with the top text of every label
+// and the number of labels it prints.
+type printCall struct {
+	topTexts  []string
+	count     int
+	calibrate bool
+}
+
+// fakePrinter records print calls; the failAt-th call (from 1) fails.
+type fakePrinter struct {
+	mu     sync.Mutex
+	calls  []printCall
+	failAt int
+	err    error
+}
+
+func (p *fakePrinter) PrintBarcode(vidHexStr, pidHexStr string, lang label.Language, labels []*label.Label, calibrate bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	call := printCall{calibrate: calibrate}
+	for _, l := range labels {
+		call.topTexts = append(call.topTexts, l.Elements[0].(label.Text).Content)
+		call.count += l.Copies
+	}
+	p.calls = append(p.calls, call)
+	if len(p.calls) == p.failAt {
+		return p.err
+	}
+	return nil
+}
+
+func testConfig() *config.Config {
+	cfg, err := config.Load()
+	if err != nil {
+		panic(err)
+	}
+	cfg.WorkerConfig.MaxJobAttempts = 3
+	cfg.WorkerConfig.ChunkSize = 2
+	cfg.PrinterConfig.LabelLanguage = "tspl"
+	cfg.PrinterConfig.LabelLanguages = nil
+	return cfg
+}
+
+func testJob(id, printCount int) *model.BarcodeJob {
+	return &model.BarcodeJob{
+		ID: id, VID: "0x0fe6", PID: "0x8800",
+		SizeX: 40, SizeY: 30, TopText: "100tk", BarcodeData: "AX2B2CL21LL2",
+		PrintCount: printCount, LabelGapLength: 2,
+		Status: "in_progress", RequestID: "req-1",
+	}
+}
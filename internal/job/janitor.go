@@ -0,0 +1,172 @@
+package job
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"pos-printer/internal/model"
+	"time"
+)
+
+// RunJanitor purges finished jobs past the retention policy and runs
+// database maintenance on its schedule.
+func (p *Processor) RunJanitor() {
+	ticker := time.NewTicker(p.cfg.RetentionConfig.Interval)
+	defer ticker.Stop()
+
+	var nextMaintenance time.Time
+	if expr := p.cfg.RetentionConfig.Maintenance; expr != "" {
+		next, err := NextRun(expr, time.Now())
+		if err != nil {
+			slog.Warn("Database maintenance disabled", "error", err)
+		}
+		nextMaintenance = next
+	}
+
+	p.purgeBarcodeJobs()
+	for {
+		// A nil channel never fires, leaving maintenance disabled.
+		var maintenance <-chan time.Time
+		if !nextMaintenance.IsZero() {
+			maintenance = time.After(time.Until(nextMaintenance))
+		}
+
+		select {
+		case <-ticker.C:
+			p.purgeBarcodeJobs()
+		case <-maintenance:
+			p.optimizeDatabase()
+			nextMaintenance, _ = NextRun(p.cfg.RetentionConfig.Maintenance, time.Now())
+		case <-p.stopChan:
+			slog.Debug("Janitor stopping")
+			return
+		}
+	}
+}
+
+func (p *Processor) optimizeDatabase() {
+	start := time.Now()
+	if err := p.store.Optimize(); err != nil {
+		slog.Error("Database maintenance failed", "error", err)
+		return
+	}
+	slog.Info("Database maintenance done", "duration", time.Since(start).Round(time.Millisecond))
+}
+
+func (p *Processor) purgeBarcodeJobs() {
+	retention := p.cfg.RetentionConfig
+	status := p.cfg.WorkerConfig.JobStatus
+
+	var arc *archive
+	defer func() {
+		if arc != nil {
+			if err := arc.Close(); err != nil {
+				slog.Error("Error closing job archive", "path", arc.path, "error", err)
+			}
+		}
+	}()
+
+	for _, st := range []string{status.StatusDone, status.StatusFailed, status.StatusUnknown, status.StatusCancelled} {
+		maxAge, keep := retention.MaxAge[st], retention.MaxCount[st]
+		if maxAge == 0 && keep == 0 {
+			continue
+		}
+
+		var purged int64
+		for {
+			select {
+			case <-p.stopChan:
+				return
+			default:
+			}
+
+			jobs, err := p.store.BarcodeJobsToPurge(st, maxAge, keep, retention.BatchSize)
+			if err != nil {
+				slog.Error("Error selecting jobs to purge", "status", st, "error", err)
+				break
+			}
+			if len(jobs) == 0 {
+				break
+			}
+
+			if retention.ArchiveDir != "" {
+				if arc == nil {
+					if arc, err = openArchive(retention.ArchiveDir); err != nil {
+						slog.Error("Error opening job archive, not purging", "error", err)
+						return
+					}
+				}
+				// Purged rows must be on disk before they are deleted.
+				if err := arc.Write(jobs); err != nil {
+					slog.Error("Error archiving jobs, not purging", "error", err)
+					return
+				}
+			}
+
+			ids := make([]int, len(jobs))
+			for i, job := range jobs {
+				ids[i] = job.ID
+			}
+			n, err := p.store.DeleteBarcodeJobs(st, ids)
+			if err != nil {
+				slog.Error("Error purging jobs", "status", st, "error", err)
+				break
+			}
+			purged += n
+			if len(jobs) < retention.BatchSize {
+				break
+			}
+		}
+		if purged > 0 {
+			slog.Info("Purged barcode jobs", "status", st, "count", purged)
+		}
+	}
+}
+
+// archive appends purged jobs to a gzip compressed JSON Lines file.
+type archive struct {
+	path string
+	file *os.File
+	gz   *gzip.Writer
+	enc  *json.Encoder
+}
+
+func openArchive(dir string) (*archive, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create archive directory: %w", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("barcode-jobs-%s.jsonl.gz", time.Now().Format("20060102-150405")))
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(file)
+	return &archive{path: path, file: file, gz: gz, enc: json.NewEncoder(gz)}, nil
+}
+
+func (a *archive) Write(jobs []*model.BarcodeJob) error {
+	for _, job := range jobs {
+		if err := a.enc.Encode(job); err != nil {
+			return err
+		}
+	}
+	if err := a.gz.Flush(); err != nil {
+		return err
+	}
+	return a.file.Sync()
+}
+
+func (a *archive) Close() error {
+	if err := a.gz.Close(); err != nil {
+		a.file.Close()
+		return err
+	}
+	if err := a.file.Sync(); err != nil {
+		a.file.Close()
+		return err
+	}
+	return a.file.Close()
+}
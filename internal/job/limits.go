@@ -0,0 +1,78 @@
+package job
+
+import (
+	"fmt"
+	"pos-printer/internal/config"
+	"pos-printer/internal/model"
+	"time"
+)
+
+// queueFullRetryAfter is what clients are told to wait when a printer's
+// queue is full; how long it takes to drain depends on the jobs in it.
+const queueFullRetryAfter = 30 * time.Second
+
+// LimitStore is the part of the job database the print limits read.
+type LimitStore interface {
+	KeyLabelsSince(apiKeyID int64, since time.Time) (int, error)
+	PrinterLabelsSince(printerKey string, since time.Time) (int, error)
+	QueuedBarcodeJobs(printerKey string) (int, error)
+}
+
+// LimitError is returned by CheckPrintLimits when a job must wait.
+type LimitError struct {
+	Message    string
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string { return e.Message }
+
+// CheckPrintLimits returns a *LimitError if enqueuing req for key, nil for
+// none, would overfill the printer's queue or exceed a daily label quota.
+// The API checks requests with it and the scheduler the jobs it fires.
+// The checks and the insert are not atomic, so concurrent requests can
+// overshoot a quota by what they enqueue at once.
+func CheckPrintLimits(store LimitStore, limits config.LimitsConfig, key *model.APIKey, req *model.PrintBarcodeRequest) error {
+	printerKey := config.PrinterKey(req.VID, req.PID)
+
+	if limits.MaxQueuedJobs > 0 {
+		queued, err := store.QueuedBarcodeJobs(printerKey)
+		if err != nil {
+			return err
+		}
+		if queued >= limits.MaxQueuedJobs {
+			return &LimitError{fmt.Sprintf("Printer queue is full with %d jobs", queued), queueFullRetryAfter}
+		}
+	}
+
+	now := time.Now()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	untilTomorrow := midnight.AddDate(0, 0, 1).Sub(now)
+
+	if quota := limits.PrinterDailyLabels[printerKey]; quota > 0 {
+		used, err := store.PrinterLabelsSince(printerKey, midnight)
+		if err != nil {
+			return err
+		}
+		if used+req.PrintCount > quota {
+			return &LimitError{fmt.Sprintf("Daily label quota of this printer exceeded, %d of %d labels used", used, quota), untilTomorrow}
+		}
+	}
+
+	if key == nil {
+		return nil
+	}
+	quota := limits.KeyDailyLabels
+	if key.DailyLabelQuota != nil {
+		quota = *key.DailyLabelQuota
+	}
+	if quota > 0 {
+		used, err := store.KeyLabelsSince(key.ID, midnight)
+		if err != nil {
+			return err
+		}
+		if used+req.PrintCount > quota {
+			return &LimitError{fmt.Sprintf("Daily label quota of this API key exceeded, %d of %d labels used", used, quota), untilTomorrow}
+		}
+	}
+	return nil
+}
@@ -1,27 +1,69 @@
 package job
 
 import (
+	"log/slog"
 	"pos-printer/internal/config"
-	"pos-printer/internal/db"
-	"pos-printer/internal/printer"
+	"pos-printer/internal/label"
+	"pos-printer/internal/model"
 	"sync"
+	"time"
 )
 
+// Store is the part of the job database the workers use.
+type Store interface {
+	BarcodeJobReady() <-chan struct{}
+	ClaimBarcodeJob() (*model.BarcodeJob, error)
+	RenewBarcodeJobLease(jobID int) error
+	UpdateBarcodeJobProgress(jobID int, printedCount int) error
+	CompleteBarcodeJob(jobID int, status string) error
+	UrgentBarcodeJobWaiting(printerKey string, priority int) (bool, error)
+	YieldBarcodeJob(jobID int) error
+	RecoverExpiredBarcodeJobs() ([]int, error)
+	RecoverOrphanedBarcodeJobs() ([]int, error)
+	NextBarcodeJobDue() (*time.Time, error)
+	DueBarcodeSchedules(now time.Time) ([]*model.BarcodeSchedule, error)
+	NextBarcodeScheduleRun() (*time.Time, error)
+	FireBarcodeSchedule(sched *model.BarcodeSchedule, job model.PrintBarcodeRequest, nextRunAt time.Time) (int64, bool, error)
+	SkipBarcodeSchedule(sched *model.BarcodeSchedule, nextRunAt time.Time, disable bool) (bool, error)
+	FetchAPIKey(id string) (*model.APIKey, error)
+	LimitStore
+	BarcodeJobsToPurge(status string, maxAge time.Duration, keep int, limit int) ([]*model.BarcodeJob, error)
+	DeleteBarcodeJobs(status string, ids []int) (int64, error)
+	Optimize() error
+	CreateBackup() (*model.Backup, error)
+	AppendAuditEntry(e *model.AuditEntry) error
+}
+
+// Printer sends rendered jobs to a USB or emulated printer.
+type Printer interface {
+	PrintBarcode(vidHexStr, pidHexStr string, lang label.Language, labels []*label.Label, calibrate bool) error
+}
+
 type Processor struct {
-	posPrinter *printer.PosPrinter
-	db         *db.SQLite
-	cfg        *config.Config
+	printer Printer
+	store   Store
+	cfg     *config.Config
 
 	stopChan chan struct{}
+	wake     chan struct{}
 	wg       sync.WaitGroup
 }
 
-func NewProcessor(posPrinter *printer.PosPrinter, db *db.SQLite, cfg *config.Config) *Processor {
+func NewProcessor(printer Printer, store Store, cfg *config.Config) *Processor {
 	return &Processor{
-		posPrinter: posPrinter,
-		db:         db,
-		cfg:        cfg,
-		stopChan:   make(chan struct{}),
-		wg:         sync.WaitGroup{},
+		printer:  printer,
+		store:    store,
+		cfg:      cfg,
+		stopChan: make(chan struct{}),
+		wake:     make(chan struct{}, 1),
+		wg:       sync.WaitGroup{},
+	}
+}
+
+// audit records an action the service took on its own. A failed write is
+// logged, as the action has already happened.
+func (p *Processor) audit(entry *model.AuditEntry) {
+	if err := p.store.AppendAuditEntry(entry); err != nil {
+		slog.Error("Error writing audit entry", "action", entry.Action, "target_type", entry.TargetType, "target_id", entry.TargetID, "error", err)
 	}
 }
@@ -0,0 +1,165 @@
+package job
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"pos-printer/internal/config"
+	"pos-printer/internal/logging"
+	"pos-printer/internal/model"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/robfig/cron/v3"
+)
+
+// NextRun returns the first time after the given one at which the cron
+// expression fires. Expressions have five fields, or a descriptor such as
+// "@daily", and are evaluated in local time unless prefixed with
+// "CRON_TZ=<zone> ".
+func NextRun(expr string, after time.Time) (time.Time, error) {
+	sched, err := cron.ParseStandard(expr)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid cron expression: %w", err)
+	}
+	next := sched.Next(after)
+	if next.IsZero() {
+		return time.Time{}, fmt.Errorf("cron expression %q never fires", expr)
+	}
+	return next, nil
+}
+
+// ExpandTemplate fills the placeholders of a scheduled job template for a
+// run at the given time: {date} becomes 2006-01-02 and {time} 15:04.
+func ExpandTemplate(req model.PrintBarcodeRequest, at time.Time) model.PrintBarcodeRequest {
+	r := strings.NewReplacer(
+		"{date}", at.Format("2006-01-02"),
+		"{time}", at.Format("15:04"),
+	)
+	req.TopText = r.Replace(req.TopText)
+	req.BarcodeData = r.Replace(req.BarcodeData)
+	req.NotBefore = nil
+	return req
+}
+
+// RunScheduler enqueues the jobs of recurring schedules as they come due.
+// A schedule that was missed while the service was down fires once on
+// startup and then resumes its normal times.
+func (p *Processor) RunScheduler() {
+	for {
+		p.fireDueSchedules()
+
+		wait := p.cfg.WorkerConfig.PollInterval
+		if next, err := p.store.NextBarcodeScheduleRun(); err != nil {
+			slog.Error("Error reading schedules", "error", err)
+		} else if next != nil && time.Until(*next) < wait {
+			wait = max(time.Until(*next), 0)
+		}
+
+		select {
+		case <-p.stopChan:
+			slog.Debug("Scheduler stopping")
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (p *Processor) fireDueSchedules() {
+	now := time.Now()
+	due, err := p.store.DueBarcodeSchedules(now)
+	if err != nil {
+		slog.Error("Error reading due schedules", "error", err)
+		return
+	}
+
+	for _, sched := range due {
+		next, err := NextRun(sched.Cron, now)
+		if err != nil {
+			slog.Error("Invalid schedule", "schedule_id", sched.ID, "error", err)
+			continue
+		}
+		job := ExpandTemplate(sched.Job, now)
+		reason, disable, err := p.checkSchedule(sched, &job)
+		if err != nil {
+			slog.Error("Error checking schedule", "schedule_id", sched.ID, "error", err)
+			continue
+		}
+		if reason != "" {
+			p.skipSchedule(sched, next, reason, disable)
+			continue
+		}
+
+		// A fired job has no request, so it gets an ID of its own to
+		// follow it from here into the worker.
+		job.RequestID = logging.NewRequestID()
+		jobID, fired, err := p.store.FireBarcodeSchedule(sched, job, next)
+		if err != nil {
+			slog.Error("Schedule failed to enqueue job", "schedule_id", sched.ID, "error", err)
+			continue
+		}
+		if fired {
+			slog.Info("Schedule enqueued job", "schedule_id", sched.ID, "schedule", sched.Name,
+				"job_id", jobID, "request_id", job.RequestID, "next_run", next.Format(time.RFC3339))
+			p.audit(&model.AuditEntry{
+				Source:     model.AuditSourceScheduler,
+				Action:     model.AuditScheduleFire,
+				APIKeyID:   sched.APIKeyID,
+				TargetType: "schedule",
+				TargetID:   strconv.Itoa(sched.ID),
+				PrinterKey: config.PrinterKey(sched.Job.VID, sched.Job.PID),
+				After:      model.AuditSnapshot(map[string]any{"jobId": jobID}),
+			})
+		}
+	}
+}
+
+// checkSchedule returns why a due schedule must not enqueue job, or "" if
+// it may. The schedule's key, if it has one, must not be revoked, and the
+// job is held to the print limits of a request made with that key. A
+// revoked key also turns the schedule off; a limit skips only this run.
+func (p *Processor) checkSchedule(sched *model.BarcodeSchedule, job *model.PrintBarcodeRequest) (reason string, disable bool, err error) {
+	var key *model.APIKey
+	if sched.APIKeyID != nil {
+		key, err = p.store.FetchAPIKey(strconv.FormatInt(*sched.APIKeyID, 10))
+		if errors.Is(err, sql.ErrNoRows) || err == nil && key.RevokedAt != nil {
+			return "API key revoked", true, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+	}
+
+	err = CheckPrintLimits(p.store, p.cfg.LimitsConfig, key, job)
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		return limitErr.Message, false, nil
+	}
+	return "", false, err
+}
+
+// skipSchedule advances a due schedule past this run without enqueuing
+// its job, and with disable, turns it off.
+func (p *Processor) skipSchedule(sched *model.BarcodeSchedule, next time.Time, reason string, disable bool) {
+	skipped, err := p.store.SkipBarcodeSchedule(sched, next, disable)
+	if err != nil {
+		slog.Error("Error skipping schedule", "schedule_id", sched.ID, "error", err)
+		return
+	}
+	if !skipped {
+		return
+	}
+	slog.Warn("Schedule skipped a run", "schedule_id", sched.ID, "schedule", sched.Name,
+		"reason", reason, "disabled", disable, "next_run", next.Format(time.RFC3339))
+	p.audit(&model.AuditEntry{
+		Source:     model.AuditSourceScheduler,
+		Action:     model.AuditScheduleSkip,
+		APIKeyID:   sched.APIKeyID,
+		TargetType: "schedule",
+		TargetID:   strconv.Itoa(sched.ID),
+		PrinterKey: config.PrinterKey(sched.Job.VID, sched.Job.PID),
+		After:      model.AuditSnapshot(map[string]any{"reason": reason, "enabled": !disable}),
+	})
+}
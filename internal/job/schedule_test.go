@@ -0,0 +1,87 @@
+package job
+
+import (
+	"pos-printer/internal/config"
+	"pos-printer/internal/model"
+	"testing"
+	"time"
+)
+
+func TestFireDueSchedules(t *testing.T) {
+	keyID := int64(5)
+	revoked := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name        string
+		key         *model.APIKey // stored under keyID, nil for none
+		withKey     bool          // whether the schedule was created with keyID
+		setup       func(*fakeStore, *config.LimitsConfig)
+		wantFired   bool
+		wantDisable bool // when not fired
+	}{
+		{name: "fires without a key", wantFired: true},
+		{name: "fires for a live key", key: &model.APIKey{ID: keyID}, withKey: true, wantFired: true},
+		{
+			name: "disables the schedule of a revoked key", withKey: true,
+			key:         &model.APIKey{ID: keyID, RevokedAt: &revoked},
+			wantDisable: true,
+		},
+		{name: "disables the schedule of a missing key", withKey: true, wantDisable: true},
+		{
+			name: "skips a run over the key's quota", key: &model.APIKey{ID: keyID}, withKey: true,
+			setup: func(s *fakeStore, l *config.LimitsConfig) {
+				l.KeyDailyLabels = 10
+				s.keyLabels = 9
+			},
+		},
+		{
+			name: "skips a run into a full queue",
+			setup: func(s *fakeStore, l *config.LimitsConfig) {
+				l.MaxQueuedJobs = 3
+				s.queued = 3
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore()
+			cfg := testConfig()
+			cfg.LimitsConfig = config.LimitsConfig{}
+			if tt.key != nil {
+				store.keys[keyID] = tt.key
+			}
+			if tt.setup != nil {
+				tt.setup(store, &cfg.LimitsConfig)
+			}
+			next := time.Now().Add(-time.Minute)
+			sched := &model.BarcodeSchedule{
+				ID: 1, Name: "morning", Cron: "@daily", Enabled: true, NextRunAt: &next,
+				Job: model.PrintBarcodeRequest{VID: "0x0fe6", PID: "0x8800", BarcodeData: "{date}", PrintCount: 2},
+			}
+			if tt.withKey {
+				sched.APIKeyID = &keyID
+			}
+			store.schedules = []*model.BarcodeSchedule{sched}
+
+			NewProcessor(&fakePrinter{}, store, cfg).fireDueSchedules()
+
+			if fired := len(store.fired) == 1; fired != tt.wantFired {
+				t.Fatalf("fired %d jobs, want fired %v", len(store.fired), tt.wantFired)
+			}
+			wantAction := model.AuditScheduleFire
+			if !tt.wantFired {
+				wantAction = model.AuditScheduleSkip
+				disabled, skipped := store.skipped[1]
+				if !skipped || disabled != tt.wantDisable {
+					t.Errorf("skipped %v, disabled %v, want skipped and disabled %v", skipped, disabled, tt.wantDisable)
+				}
+			} else if store.fired[0].RequestID == "" {
+				t.Error("fired job has no request ID")
+			}
+			if len(store.audit) != 1 || store.audit[0].Action != wantAction {
+				t.Errorf("audit = %+v, want one %s entry", store.audit, wantAction)
+			}
+		})
+	}
+}
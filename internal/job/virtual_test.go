@@ -0,0 +1,101 @@
+package job
+
+import (
+	"os"
+	"path/filepath"
+	"pos-printer/internal/config"
+	"pos-printer/internal/db"
+	"pos-printer/internal/label"
+	"pos-printer/internal/model"
+	"pos-printer/internal/printer"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// TestVirtualPrinter runs jobs from a SQLite queue through a worker onto
+// the virtual printer, as the service does without printers attached.
+func TestVirtualPrinter(t *testing.T) {
+	tests := []struct {
+		name         string
+		fault        string
+		wantStatus   string
+		wantAttempts int
+		wantPrinted  int
+		wantStreams  int
+	}{
+		{name: "prints in chunks", wantStatus: "done", wantAttempts: 1, wantPrinted: 5, wantStreams: 3},
+		{name: "paper out fails the job", fault: "paper-out", wantStatus: "failed", wantAttempts: 3},
+		{name: "disconnect fails the job", fault: "disconnect", wantStatus: "failed", wantAttempts: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			cfg.DBConfig.Driver = config.DriverSQLite
+			cfg.DBConfig.SQLitePath = filepath.Join(t.TempDir(), "db.sqlite")
+			cfg.DBConfig.Migrate = true
+			cfg.BackupConfig.IntegrityCheck = false
+			cfg.WorkerConfig.Printers = nil
+			cfg.WorkerConfig.PollInterval = 10 * time.Millisecond
+			cfg.PrinterConfig.VirtualConfig = config.VirtualPrinterConfig{
+				All: true, Dir: t.TempDir(), Fault: tt.fault, FaultPercent: 100,
+			}
+
+			store, err := db.NewSQLite(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			id, err := store.EnqueueBarcodeJob(model.PrintBarcodeRequest{
+				VID: "0x0fe6", PID: "0x8800", SizeX: 40, SizeY: 30,
+				TopText: "100tk", BarcodeData: "AX2B2CL21LL2", PrintCount: 5,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			p := NewProcessor(printer.NewPosPrinter(cfg), store, cfg)
+			stopped := make(chan struct{})
+			go func() {
+				p.workerBarcode(0)
+				close(stopped)
+			}()
+			var job *model.BarcodeJob
+			waitFor(t, "the job to finish", func() bool {
+				job, err = store.FetchBarcodeJob(strconv.FormatInt(id, 10))
+				return err == nil && (job.Status == "done" || job.Status == "failed")
+			})
+			close(p.stopChan)
+			<-stopped
+
+			if job.Status != tt.wantStatus || job.Attempts != tt.wantAttempts || job.PrintedCount != tt.wantPrinted {
+				t.Errorf("job status = %q, attempts %d, printed %d; want %q, %d, %d",
+					job.Status, job.Attempts, job.PrintedCount, tt.wantStatus, tt.wantAttempts, tt.wantPrinted)
+			}
+
+			// One stream per chunk of 2, 2 and 1 labels.
+			streams, _ := filepath.Glob(filepath.Join(cfg.PrinterConfig.VirtualConfig.Dir, "0x0fe6-0x8800", "*.tspl"))
+			if len(streams) != tt.wantStreams {
+				t.Fatalf("recorded %v, want %d streams", streams, tt.wantStreams)
+			}
+			copies := 0
+			for _, path := range streams {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				labels, err := label.ParseTSPL(data)
+				if err != nil {
+					t.Fatalf("%s: %v", path, err)
+				}
+				for _, l := range labels {
+					copies += l.Copies
+				}
+			}
+			if copies != tt.wantPrinted {
+				t.Errorf("recorded %d labels, want %d", copies, tt.wantPrinted)
+			}
+		})
+	}
+}
@@ -1,7 +1,7 @@
 package job
 
 import (
-	"log"
+	"log/slog"
 	"time"
 )
 
@@ -14,29 +14,90 @@ func (p *Processor) workerBarcode(id int) {
 	for {
 		select {
 		case <-p.stopChan:
-			log.Printf("Worker %d stopping", id)
+			slog.Debug("Worker stopping", "worker", id)
 			return
 		default:
-			job, err := p.db.FetchBarcodeAndUpdateStatusToInProgress()
-			if err != nil {
-				log.Printf("Worker %d: fetch error: %v", id, err)
-				time.Sleep(time.Second)
-				continue
-			}
-			if job == nil {
-				time.Sleep(time.Second)
-				continue
-			}
-			p.processBarcodeJob(id, job)
 		}
+
+		job, err := p.store.ClaimBarcodeJob()
+		if err != nil {
+			slog.Error("Error claiming a job", "worker", id, "error", err)
+			p.sleep(time.Second)
+			continue
+		}
+		if job == nil {
+			p.waitForBarcodeJob()
+			continue
+		}
+
+		// There may be more work queued behind this job, let an idle
+		// worker look for it while this one prints.
+		p.wakeWorker()
+		p.processBarcodeJob(id, job)
+	}
+}
+
+// waitForBarcodeJob blocks until a job is enqueued, another worker hands
+// over, a held job comes due, or the poll interval passes; the timer picks
+// up retried and requeued jobs, which are not announced.
+func (p *Processor) waitForBarcodeJob() {
+	wait := p.cfg.WorkerConfig.PollInterval
+	if due, err := p.store.NextBarcodeJobDue(); err == nil && due != nil && time.Until(*due) < wait {
+		wait = max(time.Until(*due), 0)
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-p.stopChan:
+	case <-p.store.BarcodeJobReady():
+	case <-p.wake:
+	case <-timer.C:
+	}
+}
+
+func (p *Processor) wakeWorker() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (p *Processor) sleep(d time.Duration) {
+	select {
+	case <-p.stopChan:
+	case <-time.After(d):
 	}
 }
 
 func (p *Processor) StartWorkers() {
+	// Nothing has been claimed yet, so any job still leased to this
+	// instance was orphaned by a crash.
+	p.RecoverOrphanedBarcodeJobs()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.ReapExpiredBarcodeJobs()
+	}()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.RunScheduler()
+	}()
+
+	p.wg.Add(1)
+	go func() {
+		defer p.wg.Done()
+		p.RunJanitor()
+	}()
+
 	p.wg.Add(1)
 	go func() {
 		defer p.wg.Done()
-		p.RequeueStaleBarcodeJobs()
+		p.RunBackups()
 	}()
 
 	for i := 0; i < p.cfg.WorkerConfig.BarcodeWorkerCount; i++ {
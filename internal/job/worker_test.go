@@ -0,0 +1,68 @@
+package job
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it holds or a few seconds pass.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestWorkerBarcode(t *testing.T) {
+	tests := []struct {
+		name      string
+		claimErrs []error
+	}{
+		{name: "processes the queue"},
+		{name: "keeps going after a claim error", claimErrs: []error{errors.New("database is locked")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newFakeStore(testJob(1, 1), testJob(2, 3), testJob(3, 2))
+			store.claimErrs = tt.claimErrs
+			printer := &fakePrinter{}
+			cfg := testConfig()
+			// Only an announced job may wake the idle worker.
+			cfg.WorkerConfig.PollInterval = time.Hour
+			p := NewProcessor(printer, store, cfg)
+
+			stopped := make(chan struct{})
+			go func() {
+				p.workerBarcode(0)
+				close(stopped)
+			}()
+
+			waitFor(t, "the queued jobs", func() bool { return store.completedCount() == 3 })
+
+			// The worker is idle now, an enqueued job must wake it.
+			store.enqueue(testJob(4, 1))
+			waitFor(t, "the enqueued job", func() bool { return store.completedCount() == 4 })
+
+			close(p.stopChan)
+			select {
+			case <-stopped:
+			case <-time.After(5 * time.Second):
+				t.Fatal("worker did not stop")
+			}
+
+			store.mu.Lock()
+			defer store.mu.Unlock()
+			for id := 1; id <= 4; id++ {
+				if store.completed[id] != "done" {
+					t.Errorf("job %d: status = %q, want done", id, store.completed[id])
+				}
+			}
+		})
+	}
+}
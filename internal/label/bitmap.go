@@ -0,0 +1,29 @@
+package label
+
+import (
+	"image"
+	"image/color"
+)
+
+// monochrome packs img into rows of bytes, most significant bit first, with
+// a set bit for every dot that should be printed.
+func monochrome(img image.Image, threshold uint8) (data []byte, bytesPerRow, height int) {
+	if threshold == 0 {
+		threshold = 128
+	}
+	bounds := img.Bounds()
+	bytesPerRow = (bounds.Dx() + 7) / 8
+	height = bounds.Dy()
+	data = make([]byte, bytesPerRow*height)
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < bounds.Dx(); x++ {
+			gray := color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)).(color.Gray)
+			_, _, _, a := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			if a > 0x7fff && gray.Y < threshold {
+				data[y*bytesPerRow+x/8] |= 0x80 >> (x % 8)
+			}
+		}
+	}
+	return data, bytesPerRow, height
+}
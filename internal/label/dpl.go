@@ -0,0 +1,170 @@
+package label
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"strings"
+
+	"golang.org/x/image/bmp"
+)
+
+const (
+	stx = "\x02"
+	cr  = "\r"
+)
+
+type dplRenderer struct{}
+
+// DPL barcode IDs; the upper case ID prints the human readable line.
+var dplBarcodeTypes = map[Symbology]byte{
+	Code128: 'E',
+	Code39:  'A',
+	EAN13:   'F',
+	EAN8:    'G',
+	UPCA:    'B',
+	ITF:     'D',
+}
+
+// Internal DPL fonts "0" to "6" at 203 dpi.
+var dplFonts = []struct {
+	name   string
+	height int
+}{
+	{"0", 7},
+	{"1", 13},
+	{"2", 18},
+	{"3", 27},
+	{"4", 36},
+	{"5", 52},
+	{"6", 64},
+}
+
+// Calibrate returns nil: Datamax printers measure the gap with their edge
+// sensor on every feed and DPL has no stand-alone gap detection command.
+func (dplRenderer) Calibrate() []byte {
+	return nil
+}
+
+func (dplRenderer) Render(l *Label) ([]byte, error) {
+	var (
+		buf    bytes.Buffer
+		fields bytes.Buffer
+		images int
+	)
+
+	// In metric mode rows and columns are given in tenths of a millimetre,
+	// with rows counted up from the bottom edge of the label. A field's
+	// position is its lower left corner, about which a rotated field turns,
+	// so turning the label means moving that corner to the opposite side
+	// and printing the field upside down.
+	dpm := l.dotsPerMM()
+	units := func(dots int) int { return dots * 10 / dpm }
+	rotation := byte('1')
+	row := func(y, h int) int { return max(units(l.HeightDots()-y-h), 0) }
+	col := func(x int) int { return units(x) }
+	if l.Direction == 1 {
+		rotation = '3'
+		row = func(y, h int) int { return units(y + h) }
+		col = func(x int) int { return max(units(l.WidthDots()-x), 0) }
+	}
+
+	buf.WriteString(stx + "m" + cr)
+	if l.GapMM > 0 {
+		buf.WriteString(stx + "e" + cr)
+		fmt.Fprintf(&buf, stx+"M%04d"+cr, units(l.HeightDots()+l.GapMM*dpm))
+	}
+	if l.Cut {
+		buf.WriteString(stx + "V1" + cr)
+	}
+
+	for _, el := range l.Elements {
+		switch el := el.(type) {
+		case Text:
+			font, height := dplFont(el.Height)
+			fmt.Fprintf(&fields, "%c%s11000%04d%04d%s"+cr,
+				rotation, font, row(el.Y, height), col(el.X), dplData(el.Content))
+		case Barcode:
+			kind, ok := dplBarcodeTypes[el.Symbology]
+			if !ok {
+				return nil, fmt.Errorf("dpl: unsupported barcode symbology %q", el.Symbology)
+			}
+			if !el.HumanReadable {
+				kind += 'a' - 'A'
+			}
+			fmt.Fprintf(&fields, "%c%c%s%s%03d%04d%04d%s"+cr,
+				rotation, kind, dplMultiplier(el.Wide), dplMultiplier(el.Narrow),
+				units(el.Height), row(el.Y, el.Height), col(el.X), dplData(el.Data))
+		case QRCode:
+			fmt.Fprintf(&fields, "%cW1D%s%s000%04d%04d%cM,A%s"+cr,
+				rotation, dplMultiplier(el.CellWidth), dplMultiplier(el.CellWidth),
+				row(el.Y, 0), col(el.X), qrECC(el.ECC), dplData(el.Data))
+		case Box:
+			fmt.Fprintf(&fields, "%cX1100%04d%04dB%03d%03d%03d%03d"+cr,
+				rotation, row(el.Y, el.Height), col(el.X),
+				units(el.Width), units(el.Height), units(el.Thickness), units(el.Thickness))
+		case Image:
+			// Graphics have to be downloaded to the printer before the
+			// label format that references them.
+			name := fmt.Sprintf("PPIMG%d", images)
+			images++
+			var img bytes.Buffer
+			if err := bmp.Encode(&img, dplBitmap(el)); err != nil {
+				return nil, fmt.Errorf("dpl: failed to encode image: %w", err)
+			}
+			buf.WriteString(stx + "IAb" + name + cr)
+			buf.Write(img.Bytes())
+			fmt.Fprintf(&fields, "%cY1100%04d%04d%s"+cr,
+				rotation, row(el.Y, el.Image.Bounds().Dy()), col(el.X), name)
+		default:
+			return nil, fmt.Errorf("dpl: unsupported element %T", el)
+		}
+	}
+
+	buf.WriteString(stx + "L" + cr)
+	buf.WriteString("D11" + cr)
+	buf.Write(fields.Bytes())
+	fmt.Fprintf(&buf, "Q%04d"+cr, l.copies())
+	buf.WriteString("E" + cr)
+	return buf.Bytes(), nil
+}
+
+func dplFont(height int) (string, int) {
+	f := dplFonts[0]
+	for _, font := range dplFonts {
+		if font.height <= height {
+			f = font
+		}
+	}
+	return f.name, f.height
+}
+
+// dplMultiplier encodes a bar width or font multiplier as the single
+// character DPL expects: 0-9, then A-O for 10 to 24.
+func dplMultiplier(n int) string {
+	n = min(max(n, 1), 24)
+	if n < 10 {
+		return string(rune('0' + n))
+	}
+	return string(rune('A' + n - 10))
+}
+
+// dplData strips line breaks, which would terminate the field record.
+func dplData(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+func dplBitmap(el Image) image.Image {
+	data, bytesPerRow, height := monochrome(el.Image, el.Threshold)
+	width := el.Image.Bounds().Dx()
+	img := image.NewPaletted(image.Rect(0, 0, width, height), color.Palette{color.White, color.Black})
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			if data[y*bytesPerRow+x/8]&(0x80>>(x%8)) != 0 {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+	return img
+}
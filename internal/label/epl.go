@@ -0,0 +1,111 @@
+package label
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type eplRenderer struct{}
+
+var eplBarcodeTypes = map[Symbology]string{
+	Code128: "1",
+	Code39:  "3",
+	EAN13:   "E30",
+	EAN8:    "E80",
+	UPCA:    "UA0",
+	ITF:     "2",
+}
+
+// Resident EPL2 fonts "1" to "5" at 203 dpi.
+var eplFonts = []struct {
+	name   string
+	height int
+}{
+	{"1", 12},
+	{"2", 16},
+	{"3", 20},
+	{"4", 24},
+	{"5", 48},
+}
+
+func (eplRenderer) Calibrate() []byte {
+	return []byte("\nxa\n")
+}
+
+func (eplRenderer) Render(l *Label) ([]byte, error) {
+	var buf bytes.Buffer
+	dpm := l.dotsPerMM()
+
+	// A leading line feed flushes any partial command left in the buffer.
+	buf.WriteString("\nN\n")
+	fmt.Fprintf(&buf, "q%d\n", l.WidthDots())
+	if l.GapMM > 0 {
+		fmt.Fprintf(&buf, "Q%d,%d", l.HeightDots(), l.GapMM*dpm)
+		if l.GapOffsetMM != 0 {
+			fmt.Fprintf(&buf, ",%+d", l.GapOffsetMM*dpm)
+		}
+		buf.WriteString("\n")
+	}
+	if l.Direction == 1 {
+		buf.WriteString("ZB\n")
+	} else {
+		buf.WriteString("ZT\n")
+	}
+	if l.Cut {
+		buf.WriteString("OC\n")
+	}
+
+	for _, el := range l.Elements {
+		switch el := el.(type) {
+		case Text:
+			fmt.Fprintf(&buf, "A%d,%d,0,%s,1,1,N,\"%s\"\n",
+				el.X, el.Y, eplFont(el.Height), eplQuote(el.Content))
+		case Barcode:
+			kind, ok := eplBarcodeTypes[el.Symbology]
+			if !ok {
+				return nil, fmt.Errorf("epl: unsupported barcode symbology %q", el.Symbology)
+			}
+			hr := "N"
+			if el.HumanReadable {
+				hr = "B"
+			}
+			fmt.Fprintf(&buf, "B%d,%d,0,%s,%d,%d,%d,%s,\"%s\"\n",
+				el.X, el.Y, kind, el.Narrow, el.Wide, el.Height, hr, eplQuote(el.Data))
+		case QRCode:
+			fmt.Fprintf(&buf, "b%d,%d,Q,m2,s%d,e%c,\"%s\"\n",
+				el.X, el.Y, el.CellWidth, qrECC(el.ECC), eplQuote(el.Data))
+		case Box:
+			fmt.Fprintf(&buf, "X%d,%d,%d,%d,%d\n",
+				el.X, el.Y, el.Thickness, el.X+el.Width, el.Y+el.Height)
+		case Image:
+			data, bytesPerRow, height := monochrome(el.Image, el.Threshold)
+			// Like TSPL, EPL prints the cleared bits of a graphic.
+			for i := range data {
+				data[i] = ^data[i]
+			}
+			fmt.Fprintf(&buf, "GW%d,%d,%d,%d,", el.X, el.Y, bytesPerRow, height)
+			buf.Write(data)
+			buf.WriteString("\n")
+		default:
+			return nil, fmt.Errorf("epl: unsupported element %T", el)
+		}
+	}
+
+	fmt.Fprintf(&buf, "P%d,1\n", l.copies())
+	return buf.Bytes(), nil
+}
+
+func eplFont(height int) string {
+	name := eplFonts[0].name
+	for _, f := range eplFonts {
+		if f.height <= height {
+			name = f.name
+		}
+	}
+	return name
+}
+
+func eplQuote(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s)
+}
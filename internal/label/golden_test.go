@@ -0,0 +1,97 @@
+package label
+
+import (
+	"bytes"
+	"flag"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// goldenLabels are rendered in every language and compared byte for byte
+// with testdata/<name>.<language>.golden.
+func goldenLabels() map[string]*Label {
+	img := image.NewGray(image.Rect(0, 0, 16, 4))
+	for x := 0; x < 16; x += 2 {
+		for y := 0; y < 4; y++ {
+			img.SetGray(x, y, color.Gray{})
+		}
+	}
+	for x := 1; x < 16; x += 2 {
+		for y := 0; y < 4; y++ {
+			img.SetGray(x, y, color.Gray{Y: 255})
+		}
+	}
+
+	return map[string]*Label{
+		"barcode":         NewBarcodeLabel(40, 30, 0, "100tk", "AX2B2CL21LL2", 2, 2, 0, DefaultDotsPerMM),
+		"barcode-rotated": NewBarcodeLabel(40, 30, 1, "100tk", "AX2B2CL21LL2", 2, 2, 0, DefaultDotsPerMM),
+		"barcode-autogap": NewBarcodeLabel(55, 45, 0, "Prep", "12345678", 1, 0, 0, DefaultDotsPerMM),
+		"elements": {
+			WidthMM: 50, HeightMM: 25, GapMM: 3, DotsPerMM: DefaultDotsPerMM, Copies: 1,
+			Elements: []Element{
+				Text{X: 10, Y: 10, Height: 24, Content: `say "hi"`},
+				Barcode{X: 10, Y: 40, Symbology: EAN13, Height: 50, Narrow: 2, Wide: 4, Data: "5901234123457"},
+				QRCode{X: 250, Y: 10, ECC: 'M', CellWidth: 4, Data: "https://example.com"},
+				Box{X: 5, Y: 5, Width: 390, Height: 190, Thickness: 2},
+				Image{X: 300, Y: 150, Image: img},
+			},
+		},
+	}
+}
+
+func TestRenderGolden(t *testing.T) {
+	for name, l := range goldenLabels() {
+		for _, lang := range []Language{TSPL, ZPL, EPL, DPL} {
+			t.Run(name+"."+string(lang), func(t *testing.T) {
+				r, err := NewRenderer(lang)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := r.Render(l)
+				if err != nil {
+					t.Fatalf("Render: %v", err)
+				}
+
+				path := filepath.Join("testdata", name+"."+string(lang)+".golden")
+				if *update {
+					if err := os.WriteFile(path, got, 0644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+				want, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("%v; run go test ./internal/label -update to create it", err)
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("%s differs from the golden file\ngot:\n%q\nwant:\n%q", path, got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestRenderGoldenTSPLRoundTrip(t *testing.T) {
+	// The virtual printer parses TSPL back into labels, so the golden
+	// streams must stay parseable.
+	for _, name := range []string{"barcode", "barcode-rotated", "barcode-autogap"} {
+		data, err := os.ReadFile(filepath.Join("testdata", name+".tspl.golden"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		labels, err := ParseTSPL(data)
+		if err != nil {
+			t.Fatalf("%s: ParseTSPL: %v", name, err)
+		}
+		want := goldenLabels()[name]
+		if len(labels) != 1 || labels[0].WidthMM != want.WidthMM || labels[0].HeightMM != want.HeightMM ||
+			labels[0].Direction != want.Direction {
+			t.Errorf("%s: parsed %+v, want size %dx%d direction %d", name, labels, want.WidthMM, want.HeightMM, want.Direction)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package label
+
+import "image"
+
+// DefaultDotsPerMM is the resolution of a 203 dpi print head, which is what
+// every TSPL, ZPL and EPL desktop printer we deploy ships with.
+const DefaultDotsPerMM = 8
+
+type Symbology string
+
+const (
+	Code128 Symbology = "code128"
+	Code39  Symbology = "code39"
+	EAN13   Symbology = "ean13"
+	EAN8    Symbology = "ean8"
+	UPCA    Symbology = "upca"
+	ITF     Symbology = "itf"
+)
+
+// Label is a printer independent description of a single label format.
+// Sizes are in millimetres, element positions and dimensions in dots.
+type Label struct {
+	WidthMM     int
+	HeightMM    int
+	GapMM       int // 0 => let the printer detect the gap
+	GapOffsetMM int
+	Direction   int // 0 = normal, 1 = rotated 180 degrees
+	DotsPerMM   int
+	Copies      int
+	Cut         bool
+	Elements    []Element
+}
+
+type Element interface {
+	element()
+}
+
+type Text struct {
+	X, Y    int
+	Height  int // character height in dots, mapped to the closest printer font
+	Content string
+}
+
+type Barcode struct {
+	X, Y          int
+	Symbology     Symbology
+	Height        int
+	Narrow        int // narrow bar width in dots
+	Wide          int // wide bar width in dots
+	HumanReadable bool
+	Data          string
+}
+
+type QRCode struct {
+	X, Y      int
+	ECC       byte // 'L', 'M', 'Q' or 'H'
+	CellWidth int
+	Data      string
+}
+
+type Box struct {
+	X, Y          int
+	Width, Height int
+	Thickness     int
+}
+
+type Image struct {
+	X, Y      int
+	Image     image.Image
+	Threshold uint8 // luminance below which a pixel is printed; 0 => 128
+}
+
+func (Text) element()    {}
+func (Barcode) element() {}
+func (QRCode) element()  {}
+func (Box) element()     {}
+func (Image) element()   {}
+
+func (l *Label) dotsPerMM() int {
+	if l.DotsPerMM > 0 {
+		return l.DotsPerMM
+	}
+	return DefaultDotsPerMM
+}
+
+func (l *Label) copies() int {
+	if l.Copies > 0 {
+		return l.Copies
+	}
+	return 1
+}
+
+// WidthDots and HeightDots return the label size in print head dots.
+func (l *Label) WidthDots() int {
+	return l.WidthMM * l.dotsPerMM()
+}
+
+func (l *Label) HeightDots() int {
+	return l.HeightMM * l.dotsPerMM()
+}
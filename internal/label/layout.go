@@ -0,0 +1,52 @@
+package label
+
+// Layout of the barcode label, in dots at DefaultDotsPerMM: a line of text
+// above a Code 128 barcode, the pair centred vertically on the label.
+const (
+	barcodeHeight = 70
+	textHeight    = 12
+	spacing       = 10
+)
+
+// NewBarcodeLabel lays out a barcode label for a print head with the given
+// resolution, so that it measures the same on paper at any resolution.
+func NewBarcodeLabel(
+	sizeX, sizeY, dir int,
+	topText, barcodeData string,
+	printCount, gapLength, gapOffset, dotsPerMM int) *Label {
+
+	l := &Label{
+		WidthMM:     sizeX,
+		HeightMM:    sizeY,
+		GapMM:       gapLength,
+		GapOffsetMM: gapOffset,
+		Direction:   dir,
+		DotsPerMM:   dotsPerMM,
+		Copies:      printCount,
+		Cut:         true,
+	}
+	dots := func(n int) int { return n * l.dotsPerMM() / DefaultDotsPerMM }
+
+	totalBlock := dots(textHeight + barcodeHeight + spacing)
+	yOffset := (l.HeightDots() - totalBlock) / 2
+
+	l.Elements = []Element{
+		Text{
+			X:       dots(15),
+			Y:       yOffset,
+			Height:  dots(20),
+			Content: topText,
+		},
+		Barcode{
+			X:             0,
+			Y:             yOffset + dots(textHeight+spacing),
+			Symbology:     Code128,
+			Height:        dots(barcodeHeight),
+			Narrow:        dots(2),
+			Wide:          dots(2),
+			HumanReadable: true,
+			Data:          barcodeData,
+		},
+	}
+	return l
+}
@@ -0,0 +1,30 @@
+package label
+
+import "testing"
+
+func TestNewBarcodeLabelScalesWithResolution(t *testing.T) {
+	base := NewBarcodeLabel(40, 30, 0, "100tk", "AX2B2CL21LL2", 1, 2, 0, DefaultDotsPerMM)
+	for _, dpm := range []int{12, 24} {
+		l := NewBarcodeLabel(40, 30, 0, "100tk", "AX2B2CL21LL2", 1, 2, 0, dpm)
+		if l.DotsPerMM != dpm {
+			t.Fatalf("DotsPerMM = %d, want %d", l.DotsPerMM, dpm)
+		}
+		// Every position and size measures the same on paper, to within a
+		// dot of the lower resolution.
+		mm := func(dots, dpm int) float64 { return float64(dots) / float64(dpm) }
+		near := func(name string, got, want int) {
+			t.Helper()
+			if d := mm(got, dpm) - mm(want, DefaultDotsPerMM); d > 1.0/DefaultDotsPerMM || d < -1.0/DefaultDotsPerMM {
+				t.Errorf("%d dots/mm: %s is %.2fmm, want %.2fmm", dpm, name, mm(got, dpm), mm(want, DefaultDotsPerMM))
+			}
+		}
+		text, baseText := l.Elements[0].(Text), base.Elements[0].(Text)
+		near("text x", text.X, baseText.X)
+		near("text y", text.Y, baseText.Y)
+		near("text height", text.Height, baseText.Height)
+		bc, baseBC := l.Elements[1].(Barcode), base.Elements[1].(Barcode)
+		near("barcode y", bc.Y, baseBC.Y)
+		near("barcode height", bc.Height, baseBC.Height)
+		near("barcode module", bc.Narrow, baseBC.Narrow)
+	}
+}
@@ -0,0 +1,197 @@
+package label
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"strconv"
+	"strings"
+)
+
+var tsplSymbologies = func() map[string]Symbology {
+	m := make(map[string]Symbology, len(tsplBarcodeTypes))
+	for sym, kind := range tsplBarcodeTypes {
+		m[kind] = sym
+	}
+	return m
+}()
+
+// ParseTSPL reads a TSPL command stream back into the labels it prints, one
+// per PRINT command. It understands the commands tsplRenderer emits and
+// skips the printer setup commands that do not affect the layout.
+func ParseTSPL(data []byte) ([]*Label, error) {
+	var (
+		labels []*Label
+		cur    = &Label{DotsPerMM: DefaultDotsPerMM}
+	)
+
+	for len(data) > 0 {
+		var raw []byte
+		if i := bytes.IndexByte(data, '\n'); i >= 0 {
+			raw, data = data[:i], data[i+1:]
+		} else {
+			raw, data = data, nil
+		}
+		line := bytes.TrimSpace(raw)
+		if len(line) == 0 {
+			continue
+		}
+
+		cmd, rest, _ := strings.Cut(string(line), " ")
+		args := splitTSPLArgs(rest)
+
+		switch strings.ToUpper(cmd) {
+		case "SIZE":
+			if len(args) < 2 {
+				return nil, fmt.Errorf("tspl: malformed SIZE %q", line)
+			}
+			cur.WidthMM, cur.HeightMM = atoiMM(args[0]), atoiMM(args[1])
+		case "GAP":
+			if len(args) < 2 {
+				return nil, fmt.Errorf("tspl: malformed GAP %q", line)
+			}
+			cur.GapMM, cur.GapOffsetMM = atoiMM(args[0]), atoiMM(args[1])
+		case "DIRECTION":
+			cur.Direction = atoi(args, 0)
+		case "CLS":
+			cur.Elements = nil
+		case "TEXT":
+			if len(args) < 7 {
+				return nil, fmt.Errorf("tspl: malformed TEXT %q", line)
+			}
+			height := tsplFonts[0].height
+			for _, f := range tsplFonts {
+				if f.name == args[2] {
+					height = f.height
+				}
+			}
+			cur.Elements = append(cur.Elements, Text{
+				X: atoi(args, 0), Y: atoi(args, 1), Height: height, Content: args[6],
+			})
+		case "BARCODE":
+			if len(args) < 9 {
+				return nil, fmt.Errorf("tspl: malformed BARCODE %q", line)
+			}
+			sym, ok := tsplSymbologies[args[2]]
+			if !ok {
+				return nil, fmt.Errorf("tspl: unsupported barcode type %q", args[2])
+			}
+			cur.Elements = append(cur.Elements, Barcode{
+				X: atoi(args, 0), Y: atoi(args, 1), Symbology: sym, Height: atoi(args, 3),
+				HumanReadable: atoi(args, 4) != 0, Narrow: atoi(args, 6), Wide: atoi(args, 7),
+				Data: args[8],
+			})
+		case "QRCODE":
+			if len(args) < 7 {
+				return nil, fmt.Errorf("tspl: malformed QRCODE %q", line)
+			}
+			cur.Elements = append(cur.Elements, QRCode{
+				X: atoi(args, 0), Y: atoi(args, 1), ECC: args[2][0], CellWidth: atoi(args, 3),
+				Data: args[len(args)-1],
+			})
+		case "BOX":
+			if len(args) < 5 {
+				return nil, fmt.Errorf("tspl: malformed BOX %q", line)
+			}
+			x, y := atoi(args, 0), atoi(args, 1)
+			cur.Elements = append(cur.Elements, Box{
+				X: x, Y: y, Width: atoi(args, 2) - x, Height: atoi(args, 3) - y, Thickness: atoi(args, 4),
+			})
+		case "BITMAP":
+			// The bitmap payload is binary and may contain line breaks, so
+			// re-read it from the raw stream by its declared size. It
+			// starts after the fifth comma: BITMAP x,y,width,height,mode,
+			stream := append([]byte{}, bytes.TrimLeft(raw, " \t")...)
+			stream = append(append(stream, '\n'), data...)
+			start := 0
+			for n := 0; n < 5; n++ {
+				i := bytes.IndexByte(stream[start:], ',')
+				if i < 0 {
+					return nil, fmt.Errorf("tspl: malformed BITMAP")
+				}
+				start += i + 1
+			}
+			bargs := splitTSPLArgs(strings.TrimPrefix(string(stream[:start-1]), "BITMAP "))
+			bytesPerRow, height := atoi(bargs, 2), atoi(bargs, 3)
+			size := bytesPerRow * height
+			if len(stream)-start < size {
+				return nil, fmt.Errorf("tspl: BITMAP needs %d bytes, got %d", size, len(stream)-start)
+			}
+			data = stream[start+size:]
+			cur.Elements = append(cur.Elements, Image{
+				X: atoi(bargs, 0), Y: atoi(bargs, 1),
+				Image: tsplBitmapImage(stream[start:start+size], bytesPerRow, height),
+			})
+		case "PRINT":
+			lbl := *cur
+			lbl.Copies = atoi(args, 0)
+			lbl.Elements = append([]Element(nil), cur.Elements...)
+			labels = append(labels, &lbl)
+		case "CUT":
+			if len(labels) > 0 {
+				labels[len(labels)-1].Cut = true
+			}
+		case "AUTODETECT", "SET", "SPEED", "DENSITY", "REFERENCE", "OFFSET", "SHIFT", "CODEPAGE", "HOME", "FORMFEED":
+		default:
+			return nil, fmt.Errorf("tspl: unknown command %q", cmd)
+		}
+	}
+	return labels, nil
+}
+
+// splitTSPLArgs splits a comma separated argument list, unquoting string
+// arguments and undoing the \["] escape for embedded quotes.
+func splitTSPLArgs(s string) []string {
+	var (
+		args    []string
+		cur     strings.Builder
+		inQuote bool
+	)
+	for i := 0; i < len(s); i++ {
+		switch {
+		case inQuote && strings.HasPrefix(s[i:], `\["]`):
+			cur.WriteByte('"')
+			i += 3
+		case s[i] == '"':
+			inQuote = !inQuote
+		case s[i] == ',' && !inQuote:
+			args = append(args, strings.TrimSpace(cur.String()))
+			cur.Reset()
+		default:
+			cur.WriteByte(s[i])
+		}
+	}
+	if cur.Len() > 0 || len(args) > 0 {
+		args = append(args, strings.TrimSpace(cur.String()))
+	}
+	return args
+}
+
+func atoi(args []string, i int) int {
+	if i >= len(args) {
+		return 0
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(args[i]))
+	return n
+}
+
+func atoiMM(s string) int {
+	n, _ := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(s), "mm")))
+	return n
+}
+
+func tsplBitmapImage(data []byte, bytesPerRow, height int) image.Image {
+	img := image.NewGray(image.Rect(0, 0, bytesPerRow*8, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < bytesPerRow*8; x++ {
+			// TSPL prints cleared bits.
+			if data[y*bytesPerRow+x/8]&(0x80>>(x%8)) == 0 {
+				img.SetGray(x, y, color.Gray{Y: 0})
+			} else {
+				img.SetGray(x, y, color.Gray{Y: 0xff})
+			}
+		}
+	}
+	return img
+}
@@ -0,0 +1,188 @@
+package label
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"unicode/utf8"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/code39"
+	"github.com/boombuler/barcode/ean"
+	"github.com/boombuler/barcode/qr"
+	"github.com/boombuler/barcode/twooffive"
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+// Shade used for the label gap below the printable area.
+var gapColor = color.Gray{Y: 0xc8}
+
+// Rasterize draws l the way the printer lays it out, one pixel per print
+// head dot. The label gap, if known, is drawn as a grey band underneath.
+func Rasterize(l *Label) (*image.Gray, error) {
+	width, height := l.WidthDots(), l.HeightDots()
+	if width <= 0 || height <= 0 {
+		return nil, fmt.Errorf("invalid label size %dx%d mm", l.WidthMM, l.HeightMM)
+	}
+
+	gap := max(l.GapMM, 0) * l.dotsPerMM()
+	img := image.NewGray(image.Rect(0, 0, width, height+gap))
+	draw.Draw(img, image.Rect(0, 0, width, height), image.White, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, height, width, height+gap), image.NewUniform(gapColor), image.Point{}, draw.Src)
+
+	canvas := img.SubImage(image.Rect(0, 0, width, height)).(*image.Gray)
+	for _, el := range l.Elements {
+		var err error
+		switch el := el.(type) {
+		case Text:
+			f := tsplFonts[tsplFontIndex(el.Height)]
+			drawText(canvas, el.X, el.Y, f.width, f.height, el.Content)
+		case Barcode:
+			err = drawBarcode(canvas, el)
+		case QRCode:
+			err = drawQRCode(canvas, el)
+		case Box:
+			drawBox(canvas, el)
+		case Image:
+			drawImage(canvas, el)
+		default:
+			err = fmt.Errorf("unsupported element %T", el)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if l.Direction == 1 {
+		rotate180(canvas)
+	}
+	return img, nil
+}
+
+func fillRect(img *image.Gray, r image.Rectangle) {
+	draw.Draw(img, r.Add(img.Rect.Min).Intersect(img.Rect), image.Black, image.Point{}, draw.Src)
+}
+
+// drawText renders s with a fixed cell of w x h dots per character,
+// scaling a bitmap font the same way the printer scales its own.
+func drawText(img *image.Gray, x, y, w, h int, s string) {
+	n := utf8.RuneCountInString(s)
+	if n == 0 {
+		return
+	}
+
+	face := basicfont.Face7x13
+	src := image.NewGray(image.Rect(0, 0, n*face.Advance, face.Height))
+	draw.Draw(src, src.Bounds(), image.White, image.Point{}, draw.Src)
+	d := font.Drawer{Dst: src, Src: image.Black, Face: face, Dot: fixed.P(0, face.Ascent)}
+	d.DrawString(s)
+
+	scaled := image.NewGray(image.Rect(0, 0, n*w, h))
+	xdraw.NearestNeighbor.Scale(scaled, scaled.Bounds(), src, src.Bounds(), draw.Src, nil)
+	for sy := 0; sy < h; sy++ {
+		for sx := 0; sx < n*w; sx++ {
+			if scaled.GrayAt(sx, sy).Y < 0x80 {
+				fillRect(img, image.Rect(x+sx, y+sy, x+sx+1, y+sy+1))
+			}
+		}
+	}
+}
+
+func encodeBarcode(b Barcode) (barcode.Barcode, error) {
+	switch b.Symbology {
+	case Code128:
+		return code128.Encode(b.Data)
+	case Code39:
+		return code39.Encode(b.Data, false, true)
+	case EAN13, EAN8:
+		return ean.Encode(b.Data)
+	case UPCA:
+		// UPC-A is EAN-13 with a leading zero.
+		return ean.Encode("0" + b.Data)
+	case ITF:
+		return twooffive.Encode(b.Data, true)
+	}
+	return nil, fmt.Errorf("unsupported barcode symbology %q", b.Symbology)
+}
+
+func drawBarcode(img *image.Gray, b Barcode) error {
+	code, err := encodeBarcode(b)
+	if err != nil {
+		return fmt.Errorf("invalid %s barcode %q: %w", b.Symbology, b.Data, err)
+	}
+
+	module := max(b.Narrow, 1)
+	modules := code.Bounds().Dx()
+	for m := 0; m < modules; m++ {
+		if isDark(code.At(code.Bounds().Min.X+m, code.Bounds().Min.Y)) {
+			fillRect(img, image.Rect(b.X+m*module, b.Y, b.X+(m+1)*module, b.Y+b.Height))
+		}
+	}
+
+	if b.HumanReadable {
+		f := tsplFonts[0]
+		textWidth := utf8.RuneCountInString(b.Data) * f.width
+		x := b.X + (modules*module-textWidth)/2
+		drawText(img, x, b.Y+b.Height+2, f.width, f.height, b.Data)
+	}
+	return nil
+}
+
+func drawQRCode(img *image.Gray, q QRCode) error {
+	level := map[byte]qr.ErrorCorrectionLevel{'L': qr.L, 'M': qr.M, 'Q': qr.Q, 'H': qr.H}[qrECC(q.ECC)]
+	code, err := qr.Encode(q.Data, level, qr.Auto)
+	if err != nil {
+		return fmt.Errorf("invalid QR code %q: %w", q.Data, err)
+	}
+
+	cell := max(q.CellWidth, 1)
+	bounds := code.Bounds()
+	for cy := 0; cy < bounds.Dy(); cy++ {
+		for cx := 0; cx < bounds.Dx(); cx++ {
+			if isDark(code.At(bounds.Min.X+cx, bounds.Min.Y+cy)) {
+				fillRect(img, image.Rect(q.X+cx*cell, q.Y+cy*cell, q.X+(cx+1)*cell, q.Y+(cy+1)*cell))
+			}
+		}
+	}
+	return nil
+}
+
+func drawBox(img *image.Gray, b Box) {
+	t := max(b.Thickness, 1)
+	x0, y0, x1, y1 := b.X, b.Y, b.X+b.Width, b.Y+b.Height
+	fillRect(img, image.Rect(x0, y0, x1, y0+t))
+	fillRect(img, image.Rect(x0, y1-t, x1, y1))
+	fillRect(img, image.Rect(x0, y0, x0+t, y1))
+	fillRect(img, image.Rect(x1-t, y0, x1, y1))
+}
+
+func drawImage(img *image.Gray, el Image) {
+	data, bytesPerRow, height := monochrome(el.Image, el.Threshold)
+	for y := 0; y < height; y++ {
+		for x := 0; x < bytesPerRow*8; x++ {
+			if data[y*bytesPerRow+x/8]&(0x80>>(x%8)) != 0 {
+				fillRect(img, image.Rect(el.X+x, el.Y+y, el.X+x+1, el.Y+y+1))
+			}
+		}
+	}
+}
+
+func isDark(c color.Color) bool {
+	return color.GrayModel.Convert(c).(color.Gray).Y < 0x80
+}
+
+func rotate180(img *image.Gray) {
+	b := img.Bounds()
+	src := image.NewGray(b)
+	draw.Draw(src, b, img, b.Min, draw.Src)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			img.SetGray(x, y, src.GrayAt(b.Max.X-1-(x-b.Min.X), b.Max.Y-1-(y-b.Min.Y)))
+		}
+	}
+}
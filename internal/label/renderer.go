@@ -0,0 +1,46 @@
+package label
+
+import (
+	"fmt"
+	"strings"
+)
+
+type Language string
+
+const (
+	TSPL Language = "tspl"
+	ZPL  Language = "zpl"
+	EPL  Language = "epl"
+	DPL  Language = "dpl"
+)
+
+// Renderer turns a Label into the command stream of one printer language.
+type Renderer interface {
+	// Calibrate returns the command that makes the printer measure the
+	// label gap itself, or nil if the language has none.
+	Calibrate() []byte
+	Render(l *Label) ([]byte, error)
+}
+
+func ParseLanguage(s string) (Language, error) {
+	lang := Language(strings.ToLower(strings.TrimSpace(s)))
+	switch lang {
+	case TSPL, ZPL, EPL, DPL:
+		return lang, nil
+	}
+	return "", fmt.Errorf("unsupported label language %q", s)
+}
+
+func NewRenderer(lang Language) (Renderer, error) {
+	switch lang {
+	case TSPL:
+		return tsplRenderer{}, nil
+	case ZPL:
+		return zplRenderer{}, nil
+	case EPL:
+		return eplRenderer{}, nil
+	case DPL:
+		return dplRenderer{}, nil
+	}
+	return nil, fmt.Errorf("unsupported label language %q", lang)
+}
@@ -0,0 +1,119 @@
+package label
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+type tsplRenderer struct{}
+
+var tsplBarcodeTypes = map[Symbology]string{
+	Code128: "128",
+	Code39:  "39",
+	EAN13:   "EAN13",
+	EAN8:    "EAN8",
+	UPCA:    "UPCA",
+	ITF:     "25",
+}
+
+// Bitmap fonts built into every TSPL printer, indexed by font name.
+var tsplFonts = []struct {
+	name          string
+	width, height int
+}{
+	{"1", 8, 12},
+	{"2", 12, 20},
+	{"3", 16, 24},
+	{"4", 24, 32},
+	{"5", 32, 48},
+}
+
+func (tsplRenderer) Calibrate() []byte {
+	return []byte("AUTODETECT\r\n")
+}
+
+func (tsplRenderer) Render(l *Label) ([]byte, error) {
+	var buf bytes.Buffer
+
+	fmt.Fprintf(&buf, "SIZE %d mm, %d mm\r\n", l.WidthMM, l.HeightMM)
+	if l.GapMM > 0 {
+		fmt.Fprintf(&buf, "GAP %d mm, %d mm\r\n", l.GapMM, l.GapOffsetMM)
+	}
+	fmt.Fprintf(&buf, "DIRECTION %d\r\n", l.Direction)
+	buf.WriteString("CLS\r\n")
+	buf.WriteString("SET PRINTER DT\r\n")
+
+	for _, el := range l.Elements {
+		switch el := el.(type) {
+		case Text:
+			fmt.Fprintf(&buf, "TEXT %d,%d,\"%s\",0,1,1,\"%s\"\r\n",
+				el.X, el.Y, tsplFont(el.Height), tsplQuote(el.Content))
+		case Barcode:
+			kind, ok := tsplBarcodeTypes[el.Symbology]
+			if !ok {
+				return nil, fmt.Errorf("tspl: unsupported barcode symbology %q", el.Symbology)
+			}
+			fmt.Fprintf(&buf, "BARCODE %d,%d,\"%s\",%d,%d,0,%d,%d,\"%s\"\r\n",
+				el.X, el.Y, kind, el.Height, boolInt(el.HumanReadable),
+				el.Narrow, el.Wide, tsplQuote(el.Data))
+		case QRCode:
+			fmt.Fprintf(&buf, "QRCODE %d,%d,%c,%d,A,0,\"%s\"\r\n",
+				el.X, el.Y, qrECC(el.ECC), el.CellWidth, tsplQuote(el.Data))
+		case Box:
+			fmt.Fprintf(&buf, "BOX %d,%d,%d,%d,%d\r\n",
+				el.X, el.Y, el.X+el.Width, el.Y+el.Height, el.Thickness)
+		case Image:
+			data, bytesPerRow, height := monochrome(el.Image, el.Threshold)
+			// TSPL prints the cleared bits of a bitmap, so invert our mask.
+			for i := range data {
+				data[i] = ^data[i]
+			}
+			fmt.Fprintf(&buf, "BITMAP %d,%d,%d,%d,0,", el.X, el.Y, bytesPerRow, height)
+			buf.Write(data)
+			buf.WriteString("\r\n")
+		default:
+			return nil, fmt.Errorf("tspl: unsupported element %T", el)
+		}
+	}
+
+	fmt.Fprintf(&buf, "PRINT %d,1\r\n", l.copies())
+	if l.Cut {
+		buf.WriteString("CUT\r\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// tsplFont picks the largest built-in font that is not taller than height.
+func tsplFont(height int) string {
+	return tsplFonts[tsplFontIndex(height)].name
+}
+
+func tsplFontIndex(height int) int {
+	idx := 0
+	for i, f := range tsplFonts {
+		if f.height <= height {
+			idx = i
+		}
+	}
+	return idx
+}
+
+func tsplQuote(s string) string {
+	return strings.ReplaceAll(s, `"`, `\["]`)
+}
+
+func qrECC(ecc byte) byte {
+	switch ecc {
+	case 'L', 'M', 'Q', 'H':
+		return ecc
+	}
+	return 'M'
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,110 @@
+package label
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+type zplRenderer struct{}
+
+func (zplRenderer) Calibrate() []byte {
+	return []byte("~JC")
+}
+
+func (zplRenderer) Render(l *Label) ([]byte, error) {
+	var buf bytes.Buffer
+
+	buf.WriteString("^XA\n")
+	fmt.Fprintf(&buf, "^PW%d\n", l.WidthDots())
+	fmt.Fprintf(&buf, "^LL%d\n", l.HeightDots())
+	buf.WriteString("^LH0,0\n")
+	// ZPL senses the gap of non-continuous media on its own, there is no
+	// equivalent of the TSPL GAP length.
+	buf.WriteString("^MNY\n")
+	buf.WriteString("^MTD\n")
+	if l.Direction == 1 {
+		buf.WriteString("^POI\n")
+	} else {
+		buf.WriteString("^PON\n")
+	}
+	if l.Cut {
+		buf.WriteString("^MMC\n")
+	}
+
+	for _, el := range l.Elements {
+		switch el := el.(type) {
+		case Text:
+			fmt.Fprintf(&buf, "^FO%d,%d^A0N,%d,%d%s\n",
+				el.X, el.Y, el.Height, el.Height*3/5, zplField(el.Content))
+		case Barcode:
+			cmd, err := zplBarcode(el)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Fprintf(&buf, "^FO%d,%d^BY%d,%s,%d%s%s\n",
+				el.X, el.Y, el.Narrow, zplRatio(el), el.Height, cmd, zplField(el.Data))
+		case QRCode:
+			fmt.Fprintf(&buf, "^FO%d,%d^BQN,2,%d%s\n",
+				el.X, el.Y, el.CellWidth, zplField(string(qrECC(el.ECC))+"A,"+el.Data))
+		case Box:
+			fmt.Fprintf(&buf, "^FO%d,%d^GB%d,%d,%d^FS\n",
+				el.X, el.Y, el.Width, el.Height, el.Thickness)
+		case Image:
+			data, bytesPerRow, _ := monochrome(el.Image, el.Threshold)
+			fmt.Fprintf(&buf, "^FO%d,%d^GFA,%d,%d,%d,%s^FS\n",
+				el.X, el.Y, len(data), len(data), bytesPerRow,
+				strings.ToUpper(hex.EncodeToString(data)))
+		default:
+			return nil, fmt.Errorf("zpl: unsupported element %T", el)
+		}
+	}
+
+	fmt.Fprintf(&buf, "^PQ%d\n", l.copies())
+	buf.WriteString("^XZ\n")
+	return buf.Bytes(), nil
+}
+
+func zplBarcode(b Barcode) (string, error) {
+	hr := "N"
+	if b.HumanReadable {
+		hr = "Y"
+	}
+	switch b.Symbology {
+	case Code128:
+		return fmt.Sprintf("^BCN,%d,%s,N,N", b.Height, hr), nil
+	case Code39:
+		return fmt.Sprintf("^B3N,N,%d,%s,N", b.Height, hr), nil
+	case EAN13:
+		return fmt.Sprintf("^BEN,%d,%s,N", b.Height, hr), nil
+	case EAN8:
+		return fmt.Sprintf("^B8N,%d,%s,N", b.Height, hr), nil
+	case UPCA:
+		return fmt.Sprintf("^BUN,%d,%s,N,Y", b.Height, hr), nil
+	case ITF:
+		return fmt.Sprintf("^B2N,%d,%s,N,N", b.Height, hr), nil
+	}
+	return "", fmt.Errorf("zpl: unsupported barcode symbology %q", b.Symbology)
+}
+
+// zplRatio converts the wide bar width into the ^BY wide to narrow ratio,
+// which ZPL only accepts between 2.0 and 3.0.
+func zplRatio(b Barcode) string {
+	ratio := 3.0
+	if b.Narrow > 0 && b.Wide > 0 {
+		ratio = float64(b.Wide) / float64(b.Narrow)
+	}
+	ratio = min(max(ratio, 2.0), 3.0)
+	return fmt.Sprintf("%.1f", ratio)
+}
+
+// zplField wraps s in ^FD...^FS, hex-escaping the characters that would
+// otherwise be read as ZPL command prefixes.
+func zplField(s string) string {
+	if !strings.ContainsAny(s, `^~\`) {
+		return "^FD" + s + "^FS"
+	}
+	r := strings.NewReplacer(`\`, `\5C`, `^`, `\5E`, `~`, `\7E`)
+	return `^FH\^FD` + r.Replace(s) + "^FS"
+}
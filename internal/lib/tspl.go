@@ -2,7 +2,7 @@ package lib
 
 import (
 	"fmt"
-	"log"
+	"log/slog"
 	"strconv"
 	"time"
 
@@ -61,7 +61,7 @@ func PrintBarcodeLabel(
 	if gapLength == 0 {
 		autodetectCmd := "AUTODETECT\r\n"
 		if _, err := ep.Write([]byte(autodetectCmd)); err != nil {
-			log.Printf("AUTODETECT failed to send: %v — falling back to default 2mm", err)
+			slog.Warn("AUTODETECT failed to send, falling back to a 2mm gap", "error", err)
 			gapLength = 2
 			gapOffset = 0
 		} else {
@@ -0,0 +1,437 @@
+// Package localca is a certificate authority private to one print server.
+// It creates a root certificate on first use and issues the server a
+// certificate for localhost and the machine's addresses, renewing it
+// before it expires. Browsers trust the server once the root is installed.
+//
+// The root is limited to the machine's names, loopback and the private
+// address ranges, so it stays the same when the machine's addresses
+// change; only the server certificate is reissued.
+package localca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	rootValidity   = 10 * 365 * 24 * time.Hour
+	serverValidity = 90 * 24 * time.Hour
+	// Certificates are renewed once they are this close to expiring.
+	rootRenewBefore   = 30 * 24 * time.Hour
+	serverRenewBefore = 30 * 24 * time.Hour
+	// checkInterval bounds how often handshakes check for renewal.
+	checkInterval = time.Hour
+)
+
+// rootRanges are the address ranges every root permits besides the
+// configured addresses: loopback and the private and unique local ranges a
+// print server's addresses come from.
+var rootRanges = []*net.IPNet{
+	cidr("127.0.0.0/8"), cidr("10.0.0.0/8"), cidr("172.16.0.0/12"), cidr("192.168.0.0/16"),
+	cidr("::1/128"), cidr("fc00::/7"),
+}
+
+// interfaceAddrs lists the machine's addresses; tests replace it.
+var interfaceAddrs = net.InterfaceAddrs
+
+// File names in the CA directory.
+const (
+	RootCertFile   = "root.pem"
+	rootKeyFile    = "root.key"
+	serverCertFile = "server.pem"
+	serverKeyFile  = "server.key"
+)
+
+// CA holds the root and the server certificate it issued.
+type CA struct {
+	dir   string
+	hosts []string // extra DNS names and IPs for the server certificate
+
+	mu        sync.Mutex
+	checkedAt time.Time
+	root      *x509.Certificate
+	rootKey   *ecdsa.PrivateKey
+	cert      *tls.Certificate
+	leaf      *x509.Certificate
+}
+
+// Open loads the CA from dir, creating the root and the server certificate
+// if they do not exist, and renewing them if they are due.
+func Open(dir string, hosts []string) (*CA, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create CA directory: %w", err)
+	}
+	ca := &CA{dir: dir, hosts: hosts}
+
+	root, rootKey, err := loadPair(filepath.Join(dir, RootCertFile), filepath.Join(dir, rootKeyFile))
+	if err == nil {
+		ca.root, ca.rootKey = root, rootKey
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to load CA root: %w", err)
+	}
+
+	leaf, leafKey, err := loadPair(filepath.Join(dir, serverCertFile), filepath.Join(dir, serverKeyFile))
+	if err == nil {
+		ca.setServerCert(leaf, leafKey)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		slog.Warn("Reissuing the server certificate, the current one cannot be loaded", "error", err)
+	}
+
+	if err := ca.renew(time.Now()); err != nil {
+		return nil, err
+	}
+	return ca, nil
+}
+
+// GetCertificate returns the server certificate for tls.Config, renewing
+// it first if it is due.
+func (ca *CA) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(ca.checkedAt) >= checkInterval {
+		ca.checkedAt = now
+		if err := ca.renew(now); err != nil {
+			// The current certificate is still served until it expires.
+			slog.Error("Failed to renew the server certificate", "error", err)
+		}
+	}
+	return ca.cert, nil
+}
+
+// RootPEM returns the root certificate, for installing into browsers and
+// operating systems.
+func (ca *CA) RootPEM() []byte {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.root.Raw})
+}
+
+// Root returns the root certificate.
+func (ca *CA) Root() *x509.Certificate {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return ca.root
+}
+
+// Server returns the server certificate currently served.
+func (ca *CA) Server() *x509.Certificate {
+	ca.mu.Lock()
+	defer ca.mu.Unlock()
+	return ca.leaf
+}
+
+// renew replaces the root and the server certificate if they are due. The
+// caller holds mu, or ca is not shared yet.
+func (ca *CA) renew(now time.Time) error {
+	rootDNSNames, rootIPs := ca.rootNames()
+	if reason := ca.rootDue(now, rootDNSNames, rootIPs); reason != "" {
+		if ca.root != nil {
+			slog.Warn("Creating a new local CA root; install it again on every client", "reason", reason, "expires", ca.root.NotAfter.Format(time.DateOnly))
+		}
+		if err := ca.createRoot(now, rootDNSNames, rootIPs); err != nil {
+			return err
+		}
+		ca.leaf = nil
+	}
+
+	dnsNames, ips := ca.serverNames()
+	if ca.leaf != nil && !now.Add(serverRenewBefore).After(ca.leaf.NotAfter) &&
+		ca.leaf.CheckSignatureFrom(ca.root) == nil && covers(ca.leaf, dnsNames, ips) {
+		return nil
+	}
+	return ca.issueServerCert(now, dnsNames, ips)
+}
+
+// rootDue returns why the root must be replaced, or "" if it need not be.
+// Its name constraints limit it to this machine's names and private
+// addresses, so a leaked root.key cannot impersonate other sites to
+// clients that trust it. Only a new host name or configured host needs a
+// new root; addresses the machine gets later are covered by the ranges or
+// left out of the server certificate.
+func (ca *CA) rootDue(now time.Time, dnsNames []string, ips []*net.IPNet) string {
+	switch {
+	case ca.root == nil:
+		return "no root"
+	case now.Add(rootRenewBefore).After(ca.root.NotAfter):
+		return "the root is expiring"
+	case !ca.root.PermittedDNSDomainsCritical || len(ca.root.PermittedDNSDomains) == 0:
+		return "the root is not limited to this machine's names"
+	case !permitsRanges(ca.root, dnsNames, ips):
+		return "the host name or configured hosts changed"
+	}
+	return ""
+}
+
+func (ca *CA) createRoot(now time.Time, dnsNames []string, ips []*net.IPNet) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	host, _ := os.Hostname()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber(),
+		Subject:               pkix.Name{CommonName: "POS Printer Local CA " + host, Organization: []string{"POS Printer"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(rootValidity),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageCRLSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		MaxPathLenZero:        true,
+
+		PermittedDNSDomainsCritical: true,
+		PermittedDNSDomains:         dnsNames,
+		PermittedIPRanges:           ips,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	root, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+	if err := writePair(filepath.Join(ca.dir, RootCertFile), filepath.Join(ca.dir, rootKeyFile), der, key); err != nil {
+		return fmt.Errorf("failed to save CA root: %w", err)
+	}
+	ca.root, ca.rootKey = root, key
+	slog.Info("Created local CA root, install it on clients to trust this server", "path", filepath.Join(ca.dir, RootCertFile))
+	return nil
+}
+
+func (ca *CA) issueServerCert(now time.Time, dnsNames []string, ips []net.IP) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	template := &x509.Certificate{
+		SerialNumber: serialNumber(),
+		Subject:      pkix.Name{CommonName: "localhost", Organization: []string{"POS Printer"}},
+		DNSNames:     dnsNames,
+		IPAddresses:  ips,
+		NotBefore:    now.Add(-time.Hour),
+		NotAfter:     now.Add(serverValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.root, &key.PublicKey, ca.rootKey)
+	if err != nil {
+		return err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+	if err := writePair(filepath.Join(ca.dir, serverCertFile), filepath.Join(ca.dir, serverKeyFile), der, key); err != nil {
+		return fmt.Errorf("failed to save server certificate: %w", err)
+	}
+	ca.setServerCert(leaf, key)
+	slog.Info("Issued server certificate", "dns_names", dnsNames, "ips", ips, "expires", leaf.NotAfter.Format(time.DateOnly))
+	return nil
+}
+
+func (ca *CA) setServerCert(leaf *x509.Certificate, key *ecdsa.PrivateKey) {
+	ca.leaf = leaf
+	ca.cert = &tls.Certificate{Certificate: [][]byte{leaf.Raw}, PrivateKey: key, Leaf: leaf}
+}
+
+// rootNames lists what the root permits: localhost, the host name and the
+// configured names, and loopback, the private ranges and the configured
+// addresses.
+func (ca *CA) rootNames() ([]string, []*net.IPNet) {
+	dnsNames, ips := ca.configuredNames()
+	return dnsNames, append(slices.Clone(rootRanges), hostRanges(ips)...)
+}
+
+// serverNames lists the names the server certificate covers: those of
+// configuredNames and every address of the machine the root permits, except
+// link-local ones. Addresses the root does not permit are left out.
+func (ca *CA) serverNames() ([]string, []net.IP) {
+	dnsNames, ips := ca.configuredNames()
+	if addrs, err := interfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok || ipNet.IP.IsLinkLocalUnicast() {
+				continue
+			}
+			ip := ipNet.IP
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			if !slices.ContainsFunc(ips, ip.Equal) && (ca.root == nil || permits(ca.root, nil, []net.IP{ip})) {
+				ips = append(ips, ip)
+			}
+		}
+	}
+	return dnsNames, ips
+}
+
+// configuredNames lists localhost, the host name and the configured hosts
+// with the loopback addresses.
+func (ca *CA) configuredNames() ([]string, []net.IP) {
+	dnsNames := []string{"localhost"}
+	ips := []net.IP{net.IPv4(127, 0, 0, 1).To4(), net.IPv6loopback}
+	add := func(name string) {
+		if ip := net.ParseIP(name); ip != nil {
+			if ip4 := ip.To4(); ip4 != nil {
+				ip = ip4
+			}
+			if !slices.ContainsFunc(ips, ip.Equal) {
+				ips = append(ips, ip)
+			}
+		} else if name != "" && !slices.Contains(dnsNames, name) {
+			dnsNames = append(dnsNames, name)
+		}
+	}
+
+	if host, err := os.Hostname(); err == nil {
+		add(host)
+	}
+	for _, h := range ca.hosts {
+		add(h)
+	}
+	return dnsNames, ips
+}
+
+// covers reports whether cert is valid for every name, so a certificate
+// is reissued when the machine gets a new address.
+func covers(cert *x509.Certificate, dnsNames []string, ips []net.IP) bool {
+	for _, name := range dnsNames {
+		if !slices.Contains(cert.DNSNames, name) {
+			return false
+		}
+	}
+	for _, ip := range ips {
+		if !slices.ContainsFunc(cert.IPAddresses, ip.Equal) {
+			return false
+		}
+	}
+	return true
+}
+
+// permits reports whether root's name constraints allow a certificate
+// for every name.
+func permits(root *x509.Certificate, dnsNames []string, ips []net.IP) bool {
+	for _, name := range dnsNames {
+		if !slices.ContainsFunc(root.PermittedDNSDomains, func(domain string) bool {
+			return strings.EqualFold(name, domain) || strings.HasSuffix(strings.ToLower(name), "."+strings.ToLower(domain))
+		}) {
+			return false
+		}
+	}
+	for _, ip := range ips {
+		if !slices.ContainsFunc(root.PermittedIPRanges, func(r *net.IPNet) bool { return r.Contains(ip) }) {
+			return false
+		}
+	}
+	return true
+}
+
+// permitsRanges reports whether root's name constraints allow every name
+// and every address of the ranges.
+func permitsRanges(root *x509.Certificate, dnsNames []string, ranges []*net.IPNet) bool {
+	if !permits(root, dnsNames, nil) {
+		return false
+	}
+	for _, want := range ranges {
+		wantOnes, _ := want.Mask.Size()
+		if !slices.ContainsFunc(root.PermittedIPRanges, func(r *net.IPNet) bool {
+			ones, bits := r.Mask.Size()
+			return r.Contains(want.IP) && ones <= wantOnes && bits == len(want.IP)*8
+		}) {
+			return false
+		}
+	}
+	return true
+}
+
+// hostRanges returns a range per address that holds only that address.
+func hostRanges(ips []net.IP) []*net.IPNet {
+	ranges := make([]*net.IPNet, len(ips))
+	for i, ip := range ips {
+		ranges[i] = &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)}
+	}
+	return ranges
+}
+
+func cidr(s string) *net.IPNet {
+	_, ipNet, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return ipNet
+}
+
+func serialNumber() *big.Int {
+	n, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+func loadPair(certPath, keyPath string) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	certPEM, err := os.ReadFile(certPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPEM, err := os.ReadFile(keyPath)
+	if err != nil {
+		return nil, nil, err
+	}
+	certBlock, _ := pem.Decode(certPEM)
+	keyBlock, _ := pem.Decode(keyPEM)
+	if certBlock == nil || keyBlock == nil {
+		return nil, nil, fmt.Errorf("no PEM data in %s or %s", certPath, keyPath)
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	key, err := x509.ParseECPrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, err
+	}
+	if pub, ok := cert.PublicKey.(*ecdsa.PublicKey); !ok || !pub.Equal(&key.PublicKey) {
+		return nil, nil, fmt.Errorf("%s does not match %s", keyPath, certPath)
+	}
+	return cert, key, nil
+}
+
+// writePair saves a certificate and its key, replacing each file in one
+// rename so a crash never leaves half a file.
+func writePair(certPath, keyPath string, der []byte, key *ecdsa.PrivateKey) error {
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return err
+	}
+	return writeFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644)
+}
+
+func writeFile(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,169 @@
+package localca
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestRootIsNameConstrained(t *testing.T) {
+	ca, err := Open(t.TempDir(), []string{"pos.example.com", "192.0.2.10"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := ca.Root()
+	if !root.PermittedDNSDomainsCritical {
+		t.Error("name constraints are not critical")
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(root)
+	verify := func(cert *x509.Certificate, name string) error {
+		_, err := cert.Verify(x509.VerifyOptions{Roots: roots, DNSName: name})
+		return err
+	}
+
+	// The server certificate verifies for every name it covers.
+	leaf := ca.Server()
+	for _, name := range []string{"localhost", "pos.example.com", "192.0.2.10", "127.0.0.1"} {
+		if err := verify(leaf, name); err != nil {
+			t.Errorf("server certificate for %s: %v", name, err)
+		}
+	}
+
+	// A certificate the root's key signs for another site is refused.
+	for _, name := range []string{"bank.example.com", "203.0.113.5"} {
+		if err := verify(issue(t, ca, name), name); err == nil {
+			t.Errorf("certificate for %s verified, want it refused by the name constraints", name)
+		}
+	}
+}
+
+func TestUnconstrainedRootIsReplaced(t *testing.T) {
+	dir := t.TempDir()
+	ca, err := Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Overwrite the root with one created before roots were constrained.
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serialNumber(),
+		Subject:               pkix.Name{CommonName: "old root"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(rootValidity),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &ca.rootKey.PublicKey, ca.rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := writePair(filepath.Join(dir, RootCertFile), filepath.Join(dir, rootKeyFile), der, ca.rootKey); err != nil {
+		t.Fatal(err)
+	}
+
+	ca, err = Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if root := ca.Root(); root.Subject.CommonName == "old root" || !root.PermittedDNSDomainsCritical {
+		t.Errorf("root %q was kept, want a new constrained root", root.Subject.CommonName)
+	}
+	if err := ca.Server().CheckSignatureFrom(ca.Root()); err != nil {
+		t.Errorf("server certificate is not issued by the new root: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, serverCertFile)); err != nil {
+		t.Error(err)
+	}
+}
+
+// issue signs a certificate for name with the CA's root key, as someone
+// holding a leaked root.key could.
+func issue(t *testing.T, ca *CA, name string) *x509.Certificate {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: serialNumber(),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	if ip := net.ParseIP(name); ip != nil {
+		template.IPAddresses = []net.IP{ip}
+	} else {
+		template.DNSNames = []string{name}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Root(), &key.PublicKey, ca.rootKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func TestAddressChangeKeepsRoot(t *testing.T) {
+	addrs := []net.Addr{&net.IPNet{IP: net.ParseIP("192.168.1.10"), Mask: net.CIDRMask(24, 32)}}
+	old := interfaceAddrs
+	interfaceAddrs = func() ([]net.Addr, error) { return addrs, nil }
+	defer func() { interfaceAddrs = old }()
+
+	dir := t.TempDir()
+	ca, err := Open(dir, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := ca.Root()
+	if !slices.ContainsFunc(ca.Server().IPAddresses, net.ParseIP("192.168.1.10").Equal) {
+		t.Fatalf("server certificate %v does not cover 192.168.1.10", ca.Server().IPAddresses)
+	}
+
+	// A new DHCP lease, a ULA address and a public VPN address.
+	addrs = []net.Addr{
+		&net.IPNet{IP: net.ParseIP("192.168.1.20"), Mask: net.CIDRMask(24, 32)},
+		&net.IPNet{IP: net.ParseIP("fd00::20"), Mask: net.CIDRMask(64, 128)},
+		&net.IPNet{IP: net.ParseIP("203.0.113.9"), Mask: net.CIDRMask(24, 32)},
+	}
+	for _, reopen := range []bool{false, true} {
+		if reopen {
+			ca, err = Open(dir, nil)
+		} else {
+			err = ca.renew(time.Now())
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !ca.Root().Equal(root) {
+			t.Fatalf("root replaced after an address change (reopen %v)", reopen)
+		}
+		leaf := ca.Server()
+		for _, ip := range []string{"192.168.1.20", "fd00::20"} {
+			if !slices.ContainsFunc(leaf.IPAddresses, net.ParseIP(ip).Equal) {
+				t.Errorf("server certificate %v does not cover %s", leaf.IPAddresses, ip)
+			}
+		}
+		if slices.ContainsFunc(leaf.IPAddresses, net.ParseIP("203.0.113.9").Equal) {
+			t.Errorf("server certificate covers 203.0.113.9, which the root does not permit")
+		}
+		if err := leaf.CheckSignatureFrom(root); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+// Package logging sets up the service log: log/slog with a configurable
+// level and format, written to stderr and optionally to a rotated file.
+// Log lines about a print job carry the ID of the request that created
+// it, so a request can be followed from the API into the workers.
+package logging
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"pos-printer/internal/config"
+	"time"
+)
+
+// Setup makes the configured logger the default for slog and for the log
+// package. The returned function closes the log file, if there is one.
+func Setup(cfg config.LogConfig) (func() error, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(cfg.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q, must be debug, info, warn or error", cfg.Level)
+	}
+	if cfg.Format != config.LogFormatText && cfg.Format != config.LogFormatJSON {
+		return nil, fmt.Errorf("invalid log format %q, must be text or json", cfg.Format)
+	}
+
+	var w io.Writer = os.Stderr
+	closeFile := func() error { return nil }
+	if cfg.File != "" {
+		f, err := openRotatingFile(cfg.File, int64(cfg.MaxSizeMB)<<20, cfg.MaxBackups, time.Duration(cfg.MaxAgeDays)*24*time.Hour)
+		if err != nil {
+			return nil, err
+		}
+		w, closeFile = io.MultiWriter(os.Stderr, f), f.Close
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler = slog.NewTextHandler(w, opts)
+	if cfg.Format == config.LogFormatJSON {
+		handler = slog.NewJSONHandler(w, opts)
+	}
+
+	slog.SetDefault(slog.New(handler))
+	return closeFile, nil
+}
+
+// NewRequestID returns a random ID for a request that did not bring one,
+// or for work the service starts on its own.
+func NewRequestID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,115 @@
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rotatingFile is a log file that is renamed to path.1 once it reaches
+// maxSize, shifting older files up to path.<backups> and deleting the one
+// beyond. A maxSize of 0 never rotates. With maxAge, rotated files last
+// written longer ago are deleted on opening and on every rotation.
+type rotatingFile struct {
+	path    string
+	maxSize int64
+	backups int
+	maxAge  time.Duration
+
+	mu   sync.Mutex
+	f    *os.File // nil after a failed rotation, reopened on the next write
+	size int64
+}
+
+func openRotatingFile(path string, maxSize int64, backups int, maxAge time.Duration) (*rotatingFile, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, err
+	}
+	r := &rotatingFile{path: path, maxSize: maxSize, backups: backups, maxAge: maxAge}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	r.removeExpired()
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+// Write appends p, rotating first if p would take the file past maxSize.
+// A single line is never split across files.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f != nil && r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		r.rotate()
+	}
+	if r.f == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate closes the file and shifts it into the backups. Errors are
+// ignored: at worst a backup is lost, and the log carries on in a new
+// file.
+func (r *rotatingFile) rotate() {
+	r.f.Close()
+	r.f = nil
+	if r.backups == 0 {
+		os.Remove(r.path)
+		return
+	}
+	os.Remove(r.backup(r.backups))
+	for i := r.backups - 1; i >= 1; i-- {
+		os.Rename(r.backup(i), r.backup(i+1))
+	}
+	os.Rename(r.path, r.backup(1))
+	r.removeExpired()
+}
+
+// removeExpired deletes the rotated files older than maxAge.
+func (r *rotatingFile) removeExpired() {
+	if r.maxAge <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-r.maxAge)
+	for i := 1; i <= r.backups; i++ {
+		if info, err := os.Stat(r.backup(i)); err == nil && info.ModTime().Before(cutoff) {
+			os.Remove(r.backup(i))
+		}
+	}
+}
+
+func (r *rotatingFile) backup(n int) string {
+	return r.path + "." + strconv.Itoa(n)
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
@@ -0,0 +1,197 @@
+package logging
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"pos-printer/internal/config"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readLog returns the contents of path, or "" if it does not exist.
+func readLog(t *testing.T, path string) string {
+	t.Helper()
+	b, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func writeLines(t *testing.T, r *rotatingFile, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if _, err := r.Write([]byte(line + "\n")); err != nil {
+			t.Fatalf("Write(%q): %v", line, err)
+		}
+	}
+}
+
+func TestRotatingFileSize(t *testing.T) {
+	tests := []struct {
+		name    string
+		maxSize int64
+		backups int
+		lines   []string // each 4 bytes with its newline
+		want    []string // contents of path, path.1, path.2, ...
+	}{
+		{
+			name: "below the limit", maxSize: 12, backups: 2,
+			lines: []string{"aaa", "bbb", "ccc"},
+			want:  []string{"aaa\nbbb\nccc\n", ""},
+		},
+		{
+			name: "rotates before a line would pass the limit", maxSize: 12, backups: 2,
+			lines: []string{"aaa", "bbb", "ccc", "ddd"},
+			want:  []string{"ddd\n", "aaa\nbbb\nccc\n", ""},
+		},
+		{
+			name: "shifts older files up", maxSize: 4, backups: 2,
+			lines: []string{"aaa", "bbb", "ccc"},
+			want:  []string{"ccc\n", "bbb\n", "aaa\n"},
+		},
+		{
+			name: "deletes the file beyond the backups", maxSize: 4, backups: 2,
+			lines: []string{"aaa", "bbb", "ccc", "ddd"},
+			want:  []string{"ddd\n", "ccc\n", "bbb\n", ""},
+		},
+		{
+			name: "no backups", maxSize: 4, backups: 0,
+			lines: []string{"aaa", "bbb"},
+			want:  []string{"bbb\n", ""},
+		},
+		{
+			name: "a line longer than the limit is not split", maxSize: 4, backups: 1,
+			lines: []string{"aaaaaaa", "b"},
+			want:  []string{"b\n", "aaaaaaa\n"},
+		},
+		{
+			name: "no limit", maxSize: 0, backups: 1,
+			lines: []string{"aaa", "bbb", "ccc"},
+			want:  []string{"aaa\nbbb\nccc\n", ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "logs", "pos-printer.log")
+			r, err := openRotatingFile(path, tt.maxSize, tt.backups, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer r.Close()
+			writeLines(t, r, tt.lines...)
+
+			for i, want := range tt.want {
+				name := path
+				if i > 0 {
+					name = r.backup(i)
+				}
+				if got := readLog(t, name); got != want {
+					t.Errorf("%s = %q, want %q", filepath.Base(name), got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestRotatingFileAge(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pos-printer.log")
+	old := time.Now().Add(-3 * 24 * time.Hour)
+	for i, age := range []time.Time{time.Now(), old} {
+		name := path + "." + strconv.Itoa(i+1)
+		if err := os.WriteFile(name, []byte("rotated\n"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(name, age, age); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Opening removes rotated files past the age limit.
+	r, err := openRotatingFile(path, 8, 3, 2*24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if readLog(t, r.backup(1)) == "" || readLog(t, r.backup(2)) != "" {
+		t.Fatalf("after opening, .1 = %q and .2 = %q; want only .2 deleted",
+			readLog(t, r.backup(1)), readLog(t, r.backup(2)))
+	}
+
+	// So does rotating: .1 ages past the limit and is shifted to .2, then
+	// deleted.
+	if err := os.Chtimes(r.backup(1), old, old); err != nil {
+		t.Fatal(err)
+	}
+	writeLines(t, r, "aaaaaaa", "bbbbbbb")
+	if got := readLog(t, r.backup(1)); got != "aaaaaaa\n" {
+		t.Errorf(".1 = %q, want the file just rotated", got)
+	}
+	if got := readLog(t, r.backup(2)); got != "" {
+		t.Errorf(".2 = %q, want the expired file deleted", got)
+	}
+}
+
+func TestRotatingFileReopen(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "logs")
+	path := filepath.Join(dir, "pos-printer.log")
+
+	// A restarted service appends to the file and counts what is already
+	// in it towards the limit.
+	r, err := openRotatingFile(path, 12, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLines(t, r, "aaa", "bbb")
+	r.Close()
+	r, err = openRotatingFile(path, 12, 1, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	writeLines(t, r, "ccc", "ddd")
+	if got, want := readLog(t, r.backup(1)), "aaa\nbbb\nccc\n"; got != want {
+		t.Errorf(".1 = %q, want %q", got, want)
+	}
+
+	// When the file cannot be reopened after a rotation, writes fail until
+	// it can, then carry on in a new file.
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Write([]byte(strings.Repeat("e", 11) + "\n")); err == nil {
+		t.Fatal("Write succeeded without a directory to write to")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	writeLines(t, r, "fff")
+	if got := readLog(t, path); got != "fff\n" {
+		t.Errorf("reopened file = %q, want %q", got, "fff\n")
+	}
+}
+
+func TestSetupWritesFile(t *testing.T) {
+	defer slog.SetDefault(slog.Default())
+	path := filepath.Join(t.TempDir(), "pos-printer.log")
+	closeLog, err := Setup(config.LogConfig{Level: "info", Format: config.LogFormatJSON, File: path, MaxSizeMB: 1, MaxBackups: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	slog.Debug("Below the level")
+	slog.Info("Written to the file", "job_id", 7)
+	if err := closeLog(); err != nil {
+		t.Fatal(err)
+	}
+	got := readLog(t, path)
+	if !strings.Contains(got, `"msg":"Written to the file"`) || !strings.Contains(got, `"job_id":7`) {
+		t.Errorf("log file = %q, want the JSON line", got)
+	}
+	if strings.Contains(got, "Below the level") {
+		t.Errorf("log file = %q, want no debug line", got)
+	}
+}
@@ -0,0 +1,81 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"slices"
+	"time"
+)
+
+// API key scopes. A key may hold several.
+const (
+	ScopePrint    = "print"     // enqueue and resolve jobs, manage schedules, previews
+	ScopeReadJobs = "read-jobs" // read jobs and schedules
+	ScopeAdmin    = "admin"     // everything, including keys and backups
+)
+
+// Scopes lists every scope a key can be given.
+var Scopes = []string{ScopePrint, ScopeReadJobs, ScopeAdmin}
+
+// APIKeyPrefix starts every API key, so leaked keys are easy to spot.
+const APIKeyPrefix = "pp_"
+
+// APIKey is a client credential. Only a hash of the key is stored; Prefix
+// keeps enough of it to tell keys apart in listings.
+type APIKey struct {
+	ID              int64      `json:"id"`
+	Name            string     `json:"name"`
+	Prefix          string     `json:"prefix"`
+	Scopes          []string   `json:"scopes"`
+	Printers        []string   `json:"printers"`                  // printer keys the key may use, empty for all
+	Origins         []string   `json:"origins"`                   // browser origins the key may be used from, empty for all
+	ClientCertCN    string     `json:"clientCertCN,omitempty"`    // mutual TLS clients with this certificate authenticate as the key
+	DailyLabelQuota *int       `json:"dailyLabelQuota,omitempty"` // labels the key may enqueue per day, nil for the default, 0 for unlimited
+	CreatedAt       time.Time  `json:"createdAt"`
+	LastUsedAt      *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt       *time.Time `json:"revokedAt,omitempty"`
+}
+
+// HasScope reports whether the key grants scope. Admin grants every scope.
+func (k *APIKey) HasScope(scope string) bool {
+	return slices.Contains(k.Scopes, ScopeAdmin) || slices.Contains(k.Scopes, scope)
+}
+
+// AllowsPrinter reports whether the key may use the printer with the
+// given printer key.
+func (k *APIKey) AllowsPrinter(printerKey string) bool {
+	return len(k.Printers) == 0 || slices.Contains(k.Printers, printerKey)
+}
+
+type APIKeyRequest struct {
+	Name            string   `json:"name"`
+	Scopes          []string `json:"scopes"`
+	Printers        []string `json:"printers"` // "vid:pid", empty for all
+	Origins         []string `json:"origins"`  // e.g. "https://pos.example.com", empty for all
+	ClientCertCN    string   `json:"clientCertCN"`
+	DailyLabelQuota *int     `json:"dailyLabelQuota"` // omitted for the default, 0 for unlimited
+}
+
+// NewAPIKey generates a random API key.
+func NewAPIKey() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return APIKeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// APIKeyDisplayPrefix returns the start of a key that is stored in the
+// clear to identify it.
+func APIKeyDisplayPrefix(key string) string {
+	return key[:min(len(key), len(APIKeyPrefix)+6)]
+}
+
+// HashAPIKey returns the stored form of a key. Keys are random, so a fast
+// hash is enough; there is nothing to guess from it.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
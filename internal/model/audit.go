@@ -0,0 +1,86 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Audited actions.
+const (
+	AuditJobEnqueue     = "job.enqueue"
+	AuditJobResolve     = "job.resolve" // an operator reprinted or closed a job of unknown outcome
+	AuditJobCancel      = "job.cancel"
+	AuditJobRetry       = "job.retry" // an operator queued a failed job again
+	AuditJobPrint       = "job.print"
+	AuditJobFail        = "job.fail" // the job failed its last attempt
+	AuditJobRecover     = "job.recover"
+	AuditScheduleCreate = "schedule.create"
+	AuditScheduleUpdate = "schedule.update"
+	AuditScheduleDelete = "schedule.delete"
+	AuditScheduleFire   = "schedule.fire"
+	AuditScheduleSkip   = "schedule.skip" // a due run enqueued nothing, see the entry's reason
+	AuditAPIKeyCreate   = "apikey.create"
+	AuditAPIKeyRevoke   = "apikey.revoke"
+	AuditBackupCreate   = "backup.create"
+	AuditBackupRestore  = "backup.restore"
+	AuditSchemaMigrate  = "schema.migrate" // a migration was applied
+	AuditSchemaRevert   = "schema.revert"  // a migration was reverted
+	AuditConfigChange   = "config.change"  // the service started with a different configuration
+)
+
+// Where audit entries come from.
+const (
+	AuditSourceAPI       = "api"
+	AuditSourceWorker    = "worker"
+	AuditSourceScheduler = "scheduler"
+	AuditSourceStartup   = "startup"
+	AuditSourceCLI       = "cli" // a pos-printer command, run by OSUser
+)
+
+// AuditEntry records who did what and when. Who is the API key, client IP
+// and user agent of a request, the OS user who ran a command, or for
+// entries the service makes on its own, only its source. Before and After
+// are snapshots of what changed.
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	At         time.Time       `json:"at"`
+	Source     string          `json:"source"`
+	Action     string          `json:"action"`
+	APIKeyID   *int64          `json:"apiKeyId,omitempty"`
+	APIKeyName string          `json:"apiKeyName,omitempty"`
+	IP         string          `json:"ip,omitempty"`
+	UserAgent  string          `json:"userAgent,omitempty"`
+	OSUser     string          `json:"osUser,omitempty"`
+	TargetType string          `json:"targetType,omitempty"` // job, schedule, apikey, backup, migration or config
+	TargetID   string          `json:"targetId,omitempty"`
+	PrinterKey string          `json:"printerKey,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+}
+
+// AuditFilter selects audit entries. Zero fields match everything.
+type AuditFilter struct {
+	Action     string
+	Source     string
+	APIKeyID   *int64
+	TargetType string
+	TargetID   string
+	PrinterKey string
+	From       *time.Time // inclusive
+	To         *time.Time // exclusive
+	BeforeID   int64      // entries older than this id, for paging
+	Limit      int
+}
+
+// AuditSnapshot encodes v for AuditEntry.Before or After. nil, and values
+// that cannot be encoded, give no snapshot.
+func AuditSnapshot(v any) json.RawMessage {
+	if v == nil {
+		return nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil
+	}
+	return b
+}
@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+// Backup is a snapshot of the job database in the backup directory.
+type Backup struct {
+	Name      string    `json:"name"`
+	Size      int64     `json:"size"`
+	CreatedAt time.Time `json:"createdAt"`
+	Path      string    `json:"-"`
+}
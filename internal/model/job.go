@@ -3,19 +3,42 @@ package model
 import "time"
 
 type BarcodeJob struct {
-	ID             int       `json:"id"`
-	VID            string    `json:"vid"`
-	PID            string    `json:"pid"`
-	SizeX          int       `json:"sizeX"`
-	SizeY          int       `json:"sizeY"`
-	Direction      int       `json:"direction"`
-	TopText        string    `json:"topText"`
-	BarcodeData    string    `json:"barcodeData"`
-	PrintCount     int       `json:"printCount"`
-	LabelGapLength int       `json:"labelGapLength"`
-	LabelGapOffset int       `json:"labelGapOffset"`
-	Status         string    `json:"status"`
-	Attempts       int       `json:"attempts"`
-	CreatedAt      time.Time `json:"createdAt"`
-	UpdatedAt      time.Time `json:"updatedAt"`
+	ID             int        `json:"id"`
+	VID            string     `json:"vid"`
+	PID            string     `json:"pid"`
+	SizeX          int        `json:"sizeX"`
+	SizeY          int        `json:"sizeY"`
+	Direction      int        `json:"direction"`
+	TopText        string     `json:"topText"`
+	BarcodeData    string     `json:"barcodeData"`
+	PrintCount     int        `json:"printCount"`
+	PrintedCount   int        `json:"printedCount"` // labels sent to the printer so far
+	Serial         *Serial    `json:"serial,omitempty"`
+	LabelGapLength int        `json:"labelGapLength"`
+	LabelGapOffset int        `json:"labelGapOffset"`
+	Priority       int        `json:"priority"`
+	Status         string     `json:"status"`
+	Attempts       int        `json:"attempts"`
+	CreatedAt      time.Time  `json:"createdAt"`
+	UpdatedAt      time.Time  `json:"updatedAt"`
+	NotBefore      *time.Time `json:"notBefore,omitempty"`
+	LeaseOwner     string     `json:"leaseOwner,omitempty"`
+	LeaseExpiresAt *time.Time `json:"leaseExpiresAt,omitempty"`
+	APIKeyID       *int64     `json:"apiKeyId,omitempty"`  // key that created the job
+	RequestID      string     `json:"requestId,omitempty"` // request that created the job, for matching log lines
+}
+
+// BarcodeSchedule enqueues a copy of Job every time Cron fires.
+type BarcodeSchedule struct {
+	ID        int                 `json:"id"`
+	Name      string              `json:"name"`
+	Cron      string              `json:"cron"`
+	Enabled   bool                `json:"enabled"`
+	Job       PrintBarcodeRequest `json:"job"`
+	NextRunAt *time.Time          `json:"nextRunAt,omitempty"`
+	LastRunAt *time.Time          `json:"lastRunAt,omitempty"`
+	LastJobID *int64              `json:"lastJobId,omitempty"`
+	APIKeyID  *int64              `json:"apiKeyId,omitempty"` // key that created the schedule, its jobs are attributed to it
+	CreatedAt time.Time           `json:"createdAt"`
+	UpdatedAt time.Time           `json:"updatedAt"`
 }
@@ -1,18 +1,36 @@
 package model
 
+import "time"
+
 type LabelGap struct {
 	Length int `json:"length"` // mm; 0 => auto-detect
 	Offset int `json:"offset"`
 }
 
 type PrintBarcodeRequest struct {
-	VID         string   `json:"vid"`
-	PID         string   `json:"pid"`
-	SizeX       int      `json:"sizeX"`
-	SizeY       int      `json:"sizeY"`
-	Direction   int      `json:"direction"`
-	TopText     string   `json:"topText"`
-	BarcodeData string   `json:"barcodeData"`
-	PrintCount  int      `json:"printCount"`
-	LabelGap    LabelGap `json:"labelGap"`
+	VID         string     `json:"vid"`
+	PID         string     `json:"pid"`
+	SizeX       int        `json:"sizeX"`
+	SizeY       int        `json:"sizeY"`
+	Direction   int        `json:"direction"`
+	TopText     string     `json:"topText"`
+	BarcodeData string     `json:"barcodeData"`
+	PrintCount  int        `json:"printCount"`
+	LabelGap    LabelGap   `json:"labelGap"`
+	Priority    int        `json:"priority"`            // higher prints first; default 0
+	NotBefore   *time.Time `json:"notBefore,omitempty"` // hold the job until this time
+	Serial      *Serial    `json:"serial,omitempty"`    // number each label, see SerialPlaceholder
+	APIKeyID    *int64     `json:"-"`                   // set from the authenticated key
+	RequestID   string     `json:"-"`                   // X-Request-ID of the request that enqueued the job
+}
+
+type ResolveJobRequest struct {
+	Status string `json:"status"` // pending (reprint), done or failed
+}
+
+type ScheduleRequest struct {
+	Name    string              `json:"name"`
+	Cron    string              `json:"cron"` // e.g. "30 6 * * 1-5"
+	Enabled *bool               `json:"enabled"`
+	Job     PrintBarcodeRequest `json:"job"`
 }
@@ -0,0 +1,80 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SerialPlaceholder is replaced in topText and barcodeData with the serial
+// number of each label.
+const SerialPlaceholder = "{serial}"
+
+// Check digit schemes for serial numbers.
+const (
+	CheckDigitLuhn = "luhn" // ISO/IEC 7812, as on asset tags
+	CheckDigitGS1  = "gs1"  // mod 10 with weights 3 and 1, as on EAN/UPC
+)
+
+// Serial numbers the labels of a job: label i gets Start + i*Step, zero
+// padded to Width digits, with an optional check digit, between Prefix and
+// Suffix.
+type Serial struct {
+	Start      int64  `json:"start"`
+	Step       int64  `json:"step"` // default 1
+	Width      int    `json:"width"`
+	Prefix     string `json:"prefix"`
+	Suffix     string `json:"suffix"`
+	CheckDigit string `json:"checkDigit"` // "", "luhn" or "gs1"
+}
+
+// Value returns the number of label i.
+func (s *Serial) Value(i int) int64 {
+	return s.Start + int64(i)*s.Step
+}
+
+// Format returns the serial number of label i.
+func (s *Serial) Format(i int) string {
+	digits := fmt.Sprintf("%0*d", s.Width, s.Value(i))
+	switch s.CheckDigit {
+	case CheckDigitLuhn:
+		digits += strconv.Itoa(luhnCheckDigit(digits))
+	case CheckDigitGS1:
+		digits += strconv.Itoa(gs1CheckDigit(digits))
+	}
+	return s.Prefix + digits + s.Suffix
+}
+
+// Expand replaces the serial placeholder in text with the serial number of
+// label i.
+func (s *Serial) Expand(text string, i int) string {
+	return strings.ReplaceAll(text, SerialPlaceholder, s.Format(i))
+}
+
+func luhnCheckDigit(digits string) int {
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		// Every second digit from the right, starting with the rightmost
+		// since the check digit is appended after it, is doubled.
+		if (len(digits)-1-i)%2 == 0 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return (10 - sum%10) % 10
+}
+
+func gs1CheckDigit(digits string) int {
+	sum := 0
+	for i := len(digits) - 1; i >= 0; i-- {
+		d := int(digits[i] - '0')
+		if (len(digits)-1-i)%2 == 0 {
+			d *= 3
+		}
+		sum += d
+	}
+	return (10 - sum%10) % 10
+}
@@ -0,0 +1,49 @@
+package model
+
+import "testing"
+
+func TestSerialFormat(t *testing.T) {
+	tests := []struct {
+		name   string
+		serial Serial
+		i      int
+		want   string
+	}{
+		{name: "first label", serial: Serial{Start: 101, Step: 1, Width: 6, Prefix: "ASSET-"}, want: "ASSET-000101"},
+		{name: "later label", serial: Serial{Start: 101, Step: 1, Width: 6, Prefix: "ASSET-"}, i: 99, want: "ASSET-000200"},
+		{name: "step", serial: Serial{Start: 10, Step: 5, Width: 3}, i: 2, want: "020"},
+		{name: "counting down", serial: Serial{Start: 10, Step: -3, Width: 2}, i: 3, want: "01"},
+		{name: "no padding", serial: Serial{Start: 7, Step: 1}, i: 2, want: "9"},
+		{name: "suffix", serial: Serial{Start: 1, Step: 1, Width: 2, Prefix: "B", Suffix: "/24"}, want: "B01/24"},
+
+		// A number with more digits than Width is not cut down to it.
+		{name: "padding overflow", serial: Serial{Start: 998, Step: 1, Width: 3}, i: 2, want: "1000"},
+		{name: "padding overflow with a check digit", serial: Serial{Start: 999, Step: 1, Width: 3, CheckDigit: CheckDigitGS1}, i: 1, want: "10009"},
+
+		{name: "luhn", serial: Serial{Start: 7992739871, Step: 1, CheckDigit: CheckDigitLuhn}, want: "79927398713"},
+		{name: "luhn of zero", serial: Serial{Step: 1, CheckDigit: CheckDigitLuhn}, want: "00"},
+		{name: "luhn after padding", serial: Serial{Start: 101, Step: 1, Width: 6, CheckDigit: CheckDigitLuhn, Prefix: "A"}, want: "A0001016"},
+		{name: "gs1 ean-13", serial: Serial{Start: 400638133393, Step: 1, CheckDigit: CheckDigitGS1}, want: "4006381333931"},
+		{name: "gs1 upc-a", serial: Serial{Start: 3600029145, Step: 1, Width: 11, CheckDigit: CheckDigitGS1}, want: "036000291452"},
+		{name: "gs1 check digit of ten wraps to zero", serial: Serial{Start: 55, Step: 1, CheckDigit: CheckDigitGS1}, want: "550"},
+		{name: "gs1 before overflow", serial: Serial{Start: 999, Step: 1, Width: 3, CheckDigit: CheckDigitGS1}, want: "9997"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.serial.Format(tt.i); got != tt.want {
+				t.Errorf("Format(%d) = %q, want %q", tt.i, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSerialExpand(t *testing.T) {
+	s := &Serial{Start: 1, Step: 1, Width: 3}
+	if got, want := s.Expand("{serial} of {serial}", 4), "005 of 005"; got != want {
+		t.Errorf("Expand = %q, want %q", got, want)
+	}
+	if got, want := s.Expand("no placeholder", 4), "no placeholder"; got != want {
+		t.Errorf("Expand = %q, want %q", got, want)
+	}
+}
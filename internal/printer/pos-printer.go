@@ -2,28 +2,59 @@ package printer
 
 import (
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
+	"pos-printer/internal/config"
+	"pos-printer/internal/virtual"
 	"strconv"
 
 	"github.com/google/gousb"
 )
 
 type usbWriter struct {
-	ep *gousb.OutEndpoint
+	ep   *gousb.OutEndpoint
+	intf *gousb.Interface
+	cfg  *gousb.Config
+	dev  *gousb.Device
 }
 
 func (w *usbWriter) Write(p []byte) (int, error) {
 	return w.ep.Write(p)
 }
 
+func (w *usbWriter) Close() error {
+	w.intf.Close()
+	w.cfg.Close()
+	return w.dev.Close()
+}
+
 type PosPrinter struct {
-	ctx *gousb.Context
+	ctx     *gousb.Context
+	cfg     *config.Config
+	virtual *virtual.Printer
 }
 
-func NewPosPrinter() *PosPrinter {
-	return &PosPrinter{
+func NewPosPrinter(cfg *config.Config) *PosPrinter {
+	p := &PosPrinter{
 		ctx: nil,
+		cfg: cfg,
+	}
+
+	vc := cfg.PrinterConfig.VirtualConfig
+	if vc.All || len(vc.Printers) > 0 {
+		p.virtual = virtual.New(virtual.Options{
+			Dir:          vc.Dir,
+			RenderPNG:    vc.RenderPNG,
+			Latency:      vc.Latency,
+			Fault:        virtual.Fault(vc.Fault),
+			FaultPercent: vc.FaultPercent,
+		})
 	}
+	return p
+}
+
+func (p *PosPrinter) isVirtual(vidHexStr, pidHexStr string) bool {
+	return p.virtual != nil && p.cfg.PrinterConfig.VirtualConfig.IsVirtual(vidHexStr, pidHexStr)
 }
 
 func (p *PosPrinter) posPrinterContext(vidHexStr, pidHexStr string) (*gousb.Context, gousb.ID, gousb.ID, error) {
@@ -68,7 +99,7 @@ func (p *PosPrinter) OpenPosPrinter(vidHexStr, pidHexStr string) (*gousb.Device,
 	dev, err := p.ctx.OpenDeviceWithVIDPID(_vid, _pid)
 	if err != nil {
 		if p.ctx != nil {
-			log.Printf("Failed to open device, resetting context and retrying: %v", err)
+			slog.Warn("Failed to open device, resetting context and retrying", "printer", vidHexStr+":"+pidHexStr, "error", err)
 			p.ResetContext()
 
 			// Create new context and retry
@@ -90,6 +121,10 @@ func (p *PosPrinter) OpenPosPrinter(vidHexStr, pidHexStr string) (*gousb.Device,
 }
 
 func (p *PosPrinter) CheckPrinter(vidHexStr, pidHexStr string) error {
+	if p.isVirtual(vidHexStr, pidHexStr) {
+		return p.virtual.Check(vidHexStr, pidHexStr)
+	}
+
 	ctx, vid, pid, err := p.posPrinterContext(vidHexStr, pidHexStr)
 	if err != nil {
 		return err
@@ -98,7 +133,7 @@ func (p *PosPrinter) CheckPrinter(vidHexStr, pidHexStr string) error {
 
 	dev, err := ctx.OpenDeviceWithVIDPID(vid, pid)
 	if err != nil {
-		log.Printf("error opening device %s:%s: %v", vidHexStr, pidHexStr, err)
+		slog.Error("Error opening device", "printer", vidHexStr+":"+pidHexStr, "error", err)
 		return err
 	}
 	if dev == nil {
@@ -108,23 +143,39 @@ func (p *PosPrinter) CheckPrinter(vidHexStr, pidHexStr string) error {
 	return nil
 }
 
-func (p *PosPrinter) GetESCPOSWriter(vidHexStr, pidHexStr string) (*usbWriter, *gousb.Device, error) {
+func (p *PosPrinter) GetESCPOSWriter(vidHexStr, pidHexStr string) (io.WriteCloser, error) {
+	return p.openWriter(vidHexStr, pidHexStr)
+}
+
+// openWriter returns the stream to send printer commands to, either the
+// USB bulk out endpoint or an emulated device. Closing it releases the
+// device.
+func (p *PosPrinter) openWriter(vidHexStr, pidHexStr string) (io.WriteCloser, error) {
+	if p.isVirtual(vidHexStr, pidHexStr) {
+		dev, err := p.virtual.Open(vidHexStr, pidHexStr)
+		if err != nil {
+			return nil, err
+		}
+		return dev, nil
+	}
+
 	dev, err := p.OpenPosPrinter(vidHexStr, pidHexStr)
 	if err != nil {
-		return nil, nil, err
+		return nil, err
 	}
+	dev.SetAutoDetach(true)
 
 	cfg, err := dev.Config(1)
 	if err != nil {
 		dev.Close()
-		return nil, nil, err
+		return nil, fmt.Errorf("could not set config: %w", err)
 	}
 
 	intf, err := cfg.Interface(0, 0)
 	if err != nil {
 		cfg.Close()
 		dev.Close()
-		return nil, nil, err
+		return nil, fmt.Errorf("could not claim interface: %w", err)
 	}
 
 	ep, err := intf.OutEndpoint(1)
@@ -132,12 +183,10 @@ func (p *PosPrinter) GetESCPOSWriter(vidHexStr, pidHexStr string) (*usbWriter, *
 		intf.Close()
 		cfg.Close()
 		dev.Close()
-		return nil, nil, err
+		return nil, fmt.Errorf("could not open endpoint: %w", err)
 	}
 
-	writer := &usbWriter{ep: ep}
-
-	return writer, dev, nil
+	return &usbWriter{ep: ep, intf: intf, cfg: cfg, dev: dev}, nil
 }
 
 func (p *PosPrinter) Close() {
@@ -0,0 +1,86 @@
+package receipt
+
+import (
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+
+	"github.com/gen2brain/go-fitz"
+	xdraw "golang.org/x/image/draw"
+)
+
+// Default ESC/POS line spacing of 1/6 inch at 203 dpi, used for feed lines.
+const lineHeightDots = 34
+
+// Options mirror the per job settings of the receipt_pdf_jobs table.
+type Options struct {
+	PrinterWidth int     // print head width in dots, 576 for 80 mm paper
+	Threshold    uint8   // luminance below which a dot is printed
+	FeedLines    int     // blank lines fed after the receipt
+	Zoom         float64 // render scale relative to 72 dpi
+}
+
+func DefaultOptions() Options {
+	return Options{
+		PrinterWidth: 576,
+		Threshold:    100,
+		FeedLines:    1,
+		Zoom:         2.0,
+	}
+}
+
+// Rasterize renders every page of a PDF receipt, scaled to the print head
+// width and reduced to black and white, into one continuous strip.
+func Rasterize(pdf []byte, opts Options) (*image.Gray, error) {
+	doc, err := fitz.NewFromMemory(pdf)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PDF: %w", err)
+	}
+	defer doc.Close()
+
+	if doc.NumPage() == 0 {
+		return nil, errors.New("PDF has no pages")
+	}
+
+	var pages []*image.Gray
+	height := 0
+	for i := 0; i < doc.NumPage(); i++ {
+		page, err := doc.ImageDPI(i, 72*opts.Zoom)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render page %d: %w", i+1, err)
+		}
+		scaled := scaleToWidth(page, opts.PrinterWidth)
+		threshold(scaled, opts.Threshold)
+		pages = append(pages, scaled)
+		height += scaled.Bounds().Dy()
+	}
+	height += opts.FeedLines * lineHeightDots
+
+	img := image.NewGray(image.Rect(0, 0, opts.PrinterWidth, height))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	y := 0
+	for _, page := range pages {
+		draw.Draw(img, page.Bounds().Add(image.Pt(0, y)), page, image.Point{}, draw.Src)
+		y += page.Bounds().Dy()
+	}
+	return img, nil
+}
+
+func scaleToWidth(src image.Image, width int) *image.Gray {
+	b := src.Bounds()
+	height := b.Dy() * width / max(b.Dx(), 1)
+	dst := image.NewGray(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, b, draw.Src, nil)
+	return dst
+}
+
+func threshold(img *image.Gray, level uint8) {
+	for i, y := range img.Pix {
+		if y < level {
+			img.Pix[i] = 0x00
+		} else {
+			img.Pix[i] = 0xff
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package virtual
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+
+	xdraw "golang.org/x/image/draw"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+)
+
+const (
+	escposWidthDots  = 576 // 80 mm paper
+	escposCharWidth  = 12  // font A
+	escposCharHeight = 24
+	escposLineHeight = 30
+)
+
+type escposState struct {
+	width      int
+	align      int
+	scaleW     int
+	scaleH     int
+	lineHeight int
+	text       []byte
+	rows       []*image.Gray
+}
+
+// renderESCPOS interprets the subset of ESC/POS used by receipt printing:
+// text with alignment and size, line feeds, raster images and cuts.
+func renderESCPOS(data []byte, width int) (*image.Gray, error) {
+	s := &escposState{width: width}
+	s.reset()
+
+	for i := 0; i < len(data); i++ {
+		b := data[i]
+		need := func(n int) ([]byte, error) {
+			if i+n >= len(data) {
+				return nil, fmt.Errorf("escpos: truncated command at byte %d", i)
+			}
+			args := data[i+1 : i+1+n]
+			i += n
+			return args, nil
+		}
+
+		switch b {
+		case '\n':
+			s.flush(true)
+		case '\r':
+		case 0x1b: // ESC
+			args, err := need(1)
+			if err != nil {
+				return nil, err
+			}
+			switch args[0] {
+			case '@':
+				s.flush(false)
+				s.reset()
+			case '2':
+				s.lineHeight = escposLineHeight
+			case 'a', 'd', 'E', '-', 'M', 't', 'G', '3', '!', 'J':
+				n, err := need(1)
+				if err != nil {
+					return nil, err
+				}
+				switch args[0] {
+				case 'a':
+					s.align = int(n[0] % 48)
+				case 'd':
+					s.flush(false)
+					s.feed(int(n[0]) * s.lineHeight)
+				case 'J':
+					s.flush(false)
+					s.feed(int(n[0]))
+				case '3':
+					s.lineHeight = max(int(n[0]), 1)
+				}
+			default:
+				return nil, fmt.Errorf("escpos: unsupported command ESC 0x%02x", args[0])
+			}
+		case 0x1d: // GS
+			args, err := need(1)
+			if err != nil {
+				return nil, err
+			}
+			switch args[0] {
+			case '!':
+				n, err := need(1)
+				if err != nil {
+					return nil, err
+				}
+				s.scaleW, s.scaleH = int(n[0]>>4)+1, int(n[0]&0x0f)+1
+			case 'V':
+				m, err := need(1)
+				if err != nil {
+					return nil, err
+				}
+				if m[0] == 65 || m[0] == 66 {
+					if _, err := need(1); err != nil {
+						return nil, err
+					}
+				}
+				s.flush(false)
+				s.cut()
+			case 'L', 'W':
+				if _, err := need(2); err != nil {
+					return nil, err
+				}
+			case 'v':
+				hdr, err := need(6)
+				if err != nil {
+					return nil, err
+				}
+				if hdr[0] != '0' {
+					return nil, fmt.Errorf("escpos: unsupported raster command GS v 0x%02x", hdr[0])
+				}
+				bytesPerRow := int(hdr[2]) | int(hdr[3])<<8
+				height := int(hdr[4]) | int(hdr[5])<<8
+				raster, err := need(bytesPerRow * height)
+				if err != nil {
+					return nil, err
+				}
+				s.flush(false)
+				s.raster(raster, bytesPerRow, height)
+			default:
+				return nil, fmt.Errorf("escpos: unsupported command GS 0x%02x", args[0])
+			}
+		default:
+			if b >= 0x20 {
+				s.text = append(s.text, b)
+			}
+		}
+	}
+	s.flush(false)
+
+	height := 0
+	for _, row := range s.rows {
+		height += row.Bounds().Dy()
+	}
+	img := image.NewGray(image.Rect(0, 0, width, max(height, 1)))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+	y := 0
+	for _, row := range s.rows {
+		draw.Draw(img, row.Bounds().Add(image.Pt(0, y)), row, image.Point{}, draw.Src)
+		y += row.Bounds().Dy()
+	}
+	return img, nil
+}
+
+func (s *escposState) reset() {
+	s.align = 0
+	s.scaleW, s.scaleH = 1, 1
+	s.lineHeight = escposLineHeight
+}
+
+func (s *escposState) blank(height int) *image.Gray {
+	row := image.NewGray(image.Rect(0, 0, s.width, height))
+	draw.Draw(row, row.Bounds(), image.White, image.Point{}, draw.Src)
+	s.rows = append(s.rows, row)
+	return row
+}
+
+func (s *escposState) feed(height int) {
+	if height > 0 {
+		s.blank(height)
+	}
+}
+
+// flush prints the pending text line; with newline set an empty line still
+// advances the paper.
+func (s *escposState) flush(newline bool) {
+	if len(s.text) == 0 {
+		if newline {
+			s.feed(s.lineHeight)
+		}
+		return
+	}
+
+	cellW, cellH := escposCharWidth*s.scaleW, escposCharHeight*s.scaleH
+	row := s.blank(max(s.lineHeight, cellH))
+
+	face := basicfont.Face7x13
+	src := image.NewGray(image.Rect(0, 0, len(s.text)*face.Advance, face.Height))
+	draw.Draw(src, src.Bounds(), image.White, image.Point{}, draw.Src)
+	d := font.Drawer{Dst: src, Src: image.Black, Face: face, Dot: fixed.P(0, face.Ascent)}
+	d.DrawString(string(s.text))
+
+	textWidth := min(len(s.text)*cellW, s.width)
+	x := 0
+	switch s.align {
+	case 1:
+		x = (s.width - textWidth) / 2
+	case 2:
+		x = s.width - textWidth
+	}
+	dst := image.Rect(x, 0, x+len(s.text)*cellW, cellH)
+	xdraw.NearestNeighbor.Scale(row, dst, src, src.Bounds(), draw.Src, nil)
+	s.text = s.text[:0]
+}
+
+func (s *escposState) raster(data []byte, bytesPerRow, height int) {
+	row := s.blank(height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < bytesPerRow*8 && x < s.width; x++ {
+			if data[y*bytesPerRow+x/8]&(0x80>>(x%8)) != 0 {
+				row.Pix[y*row.Stride+x] = 0
+			}
+		}
+	}
+}
+
+// cut marks the cut position with a dashed line.
+func (s *escposState) cut() {
+	row := s.blank(9)
+	for x := 0; x < s.width; x++ {
+		if x%12 < 6 {
+			row.Pix[4*row.Stride+x] = 0
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package virtual
+
+import (
+	"image"
+	"strings"
+	"testing"
+)
+
+// darkRows counts the rows of img with any black pixel.
+func darkRows(img *image.Gray) int {
+	n := 0
+	for y := 0; y < img.Bounds().Dy(); y++ {
+		for x := 0; x < img.Bounds().Dx(); x++ {
+			if img.Pix[y*img.Stride+x] == 0 {
+				n++
+				break
+			}
+		}
+	}
+	return n
+}
+
+func TestRenderESCPOS(t *testing.T) {
+	tests := []struct {
+		name       string
+		data       string
+		wantHeight int
+		wantDark   bool
+	}{
+		{name: "empty", data: "", wantHeight: 1},
+		{name: "line of text", data: "\x1b@Total 100tk\n", wantHeight: escposLineHeight, wantDark: true},
+		{name: "blank lines advance the paper", data: "\n\n", wantHeight: 2 * escposLineHeight},
+		{name: "double height text", data: "\x1d!\x11big\n", wantHeight: 2 * escposCharHeight, wantDark: true},
+		{name: "feed lines", data: "\x1bd\x03", wantHeight: 3 * escposLineHeight},
+		{name: "feed dots", data: "\x1bJ\x10", wantHeight: 16},
+		{name: "cut", data: "\x1dV\x42\x00", wantHeight: 9, wantDark: true},
+		{name: "raster", data: "\x1dv0\x00\x02\x00\x03\x00\xff\xff\x00\x00\x80\x01", wantHeight: 3, wantDark: true},
+		{name: "ignored commands", data: "\x1bE\x01\x1bt\x00\x1dL\x00\x00\x1dW\x00\x02\r", wantHeight: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img, err := renderESCPOS([]byte(tt.data), escposWidthDots)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if w := img.Bounds().Dx(); w != escposWidthDots {
+				t.Errorf("width = %d, want %d", w, escposWidthDots)
+			}
+			if h := img.Bounds().Dy(); h != tt.wantHeight {
+				t.Errorf("height = %d, want %d", h, tt.wantHeight)
+			}
+			if dark := darkRows(img) > 0; dark != tt.wantDark {
+				t.Errorf("printed something = %v, want %v", dark, tt.wantDark)
+			}
+		})
+	}
+}
+
+func TestRenderESCPOSRaster(t *testing.T) {
+	// Two rows of 16 dots: the first all black, the second only its ends.
+	img, err := renderESCPOS([]byte("\x1dv0\x00\x02\x00\x02\x00\xff\xff\x80\x01"), escposWidthDots)
+	if err != nil {
+		t.Fatal(err)
+	}
+	black := func(x, y int) bool { return img.Pix[y*img.Stride+x] == 0 }
+	for x := 0; x < 16; x++ {
+		if !black(x, 0) {
+			t.Errorf("dot %d of row 0 is white", x)
+		}
+		if want := x == 0 || x == 15; black(x, 1) != want {
+			t.Errorf("dot %d of row 1: black = %v, want %v", x, black(x, 1), want)
+		}
+	}
+	if black(16, 0) {
+		t.Error("dot 16 of row 0 is black, past the raster")
+	}
+}
+
+func TestRenderESCPOSErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{name: "truncated ESC", data: "\x1b", want: "truncated"},
+		{name: "truncated argument", data: "\x1ba", want: "truncated"},
+		{name: "truncated raster", data: "\x1dv0\x00\x02\x00\x02\x00\xff", want: "truncated"},
+		{name: "unsupported ESC", data: "\x1bZ", want: "unsupported command ESC"},
+		{name: "unsupported GS", data: "\x1dk\x00", want: "unsupported command GS"},
+		{name: "unsupported raster", data: "\x1dv1\x00\x01\x00\x01\x00\xff", want: "unsupported raster"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := renderESCPOS([]byte(tt.data), escposWidthDots); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want one containing %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,200 @@
+package virtual
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"pos-printer/internal/label"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Fault string
+
+const (
+	FaultNone       Fault = ""
+	FaultPaperOut   Fault = "paper-out"
+	FaultDisconnect Fault = "disconnect"
+)
+
+var (
+	ErrPaperOut     = errors.New("virtual printer: paper out")
+	ErrDisconnected = errors.New("virtual printer: device disconnected")
+)
+
+type Options struct {
+	Dir          string        // where received streams are recorded, "" disables recording
+	RenderPNG    bool          // also render every recorded stream to PNG
+	Latency      time.Duration // delay added to every write
+	Fault        Fault         // fault to simulate
+	FaultPercent int           // chance of the fault per print, 0-100
+}
+
+// Printer emulates any number of USB printers, keyed by VID and PID. It
+// accepts the byte stream a real printer would get, parses it and records
+// it to disk instead of printing.
+type Printer struct {
+	opts Options
+
+	mu  sync.Mutex
+	seq int
+}
+
+func New(opts Options) *Printer {
+	return &Printer{opts: opts}
+}
+
+func (p *Printer) fault() Fault {
+	if p.opts.Fault == FaultNone || rand.IntN(100) >= p.opts.FaultPercent {
+		return FaultNone
+	}
+	return p.opts.Fault
+}
+
+func (p *Printer) Check(vid, pid string) error {
+	if p.fault() == FaultDisconnect {
+		return fmt.Errorf("printer %s:%s not found: %w", vid, pid, ErrDisconnected)
+	}
+	return nil
+}
+
+// Open starts a print session; the stream is parsed and recorded on Close.
+func (p *Printer) Open(vid, pid string) (*Device, error) {
+	fault := p.fault()
+	if fault == FaultDisconnect {
+		return nil, fmt.Errorf("error opening device %s:%s: %w", vid, pid, ErrDisconnected)
+	}
+	return &Device{printer: p, vid: vid, pid: pid, fault: fault}, nil
+}
+
+type Device struct {
+	printer *Printer
+	vid     string
+	pid     string
+	fault   Fault
+	buf     bytes.Buffer
+}
+
+func (d *Device) Write(b []byte) (int, error) {
+	if d.printer.opts.Latency > 0 {
+		time.Sleep(d.printer.opts.Latency)
+	}
+	if d.fault == FaultPaperOut {
+		return 0, ErrPaperOut
+	}
+	return d.buf.Write(b)
+}
+
+// Close parses the received stream, so a malformed command is reported the
+// way a real printer would refuse to print it, and records it to disk.
+func (d *Device) Close() error {
+	if d.buf.Len() == 0 {
+		return nil
+	}
+	data := d.buf.Bytes()
+	lang := detectLanguage(data)
+
+	var images []image.Image
+	var err error
+	switch lang {
+	case "tspl":
+		var labels []*label.Label
+		labels, err = label.ParseTSPL(data)
+		for _, l := range labels {
+			if !d.printer.opts.RenderPNG || err != nil {
+				break
+			}
+			var img image.Image
+			img, err = label.Rasterize(l)
+			images = append(images, img)
+		}
+	case "escpos":
+		var img image.Image
+		img, err = renderESCPOS(data, escposWidthDots)
+		images = append(images, img)
+	}
+
+	if rerr := d.record(lang, data, images); rerr != nil {
+		slog.Error("Virtual printer failed to record stream", "printer", d.vid+":"+d.pid, "error", rerr)
+	}
+	if err != nil {
+		return fmt.Errorf("virtual printer %s:%s: invalid %s stream: %w", d.vid, d.pid, lang, err)
+	}
+	return nil
+}
+
+func (d *Device) record(lang string, data []byte, images []image.Image) error {
+	if d.printer.opts.Dir == "" {
+		return nil
+	}
+
+	dir := filepath.Join(d.printer.opts.Dir, sanitize(d.vid)+"-"+sanitize(d.pid))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	d.printer.mu.Lock()
+	d.printer.seq++
+	base := fmt.Sprintf("%s-%04d", time.Now().Format("20060102-150405.000"), d.printer.seq)
+	d.printer.mu.Unlock()
+
+	path := filepath.Join(dir, base+"."+lang)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return err
+	}
+	slog.Info("Virtual printer recorded stream", "printer", d.vid+":"+d.pid, "bytes", len(data), "language", lang, "path", path)
+
+	if !d.printer.opts.RenderPNG {
+		return nil
+	}
+	for i, img := range images {
+		if img == nil {
+			continue
+		}
+		f, err := os.Create(filepath.Join(dir, fmt.Sprintf("%s-%d.png", base, i+1)))
+		if err != nil {
+			return err
+		}
+		err = png.Encode(f, img)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func detectLanguage(data []byte) string {
+	trimmed := bytes.TrimLeft(data, " \t\r\n")
+	switch {
+	case len(trimmed) == 0:
+		return "bin"
+	case trimmed[0] == 0x1b || trimmed[0] == 0x1d:
+		return "escpos"
+	case bytes.HasPrefix(trimmed, []byte("^XA")) || bytes.HasPrefix(trimmed, []byte("~JC")):
+		return "zpl"
+	case trimmed[0] == 0x02:
+		return "dpl"
+	case bytes.HasPrefix(trimmed, []byte("N\n")) || bytes.HasPrefix(trimmed, []byte("xa\n")):
+		return "epl"
+	case bytes.HasPrefix(trimmed, []byte("SIZE ")) || bytes.HasPrefix(trimmed, []byte("AUTODETECT")):
+		return "tspl"
+	}
+	return "bin"
+}
+
+func sanitize(id string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' {
+			return r
+		}
+		return '_'
+	}, id)
+}
@@ -0,0 +1,156 @@
+package virtual
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"pos-printer/internal/label"
+	"strings"
+	"testing"
+	"time"
+)
+
+// tsplLabel renders a small label the way the barcode printer sends it.
+func tsplLabel(t *testing.T) []byte {
+	t.Helper()
+	renderer, err := label.NewRenderer(label.TSPL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := renderer.Render(label.NewBarcodeLabel(40, 30, 0, "100tk", "AX2B2CL21LL2", 2, 2, 0, label.DefaultDotsPerMM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDetectLanguage(t *testing.T) {
+	tests := []struct {
+		data string
+		want string
+	}{
+		{"", "bin"},
+		{" \r\n", "bin"},
+		{"\x1b@hello\n", "escpos"},
+		{"\x1dV\x00", "escpos"},
+		{"^XA^FDx^FS^XZ", "zpl"},
+		{"~JC^XA", "zpl"},
+		{"\x02L\r\n", "dpl"},
+		{"\nN\nA10,10,0,1,1,1,N,\"x\"\nP1\n", "epl"},
+		{"xa\n", "epl"},
+		{"SIZE 40 mm,30 mm\r\n", "tspl"},
+		{"AUTODETECT\r\n", "tspl"},
+		{"hello", "bin"},
+	}
+	for _, tt := range tests {
+		if got := detectLanguage([]byte(tt.data)); got != tt.want {
+			t.Errorf("detectLanguage(%q) = %q, want %q", tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestDeviceRecordsStream(t *testing.T) {
+	dir := t.TempDir()
+	p := New(Options{Dir: dir, RenderPNG: true})
+	data := tsplLabel(t)
+
+	dev, err := p.Open("0x0fe6", "0x8800")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dev.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := dev.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	streams, _ := filepath.Glob(filepath.Join(dir, "0x0fe6-0x8800", "*.tspl"))
+	if len(streams) != 1 {
+		t.Fatalf("recorded %v, want one .tspl stream", streams)
+	}
+	if got, _ := os.ReadFile(streams[0]); string(got) != string(data) {
+		t.Error("recorded stream differs from what was written")
+	}
+	if pngs, _ := filepath.Glob(filepath.Join(dir, "0x0fe6-0x8800", "*.png")); len(pngs) != 1 {
+		t.Errorf("rendered %v, want one PNG for the label", pngs)
+	}
+}
+
+func TestDeviceRejectsInvalidStream(t *testing.T) {
+	dir := t.TempDir()
+	p := New(Options{Dir: dir})
+	dev, err := p.Open("0x0fe6", "0x8800")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dev.Write([]byte("SIZE 40 mm,30 mm\r\nBARCODE 10,10,\"128\"\r\nPRINT 1\r\n"))
+	if err := dev.Close(); err == nil || !strings.Contains(err.Error(), "invalid tspl stream") {
+		t.Errorf("Close = %v, want an invalid tspl stream error", err)
+	}
+	// The stream is still recorded, to see what the printer refused.
+	if streams, _ := filepath.Glob(filepath.Join(dir, "*", "*.tspl")); len(streams) != 1 {
+		t.Errorf("recorded %v, want the refused stream", streams)
+	}
+}
+
+func TestFaults(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        Options
+		wantCheck   error
+		wantOpen    error
+		wantWrite   error
+		wantRecords int
+	}{
+		{name: "no fault", opts: Options{}, wantRecords: 1},
+		{name: "paper out", opts: Options{Fault: FaultPaperOut, FaultPercent: 100}, wantWrite: ErrPaperOut},
+		{
+			name: "disconnect", opts: Options{Fault: FaultDisconnect, FaultPercent: 100},
+			wantCheck: ErrDisconnected, wantOpen: ErrDisconnected,
+		},
+		{name: "fault never happens at 0%", opts: Options{Fault: FaultPaperOut, FaultPercent: 0}, wantRecords: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Dir = t.TempDir()
+			p := New(tt.opts)
+
+			if err := p.Check("0x0fe6", "0x8800"); !errors.Is(err, tt.wantCheck) {
+				t.Errorf("Check = %v, want %v", err, tt.wantCheck)
+			}
+			dev, err := p.Open("0x0fe6", "0x8800")
+			if !errors.Is(err, tt.wantOpen) {
+				t.Fatalf("Open = %v, want %v", err, tt.wantOpen)
+			}
+			if err != nil {
+				return
+			}
+			if _, err := dev.Write(tsplLabel(t)); !errors.Is(err, tt.wantWrite) {
+				t.Errorf("Write = %v, want %v", err, tt.wantWrite)
+			}
+			if err := dev.Close(); err != nil {
+				t.Errorf("Close = %v", err)
+			}
+			if streams, _ := filepath.Glob(filepath.Join(tt.opts.Dir, "*", "*")); len(streams) != tt.wantRecords {
+				t.Errorf("recorded %v, want %d streams", streams, tt.wantRecords)
+			}
+		})
+	}
+}
+
+func TestLatency(t *testing.T) {
+	const latency = 30 * time.Millisecond
+	dev, err := New(Options{Latency: latency}).Open("0x0fe6", "0x8800")
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	for i := 0; i < 2; i++ {
+		dev.Write(tsplLabel(t))
+	}
+	if elapsed := time.Since(start); elapsed < 2*latency {
+		t.Errorf("two writes took %s, want at least %s", elapsed, 2*latency)
+	}
+}